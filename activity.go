@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"todo/internal/render"
+)
+
+const (
+	activityCollection = "activity"
+	// Activity older than this expires.
+	activityRetention = 90 * 24 * time.Hour
+
+	defaultActivityLimit = 50
+	maxActivityLimit     = 200
+)
+
+// What happened to a todo, as the activity feed tells it. Completing or
+// reopening a todo is told apart from other edits; blocker changes and
+// board moves aren't recorded.
+const (
+	activityCreated   = "created"
+	activityUpdated   = "updated"
+	activityCompleted = "completed"
+	activityReopened  = "reopened"
+	activityDeleted   = "deleted"
+)
+
+// activityEntry is one line in the activity feed. Title is the todo's
+// title at the time, so the entry still reads well once the todo is gone.
+type activityEntry struct {
+	ID     primitive.ObjectID `bson:"_id"`
+	Action string             `bson:"action"`
+	TodoID primitive.ObjectID `bson:"todo_id"`
+	Title  string             `bson:"title"`
+	At     time.Time          `bson:"at"`
+}
+
+func newActivityEntry(action string, todoID primitive.ObjectID, title string) activityEntry {
+	return activityEntry{ID: primitive.NewObjectID(), Action: action, TodoID: todoID, Title: title, At: time.Now()}
+}
+
+// updateActivity is the action for applying set to before.
+func updateActivity(before todoModel, set bson.M) string {
+	if c, ok := set["completed"].(bool); ok && c != before.Completed {
+		if c {
+			return activityCompleted
+		}
+		return activityReopened
+	}
+	return activityUpdated
+}
+
+type activity struct {
+	ID     string    `json:"id"`
+	Action string    `json:"action"`
+	TodoID string    `json:"todo_id"`
+	Title  string    `json:"title"`
+	At     time.Time `json:"at"`
+	Links  links     `json:"_links,omitempty"`
+}
+
+// activity serves what happened to todos, newest first, ?limit= at a
+// time. Pages are chained by ?before=, the ID of the last entry seen, so
+// new activity doesn't shift them; the next link carries it.
+func (a *app) activity(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	var before primitive.ObjectID
+	if v := r.URL.Query().Get("before"); v != "" {
+		id, err := primitive.ObjectIDFromHex(v)
+		if err != nil {
+			a.rnd.JSON(w, http.StatusBadRequest, render.M{
+				"message": tr(r, "activity.before_invalid"),
+			})
+			return
+		}
+		before = id
+	}
+	limit := int64(defaultActivityLimit)
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 1 || n > maxActivityLimit {
+			a.rnd.JSON(w, http.StatusBadRequest, render.M{
+				"message": tr(r, "activity.limit_invalid", maxActivityLimit),
+			})
+			return
+		}
+		limit = n
+	}
+
+	found, err := a.todos.Activity(ctx, before, limit+1)
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "activity.fetch_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	more := int64(len(found)) > limit
+	if more {
+		found = found[:limit]
+	}
+
+	base := siblingTodoBase(r, "activity")
+	out := make([]activity, len(found))
+	for i, e := range found {
+		out[i] = activity{
+			ID:     e.ID.Hex(),
+			Action: e.Action,
+			TodoID: e.TodoID.Hex(),
+			Title:  e.Title,
+			At:     e.At,
+		}
+		if e.Action != activityDeleted {
+			out[i].Links = links{"todo": {Href: base + "/" + e.TodoID.Hex()}}
+		}
+	}
+	self := *r.URL
+	page := links{"self": {Href: self.String()}}
+	if more {
+		q := r.URL.Query()
+		q.Set("before", out[len(out)-1].ID)
+		self.RawQuery = q.Encode()
+		page["next"] = link{Href: self.String()}
+	}
+	a.rnd.JSON(w, http.StatusOK, render.M{
+		"data":     out,
+		"has_more": more,
+		"_links":   page,
+	})
+}
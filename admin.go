@@ -0,0 +1,50 @@
+package main
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"todo/internal/i18n"
+)
+
+var startedAt = time.Now()
+
+func init() {
+	expvar.Publish("goroutines", expvar.Func(func() interface{} { return runtime.NumGoroutine() }))
+	expvar.Publish("uptime_seconds", expvar.Func(func() interface{} { return int64(time.Since(startedAt) / time.Second) }))
+}
+
+// adminRoutes serves operator controls and diagnostics on the separate ADMIN_ADDR listener. It
+// has no authentication of its own: bind it to localhost or a private
+// network only.
+func (a *app) adminRoutes() http.Handler {
+	r := chi.NewRouter()
+	r.Use(i18n.Middleware(a.messages))
+	r.Get("/admin/maintenance", a.fetchMaintenance)
+	r.Put("/admin/maintenance", a.updateMaintenance)
+	r.Get("/admin/jobs", a.fetchJobs)
+	r.Post("/admin/jobs/{name}/run", a.runJob)
+	r.Get("/admin/queue/failed", a.fetchFailedJobs)
+	r.Post("/admin/queue/failed/{id}/retry", a.retryJob)
+	r.Route("/admin/outbox", func(r chi.Router) {
+		r.Use(a.requireOutbox)
+		r.Get("/sinks", a.fetchSinks)
+		r.Get("/failed", a.fetchDeadLetters)
+		r.Post("/failed/{id}/redeliver", a.redeliver)
+	})
+	r.Get("/debug/vars", expvar.Handler().ServeHTTP)
+	r.HandleFunc("/debug/pprof/", pprof.Index)
+	r.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	r.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	r.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	r.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	r.Handle("/debug/pprof/{profile}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pprof.Handler(chi.URLParam(r, "profile")).ServeHTTP(w, r)
+	}))
+	return r
+}
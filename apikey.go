@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"todo/internal/render"
+)
+
+// apiKey is a configured client credential. Keys are held only as their
+// SHA-256, so the plaintext is not kept in memory after startup.
+type apiKey struct {
+	Name string
+	Tier string
+}
+
+// identity is who a request is from: a named API key, or anonymous.
+type identity struct {
+	KeyName string
+	Tier    string
+}
+
+type identityKey struct{}
+
+const anonymousTier = "anonymous"
+
+var (
+	errAPIKeyInvalid  = unauthorizedError("auth.api_key_invalid", "unknown API key")
+	errAPIKeyRequired = unauthorizedError("auth.api_key_required", "API key required")
+)
+
+const (
+	// keyFailureLimit wrong API keys from one IP within keyFailureWindow
+	// lock that IP out of key authentication until the window has passed.
+	keyFailureLimit  = 10
+	keyFailureWindow = 15 * time.Minute
+
+	// keyFailureSweep is how often Run drops hosts whose failures have
+	// all aged out. maxFailingHosts bounds how many hosts are remembered
+	// at once; past it the one that failed longest ago is forgotten.
+	keyFailureSweep = time.Minute
+	maxFailingHosts = 10000
+)
+
+// keyFailures remembers recent wrong API keys per client IP. It lives in
+// memory, so a restart forgets it and each replica keeps its own.
+type keyFailures struct {
+	mu   sync.Mutex
+	seen map[string][]time.Time
+}
+
+// recent drops host's failures older than the window and returns the
+// rest. Other hosts are left to sweep.
+func (f *keyFailures) recent(host string, now time.Time) []time.Time {
+	times := f.seen[host]
+	for len(times) > 0 && now.Sub(times[0]) >= keyFailureWindow {
+		times = times[1:]
+	}
+	if len(times) == 0 {
+		delete(f.seen, host)
+		return nil
+	}
+	f.seen[host] = times
+	return times
+}
+
+// Run sweeps every keyFailureSweep until ctx is done.
+func (f *keyFailures) Run(ctx context.Context) {
+	tick := time.NewTicker(keyFailureSweep)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-tick.C:
+			f.mu.Lock()
+			f.sweep(now)
+			f.mu.Unlock()
+		}
+	}
+}
+
+// sweep forgets every host with no failures left in the window.
+func (f *keyFailures) sweep(now time.Time) {
+	for h := range f.seen {
+		f.recent(h, now)
+	}
+}
+
+// makeRoom forgets the host whose latest failure is oldest, after a sweep,
+// when maxFailingHosts are already remembered.
+func (f *keyFailures) makeRoom(now time.Time) {
+	if len(f.seen) < maxFailingHosts {
+		return
+	}
+	f.sweep(now)
+	if len(f.seen) < maxFailingHosts {
+		return
+	}
+	oldest, at := "", now
+	for h, times := range f.seen {
+		if last := times[len(times)-1]; !last.After(at) {
+			oldest, at = h, last
+		}
+	}
+	delete(f.seen, oldest)
+}
+
+// lockedUntil is when host may try keys again, or zero if it may now.
+func (f *keyFailures) lockedUntil(host string, now time.Time) time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	times := f.recent(host, now)
+	if len(times) < keyFailureLimit {
+		return time.Time{}
+	}
+	return times[len(times)-keyFailureLimit].Add(keyFailureWindow)
+}
+
+// add records a wrong key from host and returns how many it has sent
+// within the window.
+func (f *keyFailures) add(host string, now time.Time) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.seen == nil {
+		f.seen = map[string][]time.Time{}
+	}
+	times := f.recent(host, now)
+	if times == nil {
+		f.makeRoom(now)
+	}
+	f.seen[host] = append(times, now)
+	return len(f.seen[host])
+}
+
+func hashAPIKey(key string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(key))
+}
+
+// parseAPIKeys reads API_KEYS, a comma-separated list of name:key:tier.
+func parseAPIKeys(v string) (map[[sha256.Size]byte]apiKey, error) {
+	keys := map[[sha256.Size]byte]apiKey{}
+	for _, entry := range strings.Split(v, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ":")
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("API_KEYS entries must be name:key:tier")
+		}
+		keys[hashAPIKey(parts[1])] = apiKey{Name: parts[0], Tier: parts[2]}
+	}
+	return keys, nil
+}
+
+// requestAPIKey returns the key from "Authorization: Bearer" or X-API-Key.
+func requestAPIKey(r *http.Request) string {
+	if v := r.Header.Get("X-API-Key"); v != "" {
+		return v
+	}
+	if scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// identify attaches the caller's identity to the request. Requests without
+// a key are anonymous; a key that isn't configured is rejected with 401
+// rather than quietly downgraded. An IP that keeps sending wrong keys is
+// refused key authentication with 429 for a while, right keys included.
+func (a *app) identify(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := identity{Tier: anonymousTier}
+		if key := requestAPIKey(r); key != "" {
+			host, now := clientHost(r), time.Now()
+			if until := a.keyFails.lockedUntil(host, now); !until.IsZero() {
+				retry := max(int(until.Sub(now).Round(time.Second)/time.Second), 1)
+				w.Header().Set("Retry-After", strconv.Itoa(retry))
+				a.rnd.JSON(w, http.StatusTooManyRequests, render.M{
+					"message": tr(r, "auth.locked_out", retry),
+				})
+				return
+			}
+			k, ok := a.cfg.APIKeys[hashAPIKey(key)]
+			if !ok {
+				if n := a.keyFails.add(host, now); n == keyFailureLimit {
+					log.Printf("auth: %s locked out after %d wrong API keys", host, n)
+				}
+				a.fail(w, r, errAPIKeyInvalid, "")
+				return
+			}
+			id = identity{KeyName: k.Name, Tier: k.Tier}
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, id)))
+	})
+}
+
+func identityFrom(ctx context.Context) identity {
+	if id, ok := ctx.Value(identityKey{}).(identity); ok {
+		return id
+	}
+	return identity{Tier: anonymousTier}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+
+	"todo/internal/accesslog"
+	"todo/internal/events"
+	"todo/internal/i18n"
+	"todo/internal/ratelimit"
+	"todo/internal/render"
+	"todo/internal/report"
+	"todo/internal/respcache"
+)
+
+// app owns the renderer, repositories and configuration. Handlers are its
+// methods, so an app can be built on any repository implementation.
+type app struct {
+	cfg       config
+	rnd       *render.Render
+	messages  *i18n.Bundle
+	todos     todoRepository
+	service   todoService
+	board     boardRepository
+	templates templateRepository
+	settings  settingsRepository
+	health    healthChecker
+
+	notifications notificationRepository
+	customFields  customFieldRepository
+	events        *events.Bus
+
+	// outbox is nil unless an event sink is configured.
+	outbox deadLetterQueue
+	jobs   *scheduler
+	queue  jobQueue
+
+	downloads downloadRepository
+
+	accessLog io.Writer
+	reporter  report.Reporter
+	maint     atomic.Pointer[maintenanceState]
+	limiter   *ratelimit.Limiter
+	nearby    cooldown
+	keyFails  keyFailures
+
+	// stale holds recent todo responses to serve while the database is
+	// down; nil when STALE_CACHE_MB is 0.
+	stale *respcache.Cache
+
+	csrfSecret []byte
+}
+
+func newApp(cfg config, todos todoRepository, board boardRepository, templates templateRepository, settings settingsRepository, notifications notificationRepository, customFields customFieldRepository, health healthChecker, bus *events.Bus) (*app, error) {
+	messages, err := i18n.NewBundle()
+	if err != nil {
+		return nil, err
+	}
+	accessLog, err := accesslog.Open(cfg.AccessLog)
+	if err != nil {
+		return nil, fmt.Errorf("ACCESS_LOG: %w", err)
+	}
+	var reporter report.Reporter
+	if cfg.SentryDSN != "" {
+		if reporter, err = report.NewSentry(cfg.SentryDSN); err != nil {
+			return nil, fmt.Errorf("SENTRY_DSN: %w", err)
+		}
+	}
+	csrfSecret := []byte(cfg.CSRFSecret)
+	if len(csrfSecret) == 0 {
+		// Tokens then only survive as long as the process; set
+		// CSRF_SECRET when running more than one replica.
+		csrfSecret = make([]byte, 32)
+		rand.Read(csrfSecret)
+	}
+	a := &app{
+		cfg:       cfg,
+		rnd:       render.New(render.Options{Reload: cfg.DevMode}),
+		messages:  messages,
+		todos:     todos,
+		service:   todoService{todos: todos},
+		board:     board,
+		templates: templates,
+		settings:  settings,
+		health:    health,
+
+		notifications: notifications,
+		customFields:  customFields,
+		events:        bus,
+
+		accessLog: accessLog,
+		reporter:  reporter,
+		limiter:   ratelimit.New(),
+
+		csrfSecret: csrfSecret,
+	}
+	if cfg.StaleCacheMB > 0 {
+		a.stale = respcache.New(int(cfg.StaleCacheMB) << 20)
+	}
+	a.setMaintenance(cfg.Maintenance, 0)
+	return a, nil
+}
+
+func (a *app) routes() http.Handler {
+	r := chi.NewRouter()
+	if a.cfg.TrustProxy {
+		// Rate limits key anonymous callers on RemoteAddr.
+		r.Use(middleware.RealIP)
+	}
+	r.Use(middleware.RequestID)
+	r.Use(accesslog.Middleware(accesslog.Options{Output: a.accessLog, SampleRate: a.cfg.AccessLogSample}))
+	r.Use(deadline(a.cfg.HandlerTimeout))
+	r.Use(i18n.Middleware(a.messages))
+	r.Use(a.recoverer)
+	r.Get("/healthz", a.healthz)
+	r.Get("/version", a.versionHandler)
+	r.Group(func(r chi.Router) {
+		r.Use(a.identify)
+		r.Use(a.throttle)
+		r.Use(a.inMaintenance)
+		r.Use(a.csrf)
+		r.Get("/", a.homeHandler)
+		r.With(a.serveStale, a.requireDB).Mount("/todo", a.todoHandlers())
+		r.With(a.serveStale, a.requireDB).Mount("/api/todo", a.todoHandlers())
+		r.With(a.requireDB).Mount("/me", a.meHandlers())
+		r.With(a.requireDB).Mount("/api/me", a.meHandlers())
+		r.With(a.requireDB).Mount("/templates", a.templateHandlers())
+		r.With(a.requireDB).Mount("/api/templates", a.templateHandlers())
+		r.With(a.requireDB).Mount("/fields", a.customFieldHandlers())
+		r.With(a.requireDB).Mount("/api/fields", a.customFieldHandlers())
+		r.With(a.requireDB).Mount("/board", a.boardHandlers())
+		r.With(a.requireDB).Mount("/api/board", a.boardHandlers())
+		r.With(a.requireDB).Get("/calendar", a.calendar)
+		r.With(a.requireDB).Get("/api/calendar", a.calendar)
+		r.With(a.requireDB).Get("/timeline", a.timeline)
+		r.With(a.requireDB).Get("/api/timeline", a.timeline)
+		r.With(a.requireDB).Get("/changes", a.changes)
+		r.With(a.requireDB).Get("/api/changes", a.changes)
+		r.With(a.requireDB).Get("/activity", a.activity)
+		r.With(a.requireDB).Get("/api/activity", a.activity)
+		r.With(a.requireDB).Post("/sync", a.syncTodos)
+		r.With(a.requireDB).Post("/api/sync", a.syncTodos)
+		r.With(a.requireDB).Mount("/views", a.viewHandlers())
+		r.With(a.requireDB).Mount("/api/views", a.viewHandlers())
+		r.With(a.requireDB).Mount("/hooks", a.hookHandlers())
+		r.With(a.requireDB).Mount("/api/hooks", a.hookHandlers())
+		r.With(a.requireDB).Get("/jobs/{id}", a.fetchJob)
+		r.With(a.requireDB).Get("/api/jobs/{id}", a.fetchJob)
+		r.With(a.requireDB).Get("/downloads/{token}", a.fetchDownload)
+		r.With(a.requireDB).Get("/api/downloads/{token}", a.fetchDownload)
+	})
+
+	if a.cfg.SPADir != "" {
+		r.Handle("/app", http.RedirectHandler("/app/", http.StatusMovedPermanently))
+		r.Handle("/app/*", spaHandler("/app", a.cfg.SPADir))
+	}
+	return r
+}
+
+// requireDB short-circuits with 503 until the database is reachable.
+func (a *app) requireDB(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.health.Ready() {
+			w.Header().Set("Retry-After", "5")
+			a.rnd.JSON(w, http.StatusServiceUnavailable, render.M{
+				"message": tr(r, "db.unavailable"),
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *app) healthz(w http.ResponseWriter, r *http.Request) {
+	if !a.health.Ready() {
+		a.rnd.JSON(w, http.StatusServiceUnavailable, render.M{"status": "starting"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+	if err := a.health.Ping(ctx); err != nil {
+		a.rnd.JSON(w, http.StatusServiceUnavailable, render.M{
+			"status": "unavailable",
+			"error":  err.Error(),
+		})
+		return
+	}
+	a.rnd.JSON(w, http.StatusOK, render.M{"status": "ok"})
+}
+
+// dbContext bounds a request's database work by the configured operation
+// timeout (zero means none) and by the request's budget. It derives from
+// the request context, so a client disconnect or server shutdown cancels
+// the query too.
+func (a *app) dbContext(r *http.Request) (context.Context, context.CancelFunc) {
+	return budget(r.Context(), a.cfg.DBTimeout)
+}
+
+func tr(r *http.Request, key string, args ...interface{}) string {
+	return i18n.FromContext(r.Context()).T(key, args...)
+}
+
+// isHTMX reports whether the request came from the HTMX web UI, which
+// expects HTML fragments rather than JSON.
+func isHTMX(r *http.Request) bool {
+	return r.Header.Get("HX-Request") == "true"
+}
+
+// isForm reports whether the body is a URL-encoded form, as the web UI
+// posts, rather than JSON.
+func isForm(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "application/x-www-form-urlencoded"
+}
+
+// representation is one response in each format a client can negotiate.
+// XML and JSONAPI may be nil when a resource has no such form; MessagePack
+// always mirrors JSON.
+type representation struct {
+	JSON    interface{}
+	XML     interface{}
+	JSONAPI interface{}
+}
+
+// respond writes the form of rep the Accept header prefers, or 406 when
+// it accepts none of the available ones. JSON wins when the client has no
+// preference.
+func (a *app) respond(w http.ResponseWriter, r *http.Request, status int, rep representation) {
+	offers := []string{"application/json"}
+	if rep.XML != nil {
+		offers = append(offers, "application/xml", "text/xml")
+	}
+	offers = append(offers, "application/msgpack", "application/x-msgpack")
+	if rep.JSONAPI != nil {
+		offers = append(offers, contentJSONAPI)
+	}
+
+	w.Header().Add("Vary", "Accept")
+	switch render.Negotiate(r.Header.Get("Accept"), offers...) {
+	case "application/json":
+		a.rnd.JSON(w, status, rep.JSON)
+	case "application/xml", "text/xml":
+		a.rnd.XML(w, status, rep.XML)
+	case "application/msgpack", "application/x-msgpack":
+		a.rnd.MsgPack(w, status, rep.JSON)
+	case contentJSONAPI:
+		a.rnd.JSONType(w, status, contentJSONAPI, rep.JSONAPI)
+	default:
+		a.rnd.JSON(w, http.StatusNotAcceptable, render.M{
+			"message":   tr(r, "request.not_acceptable"),
+			"available": offers,
+		})
+	}
+}
+
+// decodeTodo reads a todo from either a JSON body or a submitted form.
+func decodeTodo(r *http.Request, t *todoInput) error {
+	if !isForm(r) {
+		return json.NewDecoder(r.Body).Decode(t)
+	}
+	if err := r.ParseForm(); err != nil {
+		return err
+	}
+	t.Title = r.PostForm.Get("title")
+	t.Text = r.PostForm.Get("text")
+	t.Completed = r.PostForm.Get("completed") == "true"
+	return nil
+}
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"todo/internal/fieldcrypt"
+)
+
+// backupFormat is bumped whenever the file layout changes incompatibly.
+const backupFormat = 1
+
+// backupHeader is everything in a backup file except the todos, which
+// follow it as a streamed array so restores don't hold them all in memory.
+type backupHeader struct {
+	Format    int       `json:"format"`
+	CreatedAt time.Time `json:"created_at"`
+	Settings  settings  `json:"settings"`
+	// CustomFields come before the todos so restore knows how to store
+	// their values. Backups without them use the fields already defined.
+	CustomFields []customField `json:"custom_fields,omitempty"`
+}
+
+// backupTodo is a todo as a backup holds it: as clients see it, plus the
+// links it holds, which clients only see through /links.
+type backupTodo struct {
+	todo
+	Related []backupRelation `json:"related,omitempty"`
+}
+
+type backupRelation struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// repositories builds the repositories a command works through. Events
+// are never queued from the CLI.
+func repositories(ctx context.Context, cfg config) (todoRepository, settingsRepository, customFieldRepository, func(), error) {
+	var cipher *fieldcrypt.Cipher
+	if cfg.EncryptionKey != "" {
+		var err error
+		if cipher, err = fieldcrypt.NewFromBase64(cfg.EncryptionKey); err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("invalid ENCRYPTION_KEY: %w", err)
+		}
+	}
+	client, err := openDatabase(ctx, cfg)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	db := client.Database(dbName)
+	conn := &mongoConn{client: client}
+	closeFn := func() { client.Disconnect(context.Background()) }
+	return newMongoTodoRepository(db.Collection(collectionName), conn, cipher, nil),
+		newMongoSettingsRepository(db.Collection(settingsCollection), conn, cfg),
+		newMongoCustomFieldRepository(db.Collection(customFieldsCollection), db.Collection(collectionName), conn),
+		closeFn, nil
+}
+
+// backupCommand writes settings, custom fields and every todo to a
+// gzipped JSON file.
+// Titles are written decrypted, so a backup restores under any key and
+// must be stored as carefully as the key itself.
+func backupCommand(ctx context.Context, cfg config, args []string) int {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	out := fs.String("out", "", `file to write, or "-" for stdout`)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *out == "" {
+		fs.Usage()
+		return 2
+	}
+
+	todos, store, fields, closeFn, err := repositories(ctx, cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer closeFn()
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		f, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+
+	n, err := writeBackup(ctx, w, todos, store, fields)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "backup failed:", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "backed up %d todos\n", n)
+	return 0
+}
+
+func writeBackup(ctx context.Context, w io.Writer, todos todoRepository, store settingsRepository, fields customFieldRepository) (int, error) {
+	s, err := store.Load(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defined, err := fields.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+	list, err := todos.List(ctx, listQuery{})
+	if err != nil {
+		return 0, err
+	}
+
+	zw := gzip.NewWriter(w)
+	bw := bufio.NewWriter(zw)
+	header, err := json.Marshal(backupHeader{Format: backupFormat, CreatedAt: time.Now().UTC(), Settings: s, CustomFields: defined})
+	if err != nil {
+		return 0, err
+	}
+	// Splice the todos array into the header object.
+	bw.Write(header[:len(header)-1])
+	bw.WriteString(`,"todos":[`)
+	enc := json.NewEncoder(bw)
+	for i, t := range parentsFirst(list) {
+		if i > 0 {
+			bw.WriteByte(',')
+		}
+		entry := backupTodo{todo: t.toTodo()}
+		for _, rel := range t.Related {
+			entry.Related = append(entry.Related, backupRelation{Type: rel.Type, ID: rel.ID.Hex()})
+		}
+		if err := enc.Encode(entry); err != nil {
+			return 0, err
+		}
+	}
+	bw.WriteString("]}\n")
+	if err := bw.Flush(); err != nil {
+		return 0, err
+	}
+	return len(list), zw.Close()
+}
+
+// restoreCommand loads a backup written by backupCommand. It refuses to
+// touch a database that already has todos unless -replace is given, in
+// which case they are deleted first.
+func restoreCommand(ctx context.Context, cfg config, args []string) int {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	in := fs.String("in", "", `file to read, or "-" for stdin`)
+	replace := fs.Bool("replace", false, "delete existing todos before restoring")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *in == "" {
+		fs.Usage()
+		return 2
+	}
+
+	todos, store, fields, closeFn, err := repositories(ctx, cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer closeFn()
+
+	var r io.Reader = os.Stdin
+	if *in != "-" {
+		f, err := os.Open(*in)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer f.Close()
+		r = f
+	}
+
+	existing, err := todos.List(ctx, listQuery{})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(existing) > 0 && !*replace {
+		fmt.Fprintf(os.Stderr, "database already has %d todos; use -replace to overwrite them\n", len(existing))
+		return 1
+	}
+	for _, t := range existing {
+		if err := todos.Delete(ctx, t.ID, nil); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	n, err := readBackup(ctx, cfg, r, todos, store, fields)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "restore failed after %d todos: %v\n", n, err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "restored %d todos\n", n)
+	return 0
+}
+
+func readBackup(ctx context.Context, cfg config, r io.Reader, todos todoRepository, store settingsRepository, fields customFieldRepository) (int, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return 0, err
+	}
+	defer zr.Close()
+	dec := json.NewDecoder(bufio.NewReader(zr))
+
+	if err := expectDelim(dec, '{'); err != nil {
+		return 0, err
+	}
+	var header backupHeader
+	n := 0
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return n, err
+		}
+		switch tok {
+		case "format":
+			if err := dec.Decode(&header.Format); err != nil {
+				return n, err
+			}
+			if header.Format != backupFormat {
+				return n, fmt.Errorf("unsupported backup format %d", header.Format)
+			}
+		case "settings":
+			header.Settings = defaultSettings(int(cfg.PageSize))
+			if err := dec.Decode(&header.Settings); err != nil {
+				return n, err
+			}
+			if key := header.Settings.validate(int(cfg.MaxPageSize)); key != "" {
+				return n, fmt.Errorf("invalid settings in backup: %s", key)
+			}
+			if err := store.Save(ctx, header.Settings); err != nil {
+				return n, err
+			}
+		case "custom_fields":
+			if err := dec.Decode(&header.CustomFields); err != nil {
+				return n, err
+			}
+			for _, f := range header.CustomFields {
+				if key := f.normalize(); key != "" || !customKeyPattern.MatchString(f.Key) {
+					return n, fmt.Errorf("invalid custom field %q in backup: %s", f.Key, key)
+				}
+				if err := fields.Save(ctx, f); err != nil {
+					return n, err
+				}
+			}
+		case "todos":
+			if header.Format == 0 {
+				return n, errors.New("backup header is missing its format")
+			}
+			list, err := fields.List(ctx)
+			if err != nil {
+				return n, err
+			}
+			defined := make(map[string]customField, len(list))
+			for _, f := range list {
+				defined[f.Key] = f
+			}
+			if err := expectDelim(dec, '['); err != nil {
+				return n, err
+			}
+			// Subtasks are created after their parent. Backups list
+			// parents first, so waiting only fills up for files
+			// written otherwise.
+			created := map[primitive.ObjectID]bool{}
+			waiting := map[primitive.ObjectID][]todoModel{}
+			var create func(tm todoModel) error
+			create = func(tm todoModel) error {
+				if err := todos.Create(ctx, tm); err != nil {
+					return err
+				}
+				created[tm.ID] = true
+				n++
+				children := waiting[tm.ID]
+				delete(waiting, tm.ID)
+				for _, c := range children {
+					if err := create(c); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+			for dec.More() {
+				var t backupTodo
+				if err := dec.Decode(&t); err != nil {
+					return n, err
+				}
+				tm, err := restoredTodo(t, defined)
+				if err != nil {
+					return n, err
+				}
+				if tm.ParentID != nil && !created[*tm.ParentID] {
+					waiting[*tm.ParentID] = append(waiting[*tm.ParentID], tm)
+					continue
+				}
+				if err := create(tm); err != nil {
+					return n, err
+				}
+			}
+			if err := expectDelim(dec, ']'); err != nil {
+				return n, err
+			}
+			// Parents missing from the backup leave their subtasks
+			// with nothing to point at, so they become top-level.
+			for parent, children := range waiting {
+				fmt.Fprintf(os.Stderr, "parent %s is missing from the backup; restoring its %d subtasks as top-level todos\n", parent.Hex(), len(children))
+				for _, c := range children {
+					c.ParentID = nil
+					if err := create(c); err != nil {
+						return n, err
+					}
+				}
+			}
+		default:
+			// Skip fields newer writers may add.
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, expectDelim(dec, '}')
+}
+
+// restoredTodo is the todo a backup entry describes. Custom values are
+// stored as the defined fields say; those of fields no longer defined
+// are kept as written.
+func restoredTodo(t backupTodo, defined map[string]customField) (todoModel, error) {
+	id, err := primitive.ObjectIDFromHex(t.ID)
+	if err != nil {
+		return todoModel{}, fmt.Errorf("todo %q: %w", t.ID, err)
+	}
+	tm := todoModel{ID: id, Title: t.Title, Completed: t.Completed, CreatedAt: t.CreatedAt, StartDate: t.StartDate, DueDate: t.DueDate, Tags: t.Tags, Priority: priorityLevel(t.Priority)}
+	if t.Completed {
+		tm.CompletedAt = t.CompletedAt
+	}
+	if t.ParentID != "" {
+		parent, err := primitive.ObjectIDFromHex(t.ParentID)
+		if err != nil {
+			return todoModel{}, fmt.Errorf("todo %q: parent_id: %w", t.ID, err)
+		}
+		tm.ParentID = &parent
+	}
+	if t.ColumnID != "" {
+		column, err := primitive.ObjectIDFromHex(t.ColumnID)
+		if err != nil {
+			return todoModel{}, fmt.Errorf("todo %q: column_id: %w", t.ID, err)
+		}
+		tm.ColumnID = &column
+		if t.Position != nil {
+			tm.Position = *t.Position
+		}
+	}
+	for _, hex := range t.BlockedBy {
+		blocker, err := primitive.ObjectIDFromHex(hex)
+		if err != nil {
+			return todoModel{}, fmt.Errorf("todo %q: blocked_by: %w", t.ID, err)
+		}
+		tm.BlockedBy = append(tm.BlockedBy, blocker)
+	}
+	for key, v := range t.Custom {
+		if f, ok := defined[key]; ok {
+			if v, ok = f.value(v); !ok {
+				return todoModel{}, fmt.Errorf("todo %q: custom.%s doesn't fit its %s field", t.ID, key, f.Type)
+			}
+		}
+		if v == nil {
+			continue
+		}
+		if tm.Custom == nil {
+			tm.Custom = map[string]interface{}{}
+		}
+		tm.Custom[key] = v
+	}
+	tm.Location, tm.LocationLabel = t.Location.stored()
+	tm.Notes = t.Notes
+	for _, rel := range t.Related {
+		other, err := primitive.ObjectIDFromHex(rel.ID)
+		if err != nil {
+			return todoModel{}, fmt.Errorf("todo %q: related: %w", t.ID, err)
+		}
+		if !slices.Contains(relationTypes, rel.Type) {
+			return todoModel{}, fmt.Errorf("todo %q: unknown link type %q", t.ID, rel.Type)
+		}
+		tm.Related = append(tm.Related, todoRelation{Type: rel.Type, ID: other})
+	}
+	return tm, nil
+}
+
+// parentsFirst orders todos so every subtask comes after its parent,
+// keeping their order otherwise.
+func parentsFirst(todos []todoModel) []todoModel {
+	children := map[primitive.ObjectID][]todoModel{}
+	listed := make(map[primitive.ObjectID]bool, len(todos))
+	for _, t := range todos {
+		listed[t.ID] = true
+	}
+	var roots []todoModel
+	for _, t := range todos {
+		if t.ParentID != nil && listed[*t.ParentID] {
+			children[*t.ParentID] = append(children[*t.ParentID], t)
+		} else {
+			roots = append(roots, t)
+		}
+	}
+	out := make([]todoModel, 0, len(todos))
+	var add func(t todoModel)
+	add = func(t todoModel) {
+		out = append(out, t)
+		for _, c := range children[t.ID] {
+			add(c)
+		}
+	}
+	for _, t := range roots {
+		add(t)
+	}
+	return out
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != want {
+		return fmt.Errorf("malformed backup: expected %q, got %v", want, tok)
+	}
+	return nil
+}
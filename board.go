@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"todo/internal/render"
+)
+
+const columnsCollection string = "columns"
+
+// column is one list of the kanban board, in Position order.
+type column struct {
+	ID       primitive.ObjectID `bson:"_id" json:"id"`
+	Name     string             `bson:"name" json:"name"`
+	Position int                `bson:"position" json:"position"`
+}
+
+// columnRequest is the body of a column create or update. A missing
+// position leaves the column where it is, or appends a new one.
+type columnRequest struct {
+	Name     string `json:"name"`
+	Position *int   `json:"position"`
+}
+
+// moveRequest places a todo; a missing position appends it.
+type moveRequest struct {
+	ColumnID string `json:"column_id"`
+	Position *int   `json:"position"`
+}
+
+func (a *app) boardHandlers() http.Handler {
+	rg := chi.NewRouter()
+	rg.Group(func(r chi.Router) {
+		r.Get("/", a.fetchBoard)
+		r.Get("/columns", a.fetchColumns)
+		r.Post("/columns", a.createColumn)
+		r.Put("/columns/{id}", a.updateColumn)
+		r.Delete("/columns/{id}", a.deleteColumn)
+	})
+	return rg
+}
+
+// fetchBoard serves every column with its todos in order.
+func (a *app) fetchBoard(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	columns, err := a.board.Columns(ctx)
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "board.fetch_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	todos, err := a.todos.List(ctx, listQuery{OnBoard: true, Sort: []sortKey{{Field: "position"}}})
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "board.fetch_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	base := siblingTodoBase(r, "board")
+	byColumn := map[primitive.ObjectID][]todo{}
+	for _, tm := range todos {
+		t := tm.toTodo()
+		t.Links = todoLinks(base, t.ID)
+		byColumn[*tm.ColumnID] = append(byColumn[*tm.ColumnID], t)
+	}
+	out := make([]render.M, len(columns))
+	for i, c := range columns {
+		items := byColumn[c.ID]
+		if items == nil {
+			items = []todo{}
+		}
+		out[i] = render.M{"id": c.ID, "name": c.Name, "position": c.Position, "todos": items}
+	}
+	a.rnd.JSON(w, http.StatusOK, render.M{"data": out})
+}
+
+func (a *app) fetchColumns(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	columns, err := a.board.Columns(ctx)
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "board.fetch_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	a.rnd.JSON(w, http.StatusOK, render.M{"data": columns})
+}
+
+func (a *app) createColumn(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	req, ok := a.decodeColumn(w, r)
+	if !ok {
+		return
+	}
+	c, err := a.board.CreateColumn(ctx, req.Name)
+	if err == nil && req.Position != nil {
+		c, err = a.board.UpdateColumn(ctx, c.ID, c.Name, *req.Position)
+	}
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "board.column_save_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	a.rnd.JSON(w, http.StatusCreated, render.M{"data": c})
+}
+
+func (a *app) updateColumn(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	id, ok := a.columnID(w, r)
+	if !ok {
+		return
+	}
+	req, ok := a.decodeColumn(w, r)
+	if !ok {
+		return
+	}
+	position := -1
+	if req.Position != nil {
+		position = *req.Position
+	}
+	if position < 0 {
+		// Keep the column where it is.
+		columns, err := a.board.Columns(ctx)
+		if err != nil {
+			a.fail(w, r, err, "board.column_save_failed")
+			return
+		}
+		position = math.MaxInt
+		for _, c := range columns {
+			if c.ID == id {
+				position = c.Position
+			}
+		}
+	}
+	c, err := a.board.UpdateColumn(ctx, id, req.Name, position)
+	if err != nil {
+		a.fail(w, r, err, "board.column_save_failed")
+		return
+	}
+	a.rnd.JSON(w, http.StatusOK, render.M{"data": c})
+}
+
+func (a *app) deleteColumn(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	id, ok := a.columnID(w, r)
+	if !ok {
+		return
+	}
+	if err := a.board.DeleteColumn(ctx, id); err != nil {
+		a.fail(w, r, err, "board.column_save_failed")
+		return
+	}
+	a.rnd.JSON(w, http.StatusOK, render.M{"message": tr(r, "board.column_deleted")})
+}
+
+// moveTodo places a todo in a column, at the end unless a position is
+// given. The column's other todos shift to make room.
+func (a *app) moveTodo(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	id, ok := a.todoID(w, r)
+	if !ok {
+		return
+	}
+	var req moveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "request.invalid_body"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	columnID, err := primitive.ObjectIDFromHex(req.ColumnID)
+	if err != nil {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "board.column_id_invalid"),
+		})
+		return
+	}
+	position := math.MaxInt
+	if req.Position != nil {
+		position = *req.Position
+	}
+
+	tm, err := a.board.Move(ctx, id, columnID, position)
+	if errors.Is(err, errColumnNotFound) {
+		// The column named in the body, not the resource, is missing.
+		err = invalidError("board.column_not_found", err.Error())
+	}
+	if err != nil {
+		a.fail(w, r, err, "todo.move_failed")
+		return
+	}
+	t := tm.toTodo()
+	t.Links = todoLinks(todoBase(r), t.ID)
+	a.rnd.JSON(w, http.StatusOK, render.M{"data": t})
+}
+
+// columnID parses the {id} URL parameter, answering 400 itself when it
+// isn't an ObjectID.
+func (a *app) columnID(w http.ResponseWriter, r *http.Request) (primitive.ObjectID, bool) {
+	id, err := primitive.ObjectIDFromHex(strings.TrimSpace(chi.URLParam(r, "id")))
+	if err != nil {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "board.column_id_invalid"),
+		})
+		return id, false
+	}
+	return id, true
+}
+
+func (a *app) decodeColumn(w http.ResponseWriter, r *http.Request) (columnRequest, bool) {
+	var req columnRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "request.invalid_body"),
+			"error":   err.Error(),
+		})
+		return req, false
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "board.column_name_required"),
+		})
+		return req, false
+	}
+	return req, true
+}
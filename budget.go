@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// requestTimeoutHeader lets a client give a request less time than the
+// configured handler timeout, as a duration ("1.5s", "800ms") or a number
+// of seconds. It can't ask for more.
+const requestTimeoutHeader = "Request-Timeout"
+
+const (
+	// budgetReserve is the share of a request's remaining time that a
+	// downstream call leaves unspent, so when the call runs out the
+	// handler still has time to answer. maxBudgetReserve caps it on
+	// long deadlines.
+	budgetReserve    = 10 // percent
+	maxBudgetReserve = time.Second
+)
+
+// deadline bounds the total time a handler may spend on a request, by d
+// or the client's Request-Timeout if that is shorter. Zero d and no
+// header leave it unbounded.
+func deadline(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit := d
+			if asked, ok := requestTimeout(r); ok && (limit <= 0 || asked < limit) {
+				limit = asked
+			}
+			if limit <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), limit)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// requestTimeout reads the Request-Timeout header. Values that aren't a
+// positive duration are ignored rather than failing the request.
+func requestTimeout(r *http.Request) (time.Duration, bool) {
+	v := r.Header.Get(requestTimeoutHeader)
+	if v == "" {
+		return 0, false
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		secs, ferr := strconv.ParseFloat(v, 64)
+		if ferr != nil {
+			return 0, false
+		}
+		d = time.Duration(secs * float64(time.Second))
+	}
+	return d, d > 0
+}
+
+// budget is ctx for one downstream call (the database, a notification
+// channel): it ends after limit, when that is set, and in any case before
+// ctx does, by budgetReserve of the time ctx has left. A call that would
+// otherwise run to the request's own deadline gives up while there is
+// still time to say so.
+func budget(ctx context.Context, limit time.Duration) (context.Context, context.CancelFunc) {
+	end, ok := ctx.Deadline()
+	if ok {
+		left := max(time.Until(end), 0)
+		end = end.Add(-min(left*budgetReserve/100, maxBudgetReserve))
+	}
+	if limit > 0 && (!ok || time.Now().Add(limit).Before(end)) {
+		end, ok = time.Now().Add(limit), true
+	}
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadline(ctx, end)
+}
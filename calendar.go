@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"todo/internal/render"
+)
+
+// maxCalendarDays bounds a calendar request; a year covers any month or
+// week view with room to spare.
+const maxCalendarDays = 366
+
+// calendar serves open and completed todos due between ?from= and ?to=
+// (inclusive dates, YYYY-MM-DD), grouped by due day in the configured
+// timezone. Every day in the range is present, empty or not.
+func (a *app) calendar(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	s, err := a.settings.Load(ctx)
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "settings.fetch_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	loc := s.location()
+
+	q := r.URL.Query()
+	from, errFrom := time.ParseInLocation(time.DateOnly, q.Get("from"), loc)
+	to, errTo := time.ParseInLocation(time.DateOnly, q.Get("to"), loc)
+	if errFrom != nil || errTo != nil || to.Before(from) || !to.Before(from.AddDate(0, 0, maxCalendarDays)) {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "calendar.range_invalid", maxCalendarDays),
+		})
+		return
+	}
+	end := to.AddDate(0, 0, 1)
+
+	todos, err := a.todos.List(ctx, listQuery{
+		DueFrom: from,
+		DueTo:   end,
+		Sort:    []sortKey{{Field: "due_date"}},
+	})
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "todo.fetch_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	days := map[string][]todo{}
+	for d := from; d.Before(end); d = d.AddDate(0, 0, 1) {
+		days[d.Format(time.DateOnly)] = []todo{}
+	}
+	base := siblingTodoBase(r, "calendar")
+	for _, tm := range todos {
+		t := tm.toTodo()
+		t.Links = todoLinks(base, t.ID)
+		day := tm.DueDate.In(loc).Format(time.DateOnly)
+		days[day] = append(days[day], t)
+	}
+
+	a.rnd.JSON(w, http.StatusOK, render.M{
+		"data":     days,
+		"from":     from.Format(time.DateOnly),
+		"to":       to.Format(time.DateOnly),
+		"timezone": loc.String(),
+	})
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"todo/internal/render"
+)
+
+const (
+	tombstonesCollection = "tombstones"
+
+	// changeRetention is how long deletions are remembered. A token
+	// older than this can no longer be caught up from.
+	changeRetention = 30 * 24 * time.Hour
+	// changeSettle holds back the newest changes. Writers stamp changes
+	// with their own clock, so a write that lands a moment late with a
+	// slightly earlier time is still picked up by the next request.
+	changeSettle = 2 * time.Second
+
+	defaultChangeLimit = 100
+	maxChangeLimit     = 1000
+)
+
+// changeToken is a position in the change feed: everything changed before
+// At, or at At with an ID up to ID, has been seen.
+type changeToken struct {
+	At time.Time
+	ID primitive.ObjectID
+}
+
+// String encodes t as an opaque, URL-safe token.
+func (t changeToken) String() string {
+	raw := strconv.FormatInt(t.At.UnixMilli(), 10) + "." + t.ID.Hex()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func parseChangeToken(s string) (changeToken, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return changeToken{}, false
+	}
+	ms, hex, ok := strings.Cut(string(raw), ".")
+	if !ok {
+		return changeToken{}, false
+	}
+	n, err := strconv.ParseInt(ms, 10, 64)
+	if err != nil || n <= 0 {
+		return changeToken{}, false
+	}
+	id, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		return changeToken{}, false
+	}
+	return changeToken{At: time.UnixMilli(n), ID: id}, true
+}
+
+// todoChange is one entry in the change feed: the todo as it is now, or
+// only its ID when it was Deleted.
+type todoChange struct {
+	Todo    todoModel
+	At      time.Time
+	Deleted bool
+}
+
+// change is a todoChange as clients see it.
+type change struct {
+	Action string    `json:"action"`
+	ID     string    `json:"id"`
+	At     time.Time `json:"at"`
+	Data   *todo     `json:"data,omitempty"`
+}
+
+// changes serves what changed after ?since=, oldest first, and the token
+// to pass next time. Without since it lists every todo, so a client can
+// start from nothing. A todo created after since is "created"; any other
+// change is "updated" and carries the whole todo, so clients can upsert
+// both the same way.
+func (a *app) changes(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	since, ok := a.parseSince(w, r, r.URL.Query().Get("since"))
+	if !ok {
+		return
+	}
+	limit := int64(defaultChangeLimit)
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 1 || n > maxChangeLimit {
+			a.rnd.JSON(w, http.StatusBadRequest, render.M{
+				"message": tr(r, "changes.limit_invalid", maxChangeLimit),
+			})
+			return
+		}
+		limit = n
+	}
+
+	out, next, more, err := a.collectChanges(ctx, siblingTodoBase(r, "changes"), since, limit)
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "todo.fetch_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	a.rnd.JSON(w, http.StatusOK, render.M{
+		"data":     out,
+		"next":     next.String(),
+		"has_more": more,
+	})
+}
+
+// collectChanges reads up to limit changes after since and works out the
+// token that follows them. base is the todo collection path for links.
+func (a *app) collectChanges(ctx context.Context, base string, since changeToken, limit int64) ([]change, changeToken, bool, error) {
+	until := time.Now().Add(-changeSettle)
+	found, err := a.todos.Changes(ctx, since, until, limit+1)
+	if err != nil {
+		return nil, since, false, err
+	}
+	more := int64(len(found)) > limit
+	if more {
+		found = found[:limit]
+	}
+
+	out := make([]change, len(found))
+	next := since
+	for i, c := range found {
+		out[i] = change{Action: "updated", ID: c.Todo.ID.Hex(), At: c.At}
+		switch {
+		case c.Deleted:
+			out[i].Action = "deleted"
+		case since.At.IsZero() || c.Todo.CreatedAt.After(since.At):
+			out[i].Action = "created"
+		}
+		if !c.Deleted {
+			t := c.Todo.toTodo()
+			t.Links = todoLinks(base, t.ID)
+			out[i].Data = &t
+		}
+		next = changeToken{At: c.At, ID: c.Todo.ID}
+	}
+	if caughtUp := until.Truncate(time.Millisecond); !more && next.At.Before(caughtUp) {
+		// Nothing else is stored before caughtUp, so start there next
+		// time rather than rescanning.
+		next = changeToken{At: caughtUp}
+	}
+	return out, next, more, nil
+}
+
+// parseSince reads a sync token, answering 400 when it is malformed and
+// 410 when it is too old to catch up from. An empty token is the zero
+// token.
+func (a *app) parseSince(w http.ResponseWriter, r *http.Request, v string) (changeToken, bool) {
+	if v == "" {
+		return changeToken{}, true
+	}
+	since, ok := parseChangeToken(v)
+	if !ok {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "changes.token_invalid"),
+		})
+		return since, false
+	}
+	if time.Since(since.At) > changeRetention {
+		a.rnd.JSON(w, http.StatusGone, render.M{
+			"message": tr(r, "changes.token_expired"),
+		})
+		return since, false
+	}
+	return since, true
+}
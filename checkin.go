@@ -0,0 +1,142 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"todo/internal/notify"
+	"todo/internal/render"
+)
+
+const (
+	defaultNearbyReminderRadius = 200.0
+	// nearbyCooldown is how long a todo stays quiet after a nearby
+	// reminder, however often the client checks in around it.
+	nearbyCooldown = 12 * time.Hour
+)
+
+// cooldown remembers when each todo was last announced. Like the
+// dispatcher it lives in memory: a restart forgets it, and each replica
+// keeps its own.
+type cooldown struct {
+	mu   sync.Mutex
+	sent map[primitive.ObjectID]time.Time
+}
+
+// claim reports whether id may be announced at now, and if so records
+// that it was.
+func (c *cooldown) claim(id primitive.ObjectID, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sent == nil {
+		c.sent = map[primitive.ObjectID]time.Time{}
+	}
+	for k, at := range c.sent {
+		if now.Sub(at) >= nearbyCooldown {
+			delete(c.sent, k)
+		}
+	}
+	if _, ok := c.sent[id]; ok {
+		return false
+	}
+	c.sent[id] = now
+	return true
+}
+
+// checkIn takes the client's position in {"lat": ..., "lng": ...} and
+// sends a nearby reminder for each open todo located within the
+// notification settings' nearby_radius of it. It answers with those todos
+// and how many reminders went out; the sends finish in the background.
+func (a *app) checkIn(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	var req struct {
+		Lat *float64 `json:"lat"`
+		Lng *float64 `json:"lng"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "request.invalid_body"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	if req.Lat == nil || req.Lng == nil || !validLat(*req.Lat) || !validLng(*req.Lng) {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "nearby.position_invalid"),
+		})
+		return
+	}
+
+	n, err := a.notifications.Load(ctx)
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "notify.fetch_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	s, err := a.settings.Load(ctx)
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "settings.fetch_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	here := newGeoPoint(*req.Lat, *req.Lng)
+	todos, err := a.todos.List(ctx, listQuery{Open: true, Within: &geoCircle{Center: *here, Radius: n.nearbyRadius()}})
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "todo.fetch_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	base := todoBase(r)
+	now := time.Now().In(s.location())
+	channels := n.subscribed(notifyNearby)
+	rule := n.Rules[notifyNearby]
+	l := a.messages.Localizer(n.Language)
+	out := make([]nearbyTodo, 0, len(todos))
+	var messages []notify.Message
+	for _, tm := range todos {
+		t := tm.toTodo()
+		t.Links = todoLinks(base, t.ID)
+		d := here.distance(*tm.Location)
+		out = append(out, nearbyTodo{todo: t, Distance: math.Round(d)})
+		if len(channels) == 0 || !rule.allows(tm, now) || !a.nearby.claim(tm.ID, now) {
+			continue
+		}
+		place := tm.LocationLabel
+		if place == "" {
+			place = tm.Title
+		}
+		messages = append(messages, notify.Message{
+			Event:   notifyNearby,
+			Subject: l.T("notify.nearby_subject", tm.Title),
+			Body:    l.T("notify.nearby_body", int(d), place),
+			Time:    now.UTC(),
+		})
+	}
+	slices.SortStableFunc(out, func(x, y nearbyTodo) int { return cmp.Compare(x.Distance, y.Distance) })
+	for _, m := range messages {
+		if err := queueNotifications(ctx, a.queue, channels, m); err != nil {
+			log.Printf("notify: queueing %s failed: %v", notifyNearby, err)
+		}
+	}
+	a.rnd.JSON(w, http.StatusOK, render.M{
+		"data":     out,
+		"notified": len(messages),
+	})
+}
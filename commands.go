@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"todo/internal/events"
+	"todo/internal/migrations"
+)
+
+// commands are the subcommands main accepts in place of serving. Each gets
+// its own arguments and returns the process exit code.
+var commands = map[string]func(ctx context.Context, cfg config, args []string) int{
+	"backup":         backupCommand,
+	"migrate":        migrateCommand,
+	"restore":        restoreCommand,
+	"seed":           seedCommand,
+	"verify-webhook": verifyWebhookCommand,
+}
+
+// runCommand runs the subcommand named by args[0].
+func runCommand(args []string) int {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	cfg, err := loadConfig(ctx)
+	cancel()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid configuration:", err)
+		return 1
+	}
+	return cmd(context.Background(), cfg, args[1:])
+}
+
+// openDatabase connects and waits for the first ping, unlike the server,
+// which starts serving before the database is up.
+func openDatabase(ctx context.Context, cfg config) (*mongo.Client, error) {
+	opts, err := mongoClientOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	client, err := mongo.Connect(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	pctx, cancel := context.WithTimeout(ctx, cfg.ConnectRetry)
+	defer cancel()
+	if err := client.Ping(pctx, nil); err != nil {
+		client.Disconnect(ctx)
+		return nil, err
+	}
+	return client, nil
+}
+
+func migrateCommand(ctx context.Context, cfg config, args []string) int {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: todo migrate [up [version] | down version | status]")
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	action, rest := "up", fs.Args()
+	if len(rest) > 0 {
+		action, rest = rest[0], rest[1:]
+	}
+	target := 0
+	if len(rest) > 0 {
+		n, err := strconv.Atoi(rest[0])
+		if err != nil || n < 0 {
+			fs.Usage()
+			return 2
+		}
+		target = n
+	} else if action == "down" {
+		// Rolling back everything by accident is too easy otherwise.
+		fs.Usage()
+		return 2
+	}
+
+	client, err := openDatabase(ctx, cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to connect to MongoDB:", err)
+		return 1
+	}
+	defer client.Disconnect(context.Background())
+
+	m, err := migrations.New(client.Database(dbName), schemaMigrations)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	var done []int
+	switch action {
+	case "up":
+		done, err = m.Up(ctx, target)
+	case "down":
+		done, err = m.Down(ctx, target)
+	case "status":
+		var status []migrations.Status
+		if status, err = m.Status(ctx); err == nil {
+			tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED")
+			for _, s := range status {
+				applied := "pending"
+				if s.AppliedAt != nil {
+					applied = s.AppliedAt.Format(time.RFC3339)
+				}
+				fmt.Fprintf(tw, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+			}
+			tw.Flush()
+		}
+	default:
+		fs.Usage()
+		return 2
+	}
+	for _, v := range done {
+		fmt.Printf("%s %d\n", action, v)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// verifyWebhookCommand checks a webhook delivery read from stdin against
+// its X-Todo-Signature value, with the same check receivers should make.
+func verifyWebhookCommand(ctx context.Context, cfg config, args []string) int {
+	fs := flag.NewFlagSet("verify-webhook", flag.ContinueOnError)
+	signature := fs.String("signature", "", "the "+events.SignatureHeader+" header value")
+	tolerance := fs.Duration("tolerance", 5*time.Minute, "how old a signature may be")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: todo verify-webhook -signature 't=...,v1=...' < body")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *signature == "" {
+		fs.Usage()
+		return 2
+	}
+	if cfg.EventWebhookSecret == "" {
+		fmt.Fprintln(os.Stderr, "EVENT_WEBHOOK_SECRET is not set")
+		return 1
+	}
+
+	body, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := events.Verify([]byte(cfg.EventWebhookSecret), *signature, body, time.Now(), *tolerance); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println("signature ok")
+	return 0
+}
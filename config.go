@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"todo/internal/notify"
+	"todo/internal/ratelimit"
+	"todo/internal/secrets"
+)
+
+const (
+	hostName       string = "MONGODB_URI"
+	dbName         string = "todo"
+	collectionName string = "todo"
+	port           string = ":9000"
+)
+
+// config is everything main needs to wire the app together. It is read
+// once at startup; secrets may be references resolved through
+// internal/secrets.
+type config struct {
+	Addr          string
+	AdminAddr     string
+	ReusePort     bool
+	H2C           bool
+	MongoURI      string
+	ConnectRetry  time.Duration
+	DevMode       bool
+	SPADir        string
+	EncryptionKey string
+	Quotas        map[string]int64
+	// DetectDuplicates makes creating a todo that matches an open one
+	// answer 409 unless the client allows it.
+	DetectDuplicates bool
+
+	// APIKeys are keyed by the SHA-256 of the key. RateTiers always has
+	// "unlimited"; every key's tier is checked to exist.
+	APIKeys    map[[sha256.Size]byte]apiKey
+	RateTiers  map[string]ratelimit.Limit
+	TrustProxy bool
+	CSRFSecret string
+
+	AccessLog       string
+	AccessLogSample float64
+	SentryDSN       string
+	Maintenance     string
+
+	// Connection pool and routing knobs. Zero values leave whatever the
+	// URI (or the driver default) says.
+	MongoMaxPoolSize     uint64
+	MongoMinPoolSize     uint64
+	MongoMaxConnecting   uint64
+	MongoServerSelection time.Duration
+	MongoReadPreference  string
+	MongoWriteConcern    string
+	// MongoRetryAttempts bounds how often a read or transaction is tried
+	// on transient errors. After MongoBreakerThreshold transient failures
+	// in a row, database calls fail fast for MongoBreakerCooldown; a zero
+	// threshold never trips.
+	MongoRetryAttempts    uint64
+	MongoBreakerThreshold uint64
+	MongoBreakerCooldown  time.Duration
+	// MongoSlowQuery is how long a database command may take before it
+	// is logged and counted as slow; zero turns that off.
+	MongoSlowQuery time.Duration
+	// PageSize is how many todos a page holds until the items-per-page
+	// setting is saved. MaxPageSize caps what a client or the setting
+	// may ask for, and how many todos an unpaged list buffers.
+	PageSize    uint64
+	MaxPageSize uint64
+	// StaleCacheMB is the memory for todo responses served, marked
+	// stale, while the database is down.
+	StaleCacheMB uint64
+
+	DBTimeout        time.Duration
+	HandlerTimeout   time.Duration
+	HTTPReadTimeout  time.Duration
+	HTTPWriteTimeout time.Duration
+	HTTPIdleTimeout  time.Duration
+	ShutdownGrace    time.Duration
+
+	// Outgoing events. The outbox is only written when at least one sink
+	// is configured.
+	EventSource        string
+	EventWebhookURL    string
+	EventWebhookSecret string
+	NATSURL            string
+	NATSSubject        string
+	KafkaBrokers       []string
+	KafkaTopic         string
+	MQTTURL            string
+	MQTTTopic          string
+	OutboxPoll         time.Duration
+	OutboxMaxAttempts  uint64
+
+	// The job queue: how many workers each process runs, how often idle
+	// ones look for work, and how often a job is tried before it is
+	// dead-lettered.
+	QueueWorkers     uint64
+	QueuePoll        time.Duration
+	QueueMaxAttempts uint64
+
+	// Notifications. Email channels send through SMTP; reminders go out
+	// ReminderLead before a todo is due.
+	SMTP         notify.SMTP
+	ReminderLead time.Duration
+}
+
+func loadConfig(ctx context.Context) (config, error) {
+	cfg := config{
+		Addr:         port,
+		ConnectRetry: 2 * time.Minute,
+		AdminAddr:    os.Getenv("ADMIN_ADDR"),
+		TrustProxy:   os.Getenv("TRUST_PROXY") == "true",
+		ReusePort:    os.Getenv("REUSE_PORT") == "true",
+		H2C:          os.Getenv("HTTP2_CLEARTEXT") == "true",
+		DevMode:      os.Getenv("APP_ENV") == "development",
+		SPADir:       os.Getenv("SPA_DIR"),
+
+		DetectDuplicates: os.Getenv("DETECT_DUPLICATES") == "true",
+
+		AccessLog:       os.Getenv("ACCESS_LOG"),
+		AccessLogSample: 1,
+		Maintenance:     envOr("MAINTENANCE_MODE", maintenanceOff),
+
+		MongoReadPreference: os.Getenv("MONGO_READ_PREFERENCE"),
+		MongoWriteConcern:   os.Getenv("MONGO_WRITE_CONCERN"),
+
+		MongoRetryAttempts:    3,
+		MongoBreakerThreshold: 5,
+		MongoBreakerCooldown:  10 * time.Second,
+		MongoSlowQuery:        100 * time.Millisecond,
+		StaleCacheMB:          16,
+		PageSize:              50,
+		MaxPageSize:           500,
+
+		DBTimeout:        10 * time.Second,
+		HandlerTimeout:   30 * time.Second,
+		HTTPReadTimeout:  60 * time.Second,
+		HTTPWriteTimeout: 60 * time.Second,
+		HTTPIdleTimeout:  60 * time.Second,
+		ShutdownGrace:    5 * time.Second,
+
+		EventSource:       envOr("EVENT_SOURCE", "/todo"),
+		NATSSubject:       envOr("NATS_SUBJECT", "events"),
+		KafkaTopic:        envOr("KAFKA_TOPIC", "todo-events"),
+		MQTTTopic:         envOr("MQTT_TOPIC", "todo/events"),
+		OutboxPoll:        time.Second,
+		OutboxMaxAttempts: 10,
+
+		QueueWorkers:     4,
+		QueuePoll:        time.Second,
+		QueueMaxAttempts: 8,
+
+		SMTP: notify.SMTP{
+			Addr:     os.Getenv("SMTP_ADDR"),
+			From:     os.Getenv("SMTP_FROM"),
+			Username: os.Getenv("SMTP_USERNAME"),
+		},
+		ReminderLead: time.Hour,
+	}
+
+	resolver := secrets.FromEnv()
+	var err error
+	if cfg.MongoURI, err = resolver.Getenv(ctx, hostName, "mongodb://localhost:27017"); err != nil {
+		return cfg, fmt.Errorf("%s: %w", hostName, err)
+	}
+	if cfg.EncryptionKey, err = resolver.Getenv(ctx, "ENCRYPTION_KEY", ""); err != nil {
+		return cfg, fmt.Errorf("ENCRYPTION_KEY: %w", err)
+	}
+	if cfg.EventWebhookURL, err = resolver.Getenv(ctx, "EVENT_WEBHOOK_URL", ""); err != nil {
+		return cfg, fmt.Errorf("EVENT_WEBHOOK_URL: %w", err)
+	}
+	if cfg.EventWebhookSecret, err = resolver.Getenv(ctx, "EVENT_WEBHOOK_SECRET", ""); err != nil {
+		return cfg, fmt.Errorf("EVENT_WEBHOOK_SECRET: %w", err)
+	}
+	if cfg.SentryDSN, err = resolver.Getenv(ctx, "SENTRY_DSN", ""); err != nil {
+		return cfg, fmt.Errorf("SENTRY_DSN: %w", err)
+	}
+	if cfg.SMTP.Password, err = resolver.Getenv(ctx, "SMTP_PASSWORD", ""); err != nil {
+		return cfg, fmt.Errorf("SMTP_PASSWORD: %w", err)
+	}
+	if cfg.NATSURL, err = resolver.Getenv(ctx, "NATS_URL", ""); err != nil {
+		return cfg, fmt.Errorf("NATS_URL: %w", err)
+	}
+	if cfg.MQTTURL, err = resolver.Getenv(ctx, "MQTT_URL", ""); err != nil {
+		return cfg, fmt.Errorf("MQTT_URL: %w", err)
+	}
+	for _, b := range strings.Split(os.Getenv("KAFKA_BROKERS"), ",") {
+		if b = strings.TrimSpace(b); b != "" {
+			cfg.KafkaBrokers = append(cfg.KafkaBrokers, b)
+		}
+	}
+
+	for env, d := range map[string]*time.Duration{
+		"DB_CONNECT_RETRY_PERIOD": &cfg.ConnectRetry,
+		"DB_OPERATION_TIMEOUT":    &cfg.DBTimeout,
+		"HANDLER_TIMEOUT":         &cfg.HandlerTimeout,
+		"HTTP_READ_TIMEOUT":       &cfg.HTTPReadTimeout,
+		"HTTP_WRITE_TIMEOUT":      &cfg.HTTPWriteTimeout,
+		"HTTP_IDLE_TIMEOUT":       &cfg.HTTPIdleTimeout,
+		"SHUTDOWN_GRACE_PERIOD":   &cfg.ShutdownGrace,
+		"OUTBOX_POLL_INTERVAL":    &cfg.OutboxPoll,
+		"QUEUE_POLL_INTERVAL":     &cfg.QueuePoll,
+		"REMINDER_LEAD":           &cfg.ReminderLead,
+
+		"MONGO_SERVER_SELECTION_TIMEOUT": &cfg.MongoServerSelection,
+		"MONGO_BREAKER_COOLDOWN":         &cfg.MongoBreakerCooldown,
+		"MONGO_SLOW_QUERY":               &cfg.MongoSlowQuery,
+	} {
+		if err := envDuration(env, d); err != nil {
+			return cfg, err
+		}
+	}
+	for env, n := range map[string]*uint64{
+		"MONGO_MAX_POOL_SIZE":  &cfg.MongoMaxPoolSize,
+		"MONGO_MIN_POOL_SIZE":  &cfg.MongoMinPoolSize,
+		"MONGO_MAX_CONNECTING": &cfg.MongoMaxConnecting,
+		"OUTBOX_MAX_ATTEMPTS":  &cfg.OutboxMaxAttempts,
+		"QUEUE_WORKERS":        &cfg.QueueWorkers,
+		"QUEUE_MAX_ATTEMPTS":   &cfg.QueueMaxAttempts,
+
+		"MONGO_RETRY_ATTEMPTS":    &cfg.MongoRetryAttempts,
+		"MONGO_BREAKER_THRESHOLD": &cfg.MongoBreakerThreshold,
+		"STALE_CACHE_MB":          &cfg.StaleCacheMB,
+		"PAGE_SIZE":               &cfg.PageSize,
+		"MAX_PAGE_SIZE":           &cfg.MaxPageSize,
+	} {
+		if err := envUint(env, n); err != nil {
+			return cfg, err
+		}
+	}
+	if cfg.OutboxPoll == 0 || cfg.OutboxMaxAttempts == 0 {
+		return cfg, fmt.Errorf("OUTBOX_POLL_INTERVAL and OUTBOX_MAX_ATTEMPTS must be positive")
+	}
+	if cfg.QueueWorkers == 0 || cfg.QueuePoll == 0 || cfg.QueueMaxAttempts == 0 {
+		return cfg, fmt.Errorf("QUEUE_WORKERS, QUEUE_POLL_INTERVAL and QUEUE_MAX_ATTEMPTS must be positive")
+	}
+	if cfg.MongoRetryAttempts == 0 {
+		return cfg, fmt.Errorf("MONGO_RETRY_ATTEMPTS must be positive")
+	}
+	if cfg.PageSize == 0 || cfg.PageSize > cfg.MaxPageSize {
+		return cfg, fmt.Errorf("PAGE_SIZE must be between 1 and MAX_PAGE_SIZE (%d), got %d", cfg.MaxPageSize, cfg.PageSize)
+	}
+	if v := os.Getenv("ACCESS_LOG_SAMPLE_RATE"); v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return cfg, fmt.Errorf("ACCESS_LOG_SAMPLE_RATE must be between 0 and 1, got %q", v)
+		}
+		cfg.AccessLogSample = rate
+	}
+	if !validMaintenanceMode(cfg.Maintenance) {
+		return cfg, fmt.Errorf("MAINTENANCE_MODE must be off, read_only or down, got %q", cfg.Maintenance)
+	}
+	if _, err := mongoClientOptions(cfg); err != nil {
+		return cfg, err
+	}
+
+	if cfg.Quotas, err = loadQuotaLimits(); err != nil {
+		return cfg, err
+	}
+
+	keys, err := resolver.Getenv(ctx, "API_KEYS", "")
+	if err != nil {
+		return cfg, fmt.Errorf("API_KEYS: %w", err)
+	}
+	if cfg.CSRFSecret, err = resolver.Getenv(ctx, "CSRF_SECRET", ""); err != nil {
+		return cfg, fmt.Errorf("CSRF_SECRET: %w", err)
+	}
+	if cfg.APIKeys, err = parseAPIKeys(keys); err != nil {
+		return cfg, err
+	}
+	if cfg.RateTiers, err = parseRateTiers(os.Getenv("RATE_LIMIT_TIERS")); err != nil {
+		return cfg, err
+	}
+	for _, k := range cfg.APIKeys {
+		if _, ok := cfg.RateTiers[k.Tier]; !ok {
+			return cfg, fmt.Errorf("API key %q uses tier %q, which RATE_LIMIT_TIERS doesn't define", k.Name, k.Tier)
+		}
+	}
+	return cfg, nil
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// envDuration overwrites *d with the environment variable key when set.
+func envDuration(key string, d *time.Duration) error {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	parsed, err := time.ParseDuration(v)
+	if err != nil || parsed < 0 {
+		return fmt.Errorf("%s must be a non-negative duration such as 30s, got %q", key, v)
+	}
+	*d = parsed
+	return nil
+}
+
+// envUint overwrites *n with the environment variable key when set.
+func envUint(key string, n *uint64) error {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	parsed, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%s must be a non-negative integer, got %q", key, v)
+	}
+	*n = parsed
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"todo/internal/render"
+)
+
+type (
+	// dueBounds are the instants splitting open todos into due buckets:
+	// before Today is overdue, then today, the rest of the week up to
+	// NextWeek, and later.
+	dueBounds struct {
+		Today    time.Time
+		Tomorrow time.Time
+		NextWeek time.Time
+	}
+	dueCounts struct {
+		Overdue  int64 `json:"overdue"`
+		Today    int64 `json:"today"`
+		ThisWeek int64 `json:"this_week"`
+		Later    int64 `json:"later"`
+		None     int64 `json:"none"`
+	}
+	todoCounts struct {
+		Total  int64 `json:"total"`
+		Status struct {
+			Open      int64 `json:"open"`
+			Completed int64 `json:"completed"`
+		} `json:"status"`
+		Due  dueCounts        `json:"due"`
+		Tags map[string]int64 `json:"tags"`
+	}
+)
+
+// boundsAt is the due buckets for now in loc. Weeks start on Monday.
+func boundsAt(now time.Time, loc *time.Location) dueBounds {
+	today := startOfDay(now.In(loc))
+	untilMonday := (8 - int(today.Weekday())) % 7
+	if untilMonday == 0 {
+		untilMonday = 7
+	}
+	return dueBounds{
+		Today:    today,
+		Tomorrow: today.AddDate(0, 0, 1),
+		NextWeek: today.AddDate(0, 0, untilMonday),
+	}
+}
+
+func (c *dueCounts) add(bucket string, n int64) {
+	switch bucket {
+	case "overdue":
+		c.Overdue += n
+	case "today":
+		c.Today += n
+	case "this_week":
+		c.ThisWeek += n
+	case "later":
+		c.Later += n
+	default:
+		c.None += n
+	}
+}
+
+// countTodos serves dashboard counts from one aggregation, with due
+// days taken in the configured timezone.
+func (a *app) countTodos(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	s, err := a.settings.Load(ctx)
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "settings.fetch_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	c, err := a.todos.Counts(ctx, boundsAt(time.Now(), s.location()))
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "todo.count_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	a.rnd.JSON(w, http.StatusOK, render.M{"data": c})
+}
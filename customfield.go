@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"todo/internal/render"
+)
+
+const (
+	customFieldsCollection = "custom_fields"
+
+	maxCustomFields    = 50
+	maxCustomText      = 1000
+	maxCustomOptions   = 100
+	customFilterPrefix = "custom."
+)
+
+// The types a custom field can have.
+const (
+	customText   = "text"
+	customNumber = "number"
+	customDate   = "date"
+	customSelect = "select"
+)
+
+var (
+	customTypes = []string{customText, customNumber, customDate, customSelect}
+
+	customKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+)
+
+// customField is an extra property todos may carry, defined once for
+// the instance. Key names it in a todo's "custom" object, in
+// ?custom.<key>= filters and in ?sort=custom.<key>. Values are stored in
+// the clear, like tags, so they can be filtered and sorted.
+type customField struct {
+	Key  string `bson:"_id" json:"key"`
+	Name string `bson:"name" json:"name"`
+	Type string `bson:"type" json:"type"`
+	// Options are the values a select field allows.
+	Options []string `bson:"options,omitempty" json:"options,omitempty"`
+}
+
+// normalize trims f and returns the message key describing the first
+// invalid field.
+func (f *customField) normalize() string {
+	f.Name = strings.TrimSpace(f.Name)
+	if f.Name == "" {
+		return "custom_field.name_required"
+	}
+	if !slices.Contains(customTypes, f.Type) {
+		return "custom_field.type_invalid"
+	}
+	if f.Type != customSelect {
+		f.Options = nil
+		return ""
+	}
+	seen := map[string]bool{}
+	options := f.Options[:0]
+	for _, o := range f.Options {
+		if o = strings.TrimSpace(o); o != "" && !seen[o] {
+			seen[o] = true
+			options = append(options, o)
+		}
+	}
+	f.Options = options
+	if len(f.Options) == 0 || len(f.Options) > maxCustomOptions {
+		return "custom_field.options_invalid"
+	}
+	return ""
+}
+
+// value converts v, as decoded from a JSON body, to what is stored. ok
+// is false when v doesn't fit the field. A nil result clears the value.
+func (f customField) value(v interface{}) (out interface{}, ok bool) {
+	if v == nil {
+		return nil, true
+	}
+	if f.Type == customNumber {
+		n, ok := v.(float64)
+		return n, ok
+	}
+	s, ok := v.(string)
+	if !ok {
+		return nil, false
+	}
+	return f.parse(s)
+}
+
+// parse converts the text form of a value, as a body's string or a query
+// parameter, to what is stored.
+func (f customField) parse(s string) (interface{}, bool) {
+	s = strings.TrimSpace(s)
+	switch f.Type {
+	case customText:
+		if s == "" {
+			return nil, true
+		}
+		return s, utf8.RuneCountInString(s) <= maxCustomText
+	case customNumber:
+		n, err := strconv.ParseFloat(s, 64)
+		return n, err == nil
+	case customDate:
+		d, err := time.Parse(time.DateOnly, s)
+		return d, err == nil
+	default:
+		return s, slices.Contains(f.Options, s)
+	}
+}
+
+// customValue is a stored value as clients see it: dates lose their
+// midnight time.
+func customValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case primitive.DateTime:
+		return v.Time().UTC().Format(time.DateOnly)
+	case time.Time:
+		return v.UTC().Format(time.DateOnly)
+	}
+	return v
+}
+
+// customValues checks a todo's custom values against the defined fields
+// and converts them for storage, answering 400 itself for an unknown key
+// or a value that doesn't fit.
+func (a *app) customValues(ctx context.Context, w http.ResponseWriter, r *http.Request, in map[string]interface{}) (map[string]interface{}, bool) {
+	if len(in) == 0 {
+		return nil, true
+	}
+	fields, ok := a.loadCustomFields(ctx, w, r)
+	if !ok {
+		return nil, false
+	}
+	out := map[string]interface{}{}
+	for key, v := range in {
+		f, ok := a.customField(w, r, fields, key)
+		if !ok {
+			return nil, false
+		}
+		stored, ok := f.value(v)
+		if !ok {
+			a.rnd.JSON(w, http.StatusBadRequest, render.M{
+				"message": tr(r, "custom_field.value_invalid", key, f.Type),
+			})
+			return nil, false
+		}
+		if stored != nil {
+			out[key] = stored
+		}
+	}
+	if len(out) == 0 {
+		return nil, true
+	}
+	return out, true
+}
+
+// parseCustomFilter reads ?custom.<key>=value, which keeps only todos
+// whose field holds exactly value. It answers 400 itself like
+// customValues.
+func (a *app) parseCustomFilter(ctx context.Context, w http.ResponseWriter, r *http.Request) (map[string]interface{}, bool) {
+	var fields map[string]customField
+	var out map[string]interface{}
+	for name, vs := range r.URL.Query() {
+		key, found := strings.CutPrefix(name, customFilterPrefix)
+		if !found {
+			continue
+		}
+		if fields == nil {
+			var ok bool
+			if fields, ok = a.loadCustomFields(ctx, w, r); !ok {
+				return nil, false
+			}
+			out = map[string]interface{}{}
+		}
+		f, ok := a.customField(w, r, fields, key)
+		if !ok {
+			return nil, false
+		}
+		v, ok := f.parse(vs[0])
+		if !ok || v == nil {
+			a.rnd.JSON(w, http.StatusBadRequest, render.M{
+				"message": tr(r, "custom_field.value_invalid", key, f.Type),
+			})
+			return nil, false
+		}
+		out[key] = v
+	}
+	return out, true
+}
+
+func (a *app) loadCustomFields(ctx context.Context, w http.ResponseWriter, r *http.Request) (map[string]customField, bool) {
+	list, err := a.customFields.List(ctx)
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "custom_field.fetch_failed"),
+			"error":   err.Error(),
+		})
+		return nil, false
+	}
+	out := make(map[string]customField, len(list))
+	for _, f := range list {
+		out[f.Key] = f
+	}
+	return out, true
+}
+
+func (a *app) customField(w http.ResponseWriter, r *http.Request, fields map[string]customField, key string) (customField, bool) {
+	f, ok := fields[key]
+	if !ok {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "custom_field.unknown", key),
+		})
+	}
+	return f, ok
+}
+
+func (a *app) customFieldHandlers() http.Handler {
+	rg := chi.NewRouter()
+	rg.Group(func(r chi.Router) {
+		r.Get("/", a.fetchCustomFields)
+		r.Put("/{key}", a.saveCustomField)
+		r.Delete("/{key}", a.deleteCustomField)
+	})
+	return rg
+}
+
+func (a *app) fetchCustomFields(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	fields, err := a.customFields.List(ctx)
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "custom_field.fetch_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	a.rnd.JSON(w, http.StatusOK, render.M{"data": fields})
+}
+
+// saveCustomField defines the field {key}, or redefines it. Values that
+// no longer fit are dropped from todos: all of them when the type
+// changes, and those naming a removed option of a select field.
+func (a *app) saveCustomField(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	key := chi.URLParam(r, "key")
+	if !customKeyPattern.MatchString(key) {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "custom_field.key_invalid"),
+		})
+		return
+	}
+	var f customField
+	if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "request.invalid_body"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	f.Key = key
+	if msg := f.normalize(); msg != "" {
+		var args []interface{}
+		switch msg {
+		case "custom_field.type_invalid":
+			args = append(args, strings.Join(customTypes, ", "))
+		case "custom_field.options_invalid":
+			args = append(args, maxCustomOptions)
+		}
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, msg, args...),
+		})
+		return
+	}
+
+	fields, ok := a.loadCustomFields(ctx, w, r)
+	if !ok {
+		return
+	}
+	_, exists := fields[key]
+	if !exists && len(fields) >= maxCustomFields {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "custom_field.too_many", maxCustomFields),
+		})
+		return
+	}
+	if err := a.customFields.Save(ctx, f); err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "custom_field.save_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	status := http.StatusOK
+	if !exists {
+		status = http.StatusCreated
+	}
+	a.rnd.JSON(w, status, render.M{"data": f})
+}
+
+// deleteCustomField removes the field {key} and every todo's value for
+// it.
+func (a *app) deleteCustomField(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	if err := a.customFields.Delete(ctx, chi.URLParam(r, "key")); err != nil {
+		a.fail(w, r, err, "custom_field.delete_failed")
+		return
+	}
+	a.rnd.JSON(w, http.StatusOK, render.M{"message": tr(r, "custom_field.deleted")})
+}
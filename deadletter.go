@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"todo/internal/events"
+	"todo/internal/render"
+)
+
+const (
+	defaultDeadLetterLimit = 50
+	maxDeadLetterLimit     = 500
+)
+
+// deadLetterQueue is the operator's view of events that ran out of
+// delivery attempts.
+type deadLetterQueue interface {
+	Failed(ctx context.Context, limit int64) ([]deadLetter, error)
+	Redeliver(ctx context.Context, id primitive.ObjectID) error
+	Sinks() []sinkStatus
+}
+
+// deadLetter is a failed outbox entry. Pending names the sinks that never
+// received it.
+type deadLetter struct {
+	ID        string      `json:"id"`
+	Type      events.Type `json:"type,omitempty"`
+	Subject   string      `json:"subject,omitempty"`
+	Attempts  int         `json:"attempts"`
+	LastError string      `json:"last_error,omitempty"`
+	Delivered []string    `json:"delivered,omitempty"`
+	Pending   []string    `json:"pending"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// requireOutbox answers 404 when no event sink is configured, since there
+// is then nothing to report on or redeliver.
+func (a *app) requireOutbox(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.outbox == nil {
+			a.rnd.JSON(w, http.StatusNotFound, render.M{
+				"message": tr(r, "outbox.disabled"),
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *app) fetchSinks(w http.ResponseWriter, r *http.Request) {
+	a.rnd.JSON(w, http.StatusOK, render.M{"data": a.outbox.Sinks()})
+}
+
+func (a *app) fetchDeadLetters(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	limit := int64(defaultDeadLetterLimit)
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 1 || n > maxDeadLetterLimit {
+			a.rnd.JSON(w, http.StatusBadRequest, render.M{
+				"message": tr(r, "outbox.limit_invalid", maxDeadLetterLimit),
+			})
+			return
+		}
+		limit = n
+	}
+
+	failed, err := a.outbox.Failed(ctx, limit)
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "outbox.fetch_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	a.rnd.JSON(w, http.StatusOK, render.M{"data": failed})
+}
+
+func (a *app) redeliver(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	id, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "outbox.id_invalid"),
+		})
+		return
+	}
+	if err := a.outbox.Redeliver(ctx, id); err != nil {
+		a.fail(w, r, err, "outbox.redeliver_failed")
+		return
+	}
+	a.rnd.JSON(w, http.StatusAccepted, render.M{
+		"message": tr(r, "outbox.redelivering"),
+	})
+}
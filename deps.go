@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"todo/internal/render"
+)
+
+// addBlocker records that the todo can't be completed before the one
+// named in {"id": ...}.
+func (a *app) addBlocker(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	id, ok := a.todoID(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "request.invalid_body"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	blocker, err := primitive.ObjectIDFromHex(strings.TrimSpace(req.ID))
+	if err != nil {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "todo.id_invalid"),
+		})
+		return
+	}
+
+	tm, err := a.todos.AddBlocker(ctx, id, blocker)
+	if err != nil {
+		a.fail(w, r, err, "todo.update_failed")
+		return
+	}
+	a.blockersChanged(w, r, tm)
+}
+
+func (a *app) removeBlocker(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	id, ok := a.todoID(w, r)
+	if !ok {
+		return
+	}
+	blocker, err := primitive.ObjectIDFromHex(strings.TrimSpace(chi.URLParam(r, "blocker")))
+	if err != nil {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "todo.id_invalid"),
+		})
+		return
+	}
+
+	tm, err := a.todos.RemoveBlocker(ctx, id, blocker)
+	if err != nil {
+		a.fail(w, r, err, "todo.update_failed")
+		return
+	}
+	a.blockersChanged(w, r, tm)
+}
+
+func (a *app) blockersChanged(w http.ResponseWriter, r *http.Request, tm todoModel) {
+	t := tm.toTodo()
+	t.Links = todoLinks(todoBase(r), t.ID)
+	a.rnd.JSON(w, http.StatusOK, render.M{"data": t})
+}
+
+// forced reports whether the request says ?force=true, completing a todo
+// despite its open blockers.
+func forced(r *http.Request) bool {
+	return r.URL.Query().Get("force") == "true"
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"todo/internal/i18n"
+	"todo/internal/notify"
+)
+
+// dispatcher queues reminders shortly before todos are due and a note
+// when they become overdue, for the notify job to send. It runs as the
+// scheduler's notify-sweep job, so on one replica at a time. It keeps its
+// place in memory only: todos that fall due while no process leads,
+// including until a dead leader's lease lapses, are not notified.
+type dispatcher struct {
+	cfg           config
+	todos         todoRepository
+	notifications notificationRepository
+	settings      settingsRepository
+	messages      *i18n.Bundle
+	queue         jobQueue
+	interval      time.Duration
+	last          time.Time
+}
+
+const (
+	// dispatchSchedule runs the sweep every dispatchInterval.
+	dispatchSchedule = "* * * * *"
+	dispatchInterval = time.Minute
+)
+
+func newDispatcher(cfg config, todos todoRepository, notifications notificationRepository, settings settingsRepository, messages *i18n.Bundle, queue jobQueue) *dispatcher {
+	return &dispatcher{
+		cfg:           cfg,
+		todos:         todos,
+		notifications: notifications,
+		settings:      settings,
+		messages:      messages,
+		queue:         queue,
+		interval:      dispatchInterval,
+	}
+}
+
+// Sweep covers the time since the last successful sweep. With none, or
+// one from before another replica took the lead for a while, it covers
+// the past interval only, which that replica has not.
+func (d *dispatcher) Sweep(ctx context.Context) error {
+	now := time.Now()
+	from := d.last
+	if from.IsZero() || now.Sub(from) > schedulerLease {
+		from = now.Add(-d.interval)
+	}
+	if err := d.sweep(ctx, from, now); err != nil {
+		return err
+	}
+	d.last = now
+	return nil
+}
+
+// sweep notifies about todos whose reminder time or due date falls in
+// [from, to).
+func (d *dispatcher) sweep(ctx context.Context, from, to time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, d.interval)
+	defer cancel()
+
+	n, err := d.notifications.Load(ctx)
+	if err != nil || len(n.Channels) == 0 {
+		return err
+	}
+	s, err := d.settings.Load(ctx)
+	if err != nil {
+		return err
+	}
+	l := d.messages.Localizer(n.Language)
+	loc := s.location()
+	now := time.Now().In(loc)
+
+	for _, w := range []struct {
+		event    string
+		from, to time.Time
+		subject  string
+	}{
+		{notifyReminder, from.Add(d.cfg.ReminderLead), to.Add(d.cfg.ReminderLead), "notify.reminder_subject"},
+		{notifyOverdue, from, to, "notify.overdue_subject"},
+	} {
+		channels := n.subscribed(w.event)
+		if len(channels) == 0 {
+			continue
+		}
+		todos, err := d.todos.List(ctx, listQuery{DueFrom: w.from, DueTo: w.to})
+		if err != nil {
+			return err
+		}
+		rule := n.Rules[w.event]
+		for _, t := range todos {
+			if t.Completed || !rule.allows(t, now) {
+				continue
+			}
+			err := queueNotifications(ctx, d.queue, channels, notify.Message{
+				Event:   w.event,
+				Subject: l.T(w.subject, t.Title),
+				Body:    l.T("notify.due_at", t.DueDate.In(loc).Format("2006-01-02 15:04 MST")),
+				Time:    now.UTC(),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"todo/internal/fieldcrypt"
+)
+
+const (
+	downloadsCollection = "downloads"
+
+	// downloadTTL is how long a finished export can be fetched.
+	downloadTTL = time.Hour
+	// maxDownloadBytes keeps a sealed file within one document.
+	maxDownloadBytes  = 8 << 20
+	downloadTokenSize = 24
+)
+
+var errDownloadNotFound = notFoundError("download.not_found", "download not found")
+
+// download is a file kept for a while for its link to be fetched. The
+// unguessable token in the link is all it takes to fetch it.
+type download struct {
+	Token       string    `bson:"_id"`
+	ContentType string    `bson:"content_type"`
+	Filename    string    `bson:"filename"`
+	Data        string    `bson:"data"`
+	ExpiresAt   time.Time `bson:"expires_at"`
+
+	Body []byte `bson:"-"`
+}
+
+// downloadRepository keeps files for downloadTTL.
+type downloadRepository interface {
+	Save(ctx context.Context, contentType, filename string, body []byte) (download, error)
+	Get(ctx context.Context, token string) (download, error)
+}
+
+// mongoDownloadRepository seals each file; a TTL index on expires_at
+// removes it once it has expired.
+type mongoDownloadRepository struct {
+	coll   *mongo.Collection
+	cipher *fieldcrypt.Cipher
+}
+
+func newMongoDownloadRepository(coll *mongo.Collection, cipher *fieldcrypt.Cipher) *mongoDownloadRepository {
+	return &mongoDownloadRepository{coll: coll, cipher: cipher}
+}
+
+func downloadAAD(token string) []byte {
+	return []byte(token + "/data")
+}
+
+func (s *mongoDownloadRepository) Save(ctx context.Context, contentType, filename string, body []byte) (download, error) {
+	buf := make([]byte, downloadTokenSize)
+	if _, err := rand.Read(buf); err != nil {
+		return download{}, err
+	}
+	d := download{
+		Token:       base64.RawURLEncoding.EncodeToString(buf),
+		ContentType: contentType,
+		Filename:    filename,
+		ExpiresAt:   time.Now().Add(downloadTTL),
+		Body:        body,
+	}
+	var err error
+	if d.Data, err = s.cipher.Encrypt(base64.StdEncoding.EncodeToString(body), downloadAAD(d.Token)); err != nil {
+		return download{}, err
+	}
+	_, err = s.coll.InsertOne(ctx, d)
+	return d, err
+}
+
+// Get returns the file for token. The TTL monitor runs only once a
+// minute, so expiry is checked here too.
+func (s *mongoDownloadRepository) Get(ctx context.Context, token string) (download, error) {
+	var d download
+	err := s.coll.FindOne(ctx, bson.M{"_id": token, "expires_at": bson.M{"$gt": time.Now()}}).Decode(&d)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return download{}, errDownloadNotFound
+	}
+	if err != nil {
+		return download{}, err
+	}
+	raw, err := s.cipher.Decrypt(d.Data, downloadAAD(d.Token))
+	if err != nil {
+		return download{}, err
+	}
+	if d.Body, err = base64.StdEncoding.DecodeString(raw); err != nil {
+		return download{}, err
+	}
+	return d, nil
+}
+
+func (a *app) fetchDownload(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	d, err := a.downloads.Get(ctx, chi.URLParam(r, "token"))
+	if err != nil {
+		a.fail(w, r, err, "download.fetch_failed")
+		return
+	}
+	w.Header().Set("Content-Type", d.ContentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+d.Filename+`"`)
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(d.Body)
+}
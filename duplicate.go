@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"todo/internal/render"
+)
+
+// titleKey is title reduced to what makes two todos the same: letters
+// and digits, lowercased, single-spaced. "Buy milk!" and " buy  MILK"
+// share a key.
+func titleKey(title string) string {
+	clean := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return ' '
+	}, title)
+	return strings.Join(strings.Fields(clean), " ")
+}
+
+// checkDuplicate looks for an open todo with the same title. Without
+// ?allow_duplicate=true a match answers 409 with the existing todo and
+// returns ok false; with it, the match is returned for a warning.
+func (a *app) checkDuplicate(ctx context.Context, w http.ResponseWriter, r *http.Request, title string) (*todo, bool) {
+	tm, err := a.todos.FindDuplicate(ctx, title)
+	if errors.Is(err, errTodoNotFound) {
+		return nil, true
+	}
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "todo.create_failed"),
+			"error":   err.Error(),
+		})
+		return nil, false
+	}
+	existing := tm.toTodo()
+	existing.Links = todoLinks(todoBase(r), existing.ID)
+	if r.URL.Query().Get("allow_duplicate") == "true" {
+		return &existing, true
+	}
+	a.rnd.JSON(w, http.StatusConflict, render.M{
+		"message": tr(r, "todo.duplicate"),
+		"data":    existing,
+	})
+	return nil, false
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"todo/internal/render"
+)
+
+// The kinds of failure a client can be told about. Repository and service
+// errors are of one of these kinds, which fail maps to a status, so
+// handlers need not tell them apart to answer them.
+var (
+	errNotFound     = errors.New("not found")
+	errValidation   = errors.New("invalid")
+	errConflict     = errors.New("conflict")
+	errUnauthorized = errors.New("unauthorized")
+	errUnavailable  = errors.New("unavailable")
+	errPrecondition = errors.New("precondition failed")
+)
+
+// errDBUnavailable is returned without trying while the database circuit
+// breaker is open.
+var errDBUnavailable = &domainError{errUnavailable, "db.unavailable", "database unavailable"}
+
+// clientError is an error whose response body explains it to clients.
+type clientError interface {
+	error
+	body(r *http.Request) render.M
+}
+
+// domainError is a failure of a kind, errors.Is(err, kind), with the
+// message key clients are shown.
+type domainError struct {
+	kind error
+	key  string
+	text string
+}
+
+func (e *domainError) Error() string                 { return e.text }
+func (e *domainError) Is(target error) bool          { return target == e.kind }
+func (e *domainError) body(r *http.Request) render.M { return render.M{"message": tr(r, e.key)} }
+
+func notFoundError(key, text string) error     { return &domainError{errNotFound, key, text} }
+func invalidError(key, text string) error      { return &domainError{errValidation, key, text} }
+func conflictError(key, text string) error     { return &domainError{errConflict, key, text} }
+func unauthorizedError(key, text string) error { return &domainError{errUnauthorized, key, text} }
+func preconditionError(key, text string) error { return &domainError{errPrecondition, key, text} }
+
+// fail answers err by its kind: 404, 422, 409, 401, 412 or 503, with the message
+// the error carries. Any other error is a 500 with failedKey.
+func (a *app) fail(w http.ResponseWriter, r *http.Request, err error, failedKey string) {
+	var ce clientError
+	if !errors.As(err, &ce) {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, failedKey),
+			"error":   err.Error(),
+		})
+		return
+	}
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, errNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, errValidation):
+		status = http.StatusUnprocessableEntity
+	case errors.Is(err, errConflict):
+		status = http.StatusConflict
+	case errors.Is(err, errUnauthorized):
+		w.Header().Set("WWW-Authenticate", `Bearer realm="todo"`)
+		status = http.StatusUnauthorized
+	case errors.Is(err, errPrecondition):
+		status = http.StatusPreconditionFailed
+	case errors.Is(err, errUnavailable):
+		w.Header().Set("Retry-After", "5")
+		status = http.StatusServiceUnavailable
+	}
+	a.rnd.JSON(w, status, ce.body(r))
+}
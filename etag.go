@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// todoETag is the entity tag of t, made from when it was last written:
+// every change to a todo, its blockers and links included, sets that.
+// Stored times keep milliseconds, so the tag does too.
+func todoETag(t todoModel) string {
+	return `"` + strconv.FormatInt(t.UpdatedAt.UnixMilli(), 36) + `"`
+}
+
+// revisions are the last-written times a conditional write accepts. Nil
+// accepts any; empty accepts none.
+type revisions []time.Time
+
+// filter selects the todo id if it was last written at one of m.
+func (m revisions) filter(id primitive.ObjectID) bson.M {
+	if m == nil {
+		return bson.M{"_id": id}
+	}
+	return bson.M{"_id": id, "updated_at": bson.M{"$in": []time.Time(m)}}
+}
+
+// ifMatch reads the If-Match header of a write into the revisions it
+// accepts. With no header, or *, the write is unconditional. Weak tags,
+// and tags this server did not make, never match.
+func ifMatch(r *http.Request) revisions {
+	v := strings.TrimSpace(r.Header.Get("If-Match"))
+	if v == "" || v == "*" {
+		return nil
+	}
+	match := revisions{}
+	for _, tag := range strings.Split(v, ",") {
+		tag = strings.TrimSpace(tag)
+		if !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) || len(tag) < 2 {
+			continue
+		}
+		ms, err := strconv.ParseInt(tag[1:len(tag)-1], 36, 64)
+		if err != nil {
+			continue
+		}
+		match = append(match, time.UnixMilli(ms))
+	}
+	return match
+}
+
+// notModified sets the validators of a GET response and, when the
+// client's copy is still current by If-None-Match or, failing that,
+// If-Modified-Since, answers 304 and reports true. Either validator may
+// be left out with "" or the zero time.
+func notModified(w http.ResponseWriter, r *http.Request, etag string, modified time.Time) bool {
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+
+	current := false
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		// Comparison is weak here: a W/ prefix doesn't matter.
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if etag != "" && (tag == "*" || tag == etag) {
+				current = true
+			}
+		}
+	} else if ims, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !modified.IsZero() {
+		current = !modified.Truncate(time.Second).After(ims)
+	}
+	if current {
+		w.WriteHeader(http.StatusNotModified)
+	}
+	return current
+}
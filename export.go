@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"todo/internal/i18n"
+	"todo/internal/pdf"
+	"todo/internal/render"
+)
+
+// exportFormat is a file format todos can be exported as. write gets
+// now in the settings timezone, which dates are written in.
+type exportFormat struct {
+	ContentType string
+	Extension   string
+	write       func(r *http.Request, todos []todoModel, now time.Time) ([]byte, error)
+}
+
+var exportFormats = map[string]exportFormat{
+	"org": {"text/org; charset=utf-8", "org", func(r *http.Request, todos []todoModel, now time.Time) ([]byte, error) {
+		return writeOrg(todos, now.Location()), nil
+	}},
+	"pdf": {"application/pdf", "pdf", func(r *http.Request, todos []todoModel, now time.Time) ([]byte, error) {
+		var buf bytes.Buffer
+		_, err := todosPDF(r, todos, now).WriteTo(&buf)
+		return buf.Bytes(), err
+	}},
+	"taskwarrior": {"application/json", "json", func(r *http.Request, todos []todoModel, now time.Time) ([]byte, error) {
+		return writeTaskwarrior(todos)
+	}},
+	"todotxt": {"text/plain; charset=utf-8", "txt", func(r *http.Request, todos []todoModel, now time.Time) ([]byte, error) {
+		return writeTodoTxt(todos, now.Location()), nil
+	}},
+}
+
+// lineExports are the formats with a line per todo, which exportTodos
+// streams off the cursor rather than building the whole file first.
+var lineExports = map[string]func(t todoModel, loc *time.Location) string{
+	"todotxt": todoTxtLine,
+}
+
+// exportTodos serves the todo list as a file in ?format= (pdf by
+// default), filtered and sorted like the list itself (?tag=,
+// ?actionable=, ?sort=).
+func (a *app) exportTodos(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	name, q, ok := a.exportParams(w, r)
+	if !ok {
+		return
+	}
+	format := exportFormats[name]
+	s, err := a.settings.Load(ctx)
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "settings.fetch_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	// The file changes with any todo, and with the timezone its dates
+	// are written in, so it was last modified at the latest of those.
+	modified, err := a.todos.LastModified(ctx)
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "todo.fetch_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	if s.UpdatedAt.After(modified) {
+		modified = s.UpdatedAt
+	}
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if notModified(w, r, "", modified) {
+		return
+	}
+	if line, ok := lineExports[name]; ok {
+		loc := s.location()
+		err := a.streamTodos(ctx, w, r, q, func() {
+			w.Header().Set("Content-Type", format.ContentType)
+			w.Header().Set("Content-Disposition", `attachment; filename="todos.`+format.Extension+`"`)
+			w.WriteHeader(http.StatusOK)
+		}, func(t todoModel) error {
+			_, err := io.WriteString(w, line(t, loc))
+			return err
+		})
+		if err != nil {
+			a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+				"message": tr(r, "todo.fetch_failed"),
+				"error":   err.Error(),
+			})
+		}
+		return
+	}
+	todos, err := a.todos.List(ctx, q)
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "todo.fetch_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	body, err := format.write(r, todos, time.Now().In(s.location()))
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "export.failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	w.Header().Set("Content-Type", format.ContentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="todos.`+format.Extension+`"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// exportParams reads the format name and list filters of an export,
+// writing a 400 when either is invalid.
+func (a *app) exportParams(w http.ResponseWriter, r *http.Request) (string, listQuery, bool) {
+	name := r.URL.Query().Get("format")
+	if name == "" {
+		name = "pdf"
+	}
+	if _, ok := exportFormats[name]; !ok {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "export.format_invalid", strings.Join(slices.Sorted(maps.Keys(exportFormats)), ", ")),
+		})
+		return "", listQuery{}, false
+	}
+
+	sort, ok := a.parseSort(w, r)
+	if !ok {
+		return "", listQuery{}, false
+	}
+	q := listQuery{Sort: sort, Actionable: r.URL.Query().Get("actionable") == "true"}
+	if tags := normalizeTags([]string{r.URL.Query().Get("tag")}); tags != nil {
+		q.Tag = tags[0]
+	}
+	return name, q, true
+}
+
+// exportJob is the queued job behind POST /todo/export/jobs.
+const exportJob = "export"
+
+// exportJobPayload is an export to run later, in the language it was
+// asked for in.
+type exportJobPayload struct {
+	Format     string    `json:"format"`
+	Sort       []sortKey `json:"sort,omitempty"`
+	Tag        string    `json:"tag,omitempty"`
+	Actionable bool      `json:"actionable,omitempty"`
+	Language   string    `json:"language"`
+}
+
+// exportJobResult says where to fetch a finished export, until when.
+type exportJobResult struct {
+	Count     int       `json:"count"`
+	Bytes     int       `json:"bytes"`
+	Download  string    `json:"download"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// queueExport takes the parameters of exportTodos and queues the export
+// instead of waiting for it. The job's result links to the file.
+func (a *app) queueExport(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	name, q, ok := a.exportParams(w, r)
+	if !ok {
+		return
+	}
+	a.queueJob(ctx, w, r, exportJob, exportJobPayload{
+		Format:     name,
+		Sort:       q.Sort,
+		Tag:        q.Tag,
+		Actionable: q.Actionable,
+		Language:   i18n.FromContext(r.Context()).Lang(),
+	})
+}
+
+// runExport handles export jobs.
+func (a *app) runExport(ctx context.Context, run *jobRun) (interface{}, error) {
+	var p exportJobPayload
+	if err := json.Unmarshal(run.Payload, &p); err != nil {
+		return nil, permanent(err)
+	}
+	format, ok := exportFormats[p.Format]
+	if !ok {
+		return nil, permanent(fmt.Errorf("unknown export format %q", p.Format))
+	}
+
+	todos, err := a.todos.List(ctx, listQuery{Sort: p.Sort, Tag: p.Tag, Actionable: p.Actionable})
+	if err != nil {
+		return nil, err
+	}
+	run.Progress(ctx, 0, len(todos))
+	s, err := a.settings.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// The formats localize through a request, as exportTodos gives them.
+	r, err := http.NewRequestWithContext(i18n.NewContext(ctx, a.messages.Localizer(p.Language)), http.MethodGet, "/", nil)
+	if err != nil {
+		return nil, permanent(err)
+	}
+	body, err := format.write(r, todos, time.Now().In(s.location()))
+	if err != nil {
+		return nil, permanent(err)
+	}
+	if len(body) > maxDownloadBytes {
+		return nil, permanent(fmt.Errorf("export is %d bytes, over the limit of %d", len(body), maxDownloadBytes))
+	}
+	run.Progress(ctx, len(todos), len(todos))
+
+	d, err := a.downloads.Save(ctx, format.ContentType, "todos."+format.Extension, body)
+	if err != nil {
+		return nil, err
+	}
+	return exportJobResult{
+		Count:     len(todos),
+		Bytes:     len(body),
+		Download:  "/downloads/" + d.Token,
+		ExpiresAt: d.ExpiresAt.UTC(),
+	}, nil
+}
+
+// Layout of the printed checklist, in points.
+const (
+	pdfMargin   = 56
+	pdfBox      = 10
+	pdfTitle    = 11
+	pdfSmall    = 8
+	pdfDueWidth = 80
+)
+
+// todosPDF lays todos out as a checklist: a ticked box for each
+// completed todo, the title wrapped to fit, its due date on the right
+// and its tags underneath.
+func todosPDF(r *http.Request, todos []todoModel, now time.Time) *pdf.Document {
+	doc := &pdf.Document{Title: tr(r, "export.heading")}
+	page := doc.AddPage()
+	y := pdf.PageHeight - pdfMargin
+	page.Text(pdfMargin, y, pdf.Bold, 18, doc.Title)
+	y -= 16
+	page.Gray(0.4)
+	page.Text(pdfMargin, y, pdf.Regular, pdfSmall, tr(r, "export.generated", now.Format("2006-01-02 15:04 MST")))
+	page.Gray(0)
+	y -= 24
+
+	textX := float64(pdfMargin + pdfBox + 8)
+	textWidth := pdf.PageWidth - textX - pdfMargin - pdfDueWidth
+	for _, t := range todos {
+		lines := pdf.Wrap(pdf.Regular, pdfTitle, textWidth, t.Title)
+		height := float64(len(lines))*14 + 6
+		if len(t.Tags) > 0 {
+			height += 11
+		}
+		if y-height < pdfMargin {
+			page = doc.AddPage()
+			y = pdf.PageHeight - pdfMargin
+		}
+
+		page.Rect(pdfMargin, y-1, pdfBox, pdfBox)
+		if t.Completed {
+			page.Line(pdfMargin+2, y+4, pdfMargin+4.5, y+1.5)
+			page.Line(pdfMargin+4.5, y+1.5, pdfMargin+8.5, y+7.5)
+			page.Gray(0.5)
+		}
+		for i, line := range lines {
+			page.Text(textX, y-float64(i)*14, pdf.Regular, pdfTitle, line)
+		}
+		if t.DueDate != nil {
+			due := t.DueDate.In(now.Location()).Format(time.DateOnly)
+			page.Text(pdf.PageWidth-pdfMargin-pdf.Width(pdf.Regular, pdfSmall+1, due), y, pdf.Regular, pdfSmall+1, due)
+		}
+		y -= float64(len(lines)) * 14
+		if len(t.Tags) > 0 {
+			page.Gray(0.45)
+			page.Text(textX, y+2, pdf.Regular, pdfSmall, "#"+strings.Join(t.Tags, " #"))
+			y -= 11
+		}
+		page.Gray(0)
+		y -= 6
+	}
+	if len(todos) == 0 {
+		page.Text(pdfMargin, y, pdf.Regular, pdfTitle, tr(r, "export.empty"))
+	}
+	return doc
+}
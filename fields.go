@@ -0,0 +1,119 @@
+package main
+
+import (
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"todo/internal/render"
+)
+
+// todoFields maps the names clients use in ?fields= to the stored fields
+// behind them.
+var todoFields = map[string][]string{
+	"id":           {"_id"},
+	"title":        {"title"},
+	"completed":    {"completed"},
+	"created_at":   {"created_at"},
+	"updated_at":   {"updated_at"},
+	"completed_at": {"completed_at"},
+	"start_date":   {"start_date"},
+	"due_date":     {"due_date"},
+	"column_id":    {"column_id"},
+	"position":     {"position"},
+	"blocked_by":   {"blocked_by"},
+	"tags":         {"tags"},
+	"priority":     {"priority"},
+	"parent_id":    {"parent_id"},
+	"custom":       {"custom"},
+	"location":     {"location", "location_label"},
+	"notes":        {"notes"},
+}
+
+// parseFields reads ?fields=a,b (or JSON:API's fields[todos]=a,b). A nil
+// result means every field; ok is false when a name isn't in todoFields.
+func parseFields(r *http.Request) (fields []string, ok bool) {
+	q := r.URL.Query()
+	v := q.Get("fields")
+	if q.Has("fields[todos]") {
+		v = q.Get("fields[todos]")
+	}
+	if v == "" {
+		return nil, true
+	}
+	seen := map[string]bool{}
+	for _, f := range strings.Split(v, ",") {
+		f = strings.TrimSpace(f)
+		if _, known := todoFields[f]; !known {
+			return nil, false
+		}
+		if !seen[f] {
+			seen[f] = true
+			fields = append(fields, f)
+		}
+	}
+	return fields, true
+}
+
+// listedFields are the stored fields toTodo reads, so a full list skips
+// the rest (title_key, related) rather than decoding them for nothing.
+// Anything toTodo starts showing belongs here too.
+var listedFields = []string{
+	"_id", "title", "completed", "created_at", "updated_at", "completed_at",
+	"start_date", "due_date", "column_id", "position", "blocked_by", "tags",
+	"priority", "parent_id", "custom", "location", "location_label", "notes",
+}
+
+// storedFields are the document fields to project for fields, or
+// listedFields when fields is nil.
+func storedFields(fields []string) []string {
+	if fields == nil {
+		return listedFields
+	}
+	out := make([]string, 0, len(fields))
+	for _, f := range fields {
+		out = append(out, todoFields[f]...)
+	}
+	return out
+}
+
+// sparse is t with only the named fields, plus its links. A nil fields
+// keeps them all.
+func (t todo) sparse(fields []string) interface{} {
+	if fields == nil {
+		return t
+	}
+	all := map[string]interface{}{
+		"id":           t.ID,
+		"title":        t.Title,
+		"completed":    t.Completed,
+		"created_at":   t.CreatedAt,
+		"updated_at":   t.UpdatedAt,
+		"completed_at": t.CompletedAt,
+		"start_date":   t.StartDate,
+		"due_date":     t.DueDate,
+		"column_id":    t.ColumnID,
+		"position":     t.Position,
+		"blocked_by":   t.BlockedBy,
+		"tags":         t.Tags,
+		"priority":     t.Priority,
+		"parent_id":    t.ParentID,
+		"custom":       t.Custom,
+		"location":     t.Location,
+		"notes":        t.Notes,
+	}
+	out := render.M{}
+	for _, f := range fields {
+		out[f] = all[f]
+	}
+	if t.Links != nil {
+		out["_links"] = t.Links
+	}
+	return out
+}
+
+// fieldNames are the names ?fields= accepts, for error messages.
+func fieldNames() []string {
+	return slices.Sorted(maps.Keys(todoFields))
+}
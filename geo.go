@@ -0,0 +1,170 @@
+package main
+
+import (
+	"cmp"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"unicode/utf8"
+
+	"todo/internal/render"
+)
+
+const (
+	// earthRadius is the mean radius in metres, as MongoDB's spherical
+	// queries assume.
+	earthRadius = 6378100.0
+
+	defaultNearbyRadius = 1000.0
+	maxNearbyRadius     = 100000.0
+	defaultNearbyLimit  = 20
+	maxNearbyLimit      = 100
+
+	maxLocationLabel = 200
+)
+
+// geoPoint is a GeoJSON point, [longitude, latitude] in that order.
+type geoPoint struct {
+	Type        string    `bson:"type" json:"type"`
+	Coordinates []float64 `bson:"coordinates" json:"coordinates"`
+}
+
+func newGeoPoint(lat, lng float64) *geoPoint {
+	return &geoPoint{Type: "Point", Coordinates: []float64{lng, lat}}
+}
+
+func (p geoPoint) lat() float64 { return p.Coordinates[1] }
+func (p geoPoint) lng() float64 { return p.Coordinates[0] }
+
+// valid reports whether p is a point on Earth.
+func (p geoPoint) valid() bool {
+	return p.Type == "Point" && len(p.Coordinates) == 2 &&
+		validLat(p.lat()) && validLng(p.lng())
+}
+
+func validLat(v float64) bool { return v >= -90 && v <= 90 }
+func validLng(v float64) bool { return v >= -180 && v <= 180 }
+
+// distance is the great-circle distance between p and q in metres.
+func (p geoPoint) distance(q geoPoint) float64 {
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := rad(q.lat() - p.lat())
+	dLng := rad(q.lng() - p.lng())
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(rad(p.lat()))*math.Cos(rad(q.lat()))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// geoCircle is the area within Radius metres of Center.
+type geoCircle struct {
+	Center geoPoint
+	Radius float64
+}
+
+// todoLocation is where a todo is done, as clients see it: a GeoJSON
+// point with the label as a foreign member.
+type todoLocation struct {
+	geoPoint
+	Label string `json:"label,omitempty"`
+}
+
+// stored splits l into what a todoModel keeps.
+func (l *todoLocation) stored() (*geoPoint, string) {
+	if l == nil {
+		return nil, ""
+	}
+	return &l.geoPoint, l.Label
+}
+
+// checkLocation answers 400 and returns false when a todo's location
+// isn't a point on Earth or its label is too long.
+func (a *app) checkLocation(w http.ResponseWriter, r *http.Request, l *todoLocation) bool {
+	if l == nil {
+		return true
+	}
+	if l.Type == "" {
+		l.Type = "Point"
+	}
+	if !l.valid() {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "todo.location_invalid"),
+		})
+		return false
+	}
+	if utf8.RuneCountInString(l.Label) > maxLocationLabel {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "todo.location_label_too_long", maxLocationLabel),
+		})
+		return false
+	}
+	return true
+}
+
+// nearbyTodo is a todo found near a point, with how far away it is.
+type nearbyTodo struct {
+	todo
+	Distance float64 `json:"distance_m"`
+}
+
+// nearbyTodos serves the open todos located within ?radius= metres
+// (default 1000) of ?lat=&lng=, nearest first.
+func (a *app) nearbyTodos(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	q := r.URL.Query()
+	lat, errLat := strconv.ParseFloat(q.Get("lat"), 64)
+	lng, errLng := strconv.ParseFloat(q.Get("lng"), 64)
+	if errLat != nil || errLng != nil || !validLat(lat) || !validLng(lng) {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "nearby.position_invalid"),
+		})
+		return
+	}
+	radius := defaultNearbyRadius
+	if v := q.Get("radius"); v != "" {
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil || !(n > 0 && n <= maxNearbyRadius) {
+			a.rnd.JSON(w, http.StatusBadRequest, render.M{
+				"message": tr(r, "nearby.radius_invalid", int(maxNearbyRadius)),
+			})
+			return
+		}
+		radius = n
+	}
+	limit := defaultNearbyLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxNearbyLimit {
+			a.rnd.JSON(w, http.StatusBadRequest, render.M{
+				"message": tr(r, "nearby.limit_invalid", maxNearbyLimit),
+			})
+			return
+		}
+		limit = n
+	}
+
+	center := newGeoPoint(lat, lng)
+	todos, err := a.todos.List(ctx, listQuery{Open: true, Within: &geoCircle{Center: *center, Radius: radius}})
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "todo.fetch_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	base := todoBase(r)
+	out := make([]nearbyTodo, 0, len(todos))
+	for _, tm := range todos {
+		t := tm.toTodo()
+		t.Links = todoLinks(base, t.ID)
+		out = append(out, nearbyTodo{todo: t, Distance: math.Round(center.distance(*tm.Location))})
+	}
+	slices.SortStableFunc(out, func(x, y nearbyTodo) int { return cmp.Compare(x.Distance, y.Distance) })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	a.rnd.JSON(w, http.StatusOK, render.M{"data": out})
+}
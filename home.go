@@ -0,0 +1,71 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"todo/internal/i18n"
+)
+
+var pageTemplates = []string{"static/home.tpl", "static/todo_item.tpl"}
+
+type (
+	homePage struct {
+		*i18n.Localizer
+		Items []todoItem
+		// More links to the next page, when there is one.
+		More      string
+		Error     string
+		CSRFToken string
+	}
+	todoItem struct {
+		*i18n.Localizer
+		todo
+	}
+)
+
+func (a *app) homeHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	loc := i18n.FromContext(r.Context())
+	view := homePage{Localizer: loc, CSRFToken: csrfToken(r)}
+
+	if !a.health.Ready() {
+		view.Error = loc.T("db.unavailable")
+		a.rnd.Template(w, http.StatusServiceUnavailable, pageTemplates, view)
+		return
+	}
+
+	// The page always pages, like the API when asked to; a bad ?page=
+	// shows the first one.
+	p, ok, err := a.parsePage(ctx, r)
+	if err == nil && (!ok || p.Size == 0) {
+		p = page{Number: 1}
+		p.Size, err = a.defaultPageSize(ctx)
+	}
+	var todos []todoModel
+	if err == nil {
+		// One past the page tells whether there is another.
+		q := p.query()
+		q.Limit++
+		todos, err = a.todos.List(ctx, q)
+	}
+	if err != nil {
+		log.Println("home: failed to load todos:", err)
+		view.Error = loc.T("ui.load_failed")
+	}
+	if int64(len(todos)) > p.Size {
+		todos = todos[:p.Size]
+		view.More = p.link(r, p.Number+1)
+	}
+	for _, t := range todos {
+		view.Items = append(view.Items, newTodoItem(loc, t))
+	}
+
+	a.rnd.Template(w, http.StatusOK, pageTemplates, view)
+}
+
+func newTodoItem(loc *i18n.Localizer, t todoModel) todoItem {
+	return todoItem{Localizer: loc, todo: t.toTodo()}
+}
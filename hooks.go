@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"todo/internal/render"
+)
+
+// hookTriggerLimit is how many of the newest items a polling trigger
+// returns. Zapier and IFTTT remember the ids they have seen, so a poll
+// only needs to reach back past the items added since the last one.
+const hookTriggerLimit = 50
+
+// hookItem is a todo as no-code automation tools want it: a flat object
+// whose id is unique per event, for deduplication, with the todo's own id
+// in todo_id.
+type hookItem struct {
+	ID     string `json:"id"`
+	TodoID string `json:"todo_id"`
+	todo
+}
+
+func newHookItem(t todoModel, id string) hookItem {
+	return hookItem{ID: id, TodoID: t.ID.Hex(), todo: t.toTodo()}
+}
+
+// hookHandlers serve the polling triggers and actions of a Zapier or
+// IFTTT integration. Every call needs an API key.
+func (a *app) hookHandlers() http.Handler {
+	r := chi.NewRouter()
+	r.Use(a.requireAPIKey)
+	r.Get("/me", a.hookMe)
+	r.Get("/triggers/new-todo", a.newTodoTrigger)
+	r.Get("/triggers/completed-todo", a.completedTodoTrigger)
+	r.Post("/actions/create-todo", a.createTodoAction)
+	r.Post("/actions/complete-todo", a.completeTodoAction)
+	return r
+}
+
+// requireAPIKey turns away anonymous requests with 401.
+func (a *app) requireAPIKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if identityFrom(r.Context()).KeyName == "" {
+			a.fail(w, r, errAPIKeyRequired, "")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// hookMe is the connection test: it names the key the request used.
+func (a *app) hookMe(w http.ResponseWriter, r *http.Request) {
+	a.rnd.JSON(w, http.StatusOK, render.M{"key": identityFrom(r.Context()).KeyName})
+}
+
+// newTodoTrigger lists the newest todos, newest first.
+func (a *app) newTodoTrigger(w http.ResponseWriter, r *http.Request) {
+	a.hookTrigger(w, r, listQuery{Sort: []sortKey{{Field: "created_at", Desc: true}}}, func(t todoModel) string {
+		return t.ID.Hex()
+	})
+}
+
+// completedTodoTrigger lists the latest completions, newest first. The id
+// includes the completion time, so completing a todo again fires again.
+func (a *app) completedTodoTrigger(w http.ResponseWriter, r *http.Request) {
+	a.hookTrigger(w, r, listQuery{Done: true, Sort: []sortKey{{Field: "completed_at", Desc: true}}}, func(t todoModel) string {
+		if t.CompletedAt == nil {
+			return t.ID.Hex()
+		}
+		return t.ID.Hex() + "-" + strconv.FormatInt(t.CompletedAt.UnixMilli(), 10)
+	})
+}
+
+// hookTrigger answers with a bare JSON array, which is what polling
+// triggers expect, of the todos q finds, identified by id.
+func (a *app) hookTrigger(w http.ResponseWriter, r *http.Request, q listQuery, id func(todoModel) string) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	q.Limit = hookTriggerLimit
+	todos, err := a.todos.List(ctx, q)
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "todo.fetch_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	items := make([]hookItem, len(todos))
+	for i, t := range todos {
+		items[i] = newHookItem(t, id(t))
+	}
+	a.rnd.JSON(w, http.StatusOK, items)
+}
+
+// createTodoAction creates a todo from the same body as POST /todo, most
+// simply {"text": "..."} in quick-add syntax, and answers with the todo.
+func (a *app) createTodoAction(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	var in todoInput
+	if err := decodeTodo(r, &in); err != nil {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "request.invalid_body"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	tm, _, ok := a.addTodo(ctx, w, r, in)
+	if !ok {
+		return
+	}
+	a.rnd.JSON(w, http.StatusCreated, newHookItem(tm, tm.ID.Hex()))
+}
+
+// completeTodoAction completes the todo {"id": "..."} names and answers
+// with it.
+func (a *app) completeTodoAction(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	var in struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "request.invalid_body"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(in.ID)
+	if err != nil {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "todo.id_invalid"),
+		})
+		return
+	}
+	if err := a.service.Complete(ctx, id, false); err != nil {
+		a.fail(w, r, err, "todo.update_failed")
+		return
+	}
+	t, err := a.todos.Get(ctx, id)
+	if err != nil {
+		a.fail(w, r, err, "todo.fetch_failed")
+		return
+	}
+	a.rnd.JSON(w, http.StatusOK, newHookItem(t, t.ID.Hex()))
+}
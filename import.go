@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"todo/internal/render"
+)
+
+const (
+	maxImportBytes = 1 << 20
+	maxImportTodos = 1000
+
+	// Queued imports may be larger. They are created maxImportTodos at a
+	// time.
+	maxQueuedImportBytes = 4 << 20
+	maxQueuedImportTodos = 10 * maxImportTodos
+
+	// importJob is the queued job behind POST /todo/import/jobs.
+	importJob = "import"
+)
+
+// importFormats parse an uploaded file into new todos. Dates without a
+// zone are read in loc, and now stands in for missing creation times.
+var importFormats = map[string]func(data []byte, loc *time.Location, now time.Time) ([]todoModel, error){
+	"markdown":    parseMarkdown,
+	"taskwarrior": parseTaskwarrior,
+	"todotxt":     parseTodoTxt,
+}
+
+// importTodos creates the todos in the request body, a file in ?format=,
+// all at once or none at all.
+func (a *app) importTodos(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	parse, ok := importFormats[r.URL.Query().Get("format")]
+	if !ok {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "import.format_invalid", strings.Join(slices.Sorted(maps.Keys(importFormats)), ", ")),
+		})
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportBytes))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		a.rnd.JSON(w, http.StatusRequestEntityTooLarge, render.M{
+			"message": tr(r, "import.too_large", maxImportBytes>>20),
+		})
+		return
+	}
+	if err != nil {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "request.invalid_body"),
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	s, err := a.settings.Load(ctx)
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "settings.fetch_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	todos, err := parse(data, s.location(), time.Now())
+	if err != nil {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "import.parse_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	if len(todos) == 0 || len(todos) > maxImportTodos {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "import.count_invalid", maxImportTodos),
+		})
+		return
+	}
+	if !a.checkTodoQuota(ctx, w, r, int64(len(todos))) {
+		return
+	}
+
+	if err := a.todos.CreateMany(ctx, todos); err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "import.failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	a.rnd.JSON(w, http.StatusCreated, render.M{
+		"message": tr(r, "import.done", len(todos)),
+		"count":   len(todos),
+		"_links":  links{"list": {Href: todoBase(r) + "/"}},
+	})
+}
+
+// importJobPayload is a file to import later.
+type importJobPayload struct {
+	Format string `json:"format"`
+	Data   []byte `json:"data"`
+}
+
+// importJobResult is how many todos a finished import created.
+type importJobResult struct {
+	Count int `json:"count"`
+}
+
+// queueImport takes the same request as importTodos, up to
+// maxQueuedImportBytes, and queues the import instead of waiting for it.
+// The file is parsed by the job, so errors in it show up there.
+func (a *app) queueImport(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	format := r.URL.Query().Get("format")
+	if _, ok := importFormats[format]; !ok {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "import.format_invalid", strings.Join(slices.Sorted(maps.Keys(importFormats)), ", ")),
+		})
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxQueuedImportBytes))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		a.rnd.JSON(w, http.StatusRequestEntityTooLarge, render.M{
+			"message": tr(r, "import.too_large", maxQueuedImportBytes>>20),
+		})
+		return
+	}
+	if err != nil {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "request.invalid_body"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	a.queueJob(ctx, w, r, importJob, importJobPayload{Format: format, Data: data})
+}
+
+// runImport handles import jobs. Only a failure before the first batch
+// is created is retried: parsing again would give the todos new IDs and
+// create the earlier batches twice.
+func (a *app) runImport(ctx context.Context, run *jobRun) (interface{}, error) {
+	var p importJobPayload
+	if err := json.Unmarshal(run.Payload, &p); err != nil {
+		return nil, permanent(err)
+	}
+	parse, ok := importFormats[p.Format]
+	if !ok {
+		return nil, permanent(fmt.Errorf("unknown import format %q", p.Format))
+	}
+	s, err := a.settings.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	todos, err := parse(p.Data, s.location(), time.Now())
+	if err != nil {
+		return nil, permanent(err)
+	}
+	if len(todos) == 0 || len(todos) > maxQueuedImportTodos {
+		return nil, permanent(fmt.Errorf("the file must hold between 1 and %d todos, not %d", maxQueuedImportTodos, len(todos)))
+	}
+	if a.cfg.Quotas[quotaMaxTodos] != 0 {
+		q, err := a.todoQuota(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !q.allows(int64(len(todos))) {
+			return nil, permanent(fmt.Errorf("importing %d todos would exceed the %s quota", len(todos), q.Name))
+		}
+	}
+
+	run.Progress(ctx, 0, len(todos))
+	for done := 0; done < len(todos); {
+		batch := todos[done:min(done+maxImportTodos, len(todos))]
+		if err := a.todos.CreateMany(ctx, batch); err != nil {
+			if done == 0 {
+				return nil, err
+			}
+			return nil, permanent(fmt.Errorf("created %d of %d todos: %w", done, len(todos), err))
+		}
+		done += len(batch)
+		run.Progress(ctx, done, len(todos))
+	}
+	return importJobResult{Count: len(todos)}, nil
+}
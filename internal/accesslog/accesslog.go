@@ -0,0 +1,100 @@
+// Package accesslog writes one JSON line per HTTP request.
+package accesslog
+
+import (
+	"encoding/json"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+// Options controls where entries go and how many are kept.
+type Options struct {
+	Output io.Writer
+
+	// SampleRate is the fraction of successful requests to log, from 0 to
+	// 1. Client and server errors are always logged.
+	SampleRate float64
+}
+
+type entry struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id,omitempty"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Status    int       `json:"status"`
+	Bytes     int       `json:"bytes"`
+	Duration  float64   `json:"duration_ms"`
+	Remote    string    `json:"remote"`
+	UserAgent string    `json:"user_agent,omitempty"`
+}
+
+// Open resolves an ACCESS_LOG style destination: "stdout" (or empty),
+// "stderr", "off", or a file path that is appended to.
+func Open(dest string) (io.Writer, error) {
+	switch dest {
+	case "", "stdout":
+		return os.Stdout, nil
+	case "stderr":
+		return os.Stderr, nil
+	case "off":
+		return nil, nil
+	}
+	return os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+}
+
+// Middleware logs each request after it completes. It expects chi's
+// RequestID middleware to run first and echoes the ID in X-Request-ID. A
+// nil Output disables logging.
+func Middleware(opts Options) func(http.Handler) http.Handler {
+	var mu sync.Mutex
+	var enc *json.Encoder
+	if opts.Output != nil {
+		enc = json.NewEncoder(opts.Output)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := middleware.GetReqID(r.Context())
+			if id != "" {
+				w.Header().Set("X-Request-ID", id)
+			}
+			if enc == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			defer func() {
+				status := ww.Status()
+				if status == 0 {
+					status = http.StatusOK
+				}
+				if status < 400 && opts.SampleRate < 1 && rand.Float64() >= opts.SampleRate {
+					return
+				}
+				e := entry{
+					Time:      start.UTC(),
+					RequestID: id,
+					Method:    r.Method,
+					Path:      r.URL.Path,
+					Status:    status,
+					Bytes:     ww.BytesWritten(),
+					Duration:  float64(time.Since(start).Microseconds()) / 1000,
+					Remote:    r.RemoteAddr,
+					UserAgent: r.UserAgent(),
+				}
+				mu.Lock()
+				enc.Encode(e)
+				mu.Unlock()
+			}()
+			next.ServeHTTP(ww, r)
+		})
+	}
+}
@@ -0,0 +1,70 @@
+// Package breaker is a circuit breaker: after enough failures in a row it
+// opens and turns calls away for a cooldown, then lets one probe through
+// to find out whether the dependency is back.
+package breaker
+
+import (
+	"sync"
+	"time"
+)
+
+// Breaker trips after Threshold consecutive failures and stays open for
+// Cooldown. The zero value never trips. It is safe for concurrent use.
+type Breaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// Allow reports whether a call may go ahead. Once the cooldown is over a
+// single call is allowed as the probe; its Success or Failure closes or
+// reopens the breaker.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.openedAt.IsZero() {
+		return true
+	}
+	if b.probing || time.Since(b.openedAt) < b.Cooldown {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// Open reports whether calls are being turned away, without claiming the
+// probe.
+func (b *Breaker) Open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.openedAt.IsZero() {
+		return false
+	}
+	return b.probing || time.Since(b.openedAt) < b.Cooldown
+}
+
+// Success records a call that reached the dependency, closing the
+// breaker.
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.openedAt = time.Time{}
+	b.probing = false
+}
+
+// Failure records a call that didn't. A failed probe, or the Threshold-th
+// failure in a row, opens the breaker for another Cooldown.
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.probing || (b.Threshold > 0 && b.failures >= b.Threshold) {
+		b.openedAt = time.Now()
+		b.probing = false
+	}
+}
@@ -0,0 +1,174 @@
+// Package cron parses the five-field cron expressions of crontab(5) and
+// works out when they next fire.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed expression: a set of allowed values per field.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// Like cron, when both day fields are restricted a day matching
+	// either is enough.
+	domStar, dowStar bool
+	// hourStar schedules run again in the hour a DST change repeats;
+	// others, like cron, only the first time round.
+	hourStar bool
+}
+
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = [...]field{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse reads "minute hour day-of-month month day-of-week", each a *, a
+// number, a range a-b, or a list of those, optionally stepped with /n;
+// or one of the @daily style macros. Sunday is 0 or 7.
+func Parse(expr string) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if m, ok := macros[expr]; ok {
+		expr = m
+	}
+	parts := strings.Fields(expr)
+	if len(parts) != len(fields) {
+		return Schedule{}, fmt.Errorf("cron: %q has %d fields, want %d", expr, len(parts), len(fields))
+	}
+	var sets [len(fields)]uint64
+	for i, p := range parts {
+		set, err := parseField(p, fields[i])
+		if err != nil {
+			return Schedule{}, err
+		}
+		sets[i] = set
+	}
+	// Fold Sunday-as-7 onto 0.
+	if sets[4]&(1<<7) != 0 {
+		sets[4] = sets[4]&^(1<<7) | 1
+	}
+	return Schedule{
+		minute:   sets[0],
+		hour:     sets[1],
+		dom:      sets[2],
+		month:    sets[3],
+		dow:      sets[4],
+		domStar:  strings.HasPrefix(parts[2], "*"),
+		dowStar:  strings.HasPrefix(parts[4], "*"),
+		hourStar: strings.HasPrefix(parts[1], "*"),
+	}, nil
+}
+
+func parseField(s string, f field) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(s, ",") {
+		rng, step := part, 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("cron: bad step in %s %q", f.name, part)
+			}
+			rng, step = part[:i], n
+		}
+		lo, hi := f.min, f.max
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.Atoi(a); err != nil {
+				return 0, fmt.Errorf("cron: bad %s %q", f.name, part)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(b); err != nil {
+					return 0, fmt.Errorf("cron: bad %s %q", f.name, part)
+				}
+			} else if step > 1 {
+				// "5/15" means from 5 to the end, every 15.
+				hi = f.max
+			}
+			if lo < f.min || hi > f.max || lo > hi {
+				return 0, fmt.Errorf("cron: %s %q is outside %d-%d", f.name, part, f.min, f.max)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// Next is the first minute after t, in t's location, that the schedule
+// matches, or the zero time if it never does (such as 30 February). A
+// wall-clock time that DST skips is missed; one it repeats matches once,
+// unless the hour field is *.
+func (s Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// Every valid date recurs within a leap cycle.
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = later(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location()))
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = later(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location()))
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = later(t, time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location()))
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 || !s.hourStar && repeated(t) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// later is next, a wall-clock step forward from t, or an hour past it when
+// a DST change skips that wall-clock time and time.Date has resolved it to
+// one at or before t. Without it Next could step back onto t for ever.
+func later(t, next time.Time) time.Time {
+	if next.After(t) {
+		return next
+	}
+	return next.Add(time.Hour)
+}
+
+// repeated reports whether t's wall-clock time already happened an hour
+// earlier, as it does when clocks go back.
+func repeated(t time.Time) bool {
+	h := t.Add(-time.Hour)
+	return h.Hour() == t.Hour() && h.Minute() == t.Minute()
+}
+
+func (s Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,163 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr bool
+	}{
+		{"* * * * *", false},
+		{"*/15 9-17 * * 1-5", false},
+		{"0,30 * 1,15 * *", false},
+		{"5/15 * * * *", false},
+		{"0 0 * * 7", false},
+		{"@daily", false},
+		{" @hourly ", false},
+		{"* * * *", true},
+		{"* * * * * *", true},
+		{"60 * * * *", true},
+		{"* 24 * * *", true},
+		{"* * 0 * *", true},
+		{"* * * 13 *", true},
+		{"* * * * 8", true},
+		{"5-1 * * * *", true},
+		{"*/0 * * * *", true},
+		{"a * * * *", true},
+		{"@fortnightly", true},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.expr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parse(%q) error = %v, want error %v", tt.expr, err, tt.wantErr)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	utc := func(s string) time.Time {
+		v, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	tests := []struct {
+		expr string
+		from string
+		want string
+	}{
+		{"* * * * *", "2026-01-01 10:00", "2026-01-01 10:01"},
+		{"*/15 * * * *", "2026-01-01 10:07", "2026-01-01 10:15"},
+		{"5/15 * * * *", "2026-01-01 10:36", "2026-01-01 10:50"},
+		{"0 9 * * *", "2026-01-01 09:00", "2026-01-02 09:00"},
+		{"30 23 31 12 *", "2026-06-01 00:00", "2026-12-31 23:30"},
+		{"@monthly", "2026-01-31 12:00", "2026-02-01 00:00"},
+		// 2026-01-01 is a Thursday.
+		{"0 8 * * 1-5", "2026-01-02 09:00", "2026-01-05 08:00"},
+		{"0 0 * * 0", "2026-01-01 00:00", "2026-01-04 00:00"},
+		{"0 0 * * 7", "2026-01-01 00:00", "2026-01-04 00:00"},
+		// Both day fields restricted: either will do.
+		{"0 0 13 * 5", "2026-01-01 00:00", "2026-01-02 00:00"},
+		{"0 0 29 2 *", "2026-01-01 00:00", "2028-02-29 00:00"},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.expr, err)
+		}
+		if got := s.Next(utc(tt.from)); !got.Equal(utc(tt.want)) {
+			t.Errorf("%q Next(%s) = %v, want %s", tt.expr, tt.from, got, tt.want)
+		}
+	}
+}
+
+func TestNextNever(t *testing.T) {
+	s, err := Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Next(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)); !got.IsZero() {
+		t.Errorf("Next = %v, want zero for 30 February", got)
+	}
+}
+
+func TestNextDST(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	// In 2026 New York skips 02:00-03:00 on 8 March and repeats 01:00-02:00
+	// on 1 November.
+	edt, est := time.FixedZone("EDT", -4*3600), time.FixedZone("EST", -5*3600)
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want []time.Time
+	}{
+		{
+			name: "hour after the gap",
+			expr: "0 3 * * *",
+			from: time.Date(2026, 3, 8, 1, 0, 0, 0, est),
+			want: []time.Time{
+				time.Date(2026, 3, 8, 3, 0, 0, 0, edt),
+				time.Date(2026, 3, 9, 3, 0, 0, 0, edt),
+			},
+		},
+		{
+			name: "time in the gap is missed",
+			expr: "30 2 * * *",
+			from: time.Date(2026, 3, 7, 12, 0, 0, 0, est),
+			want: []time.Time{
+				time.Date(2026, 3, 9, 2, 30, 0, 0, edt),
+			},
+		},
+		{
+			name: "hourly steps over the gap",
+			expr: "0 * * * *",
+			from: time.Date(2026, 3, 8, 1, 30, 0, 0, est),
+			want: []time.Time{
+				time.Date(2026, 3, 8, 3, 0, 0, 0, edt),
+				time.Date(2026, 3, 8, 4, 0, 0, 0, edt),
+			},
+		},
+		{
+			name: "fixed hour runs once when repeated",
+			expr: "30 1 * * *",
+			from: time.Date(2026, 10, 31, 12, 0, 0, 0, edt),
+			want: []time.Time{
+				time.Date(2026, 11, 1, 1, 30, 0, 0, edt),
+				time.Date(2026, 11, 2, 1, 30, 0, 0, est),
+			},
+		},
+		{
+			name: "any hour runs in both passes",
+			expr: "30 * * * *",
+			from: time.Date(2026, 11, 1, 1, 0, 0, 0, edt),
+			want: []time.Time{
+				time.Date(2026, 11, 1, 1, 30, 0, 0, edt),
+				time.Date(2026, 11, 1, 1, 30, 0, 0, est),
+				time.Date(2026, 11, 1, 2, 30, 0, 0, est),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			at := tt.from.In(ny)
+			for _, want := range tt.want {
+				at = s.Next(at)
+				if !at.Equal(want) {
+					t.Fatalf("%q: got %v, want %v", tt.expr, at, want.In(ny))
+				}
+			}
+		})
+	}
+}
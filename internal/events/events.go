@@ -0,0 +1,108 @@
+// Package events fans todo lifecycle events out to in-process subscribers
+// such as push hubs, webhook dispatchers and cache invalidation.
+package events
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Type names what happened to the subject.
+type Type string
+
+const (
+	TodoCreated Type = "todo.created"
+	TodoUpdated Type = "todo.updated"
+	TodoDeleted Type = "todo.deleted"
+)
+
+// ContentType is the media type of an encoded event in CloudEvents
+// structured mode.
+const ContentType = "application/cloudevents+json"
+
+// Event is a single change. Data carries the new state of the subject
+// and is nil for deletions. It encodes as a CloudEvents 1.0 envelope, so
+// sinks can send it as is.
+type Event struct {
+	ID      string      `json:"id"`
+	Source  string      `json:"source"`
+	Type    Type        `json:"type"`
+	Subject string      `json:"subject"`
+	Time    time.Time   `json:"time"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e Event) MarshalJSON() ([]byte, error) {
+	type plain Event
+	envelope := struct {
+		SpecVersion     string `json:"specversion"`
+		DataContentType string `json:"datacontenttype,omitempty"`
+		plain
+	}{SpecVersion: "1.0", plain: plain(e)}
+	if e.Data != nil {
+		envelope.DataContentType = "application/json"
+	}
+	return json.Marshal(envelope)
+}
+
+// Bus delivers every published event to all current subscribers. It never
+// blocks publishers: a subscriber that falls behind its buffer misses
+// events, and the miss is counted.
+type Bus struct {
+	mu   sync.RWMutex
+	subs map[*Subscription]struct{}
+}
+
+// Subscription receives events on C until Close is called.
+type Subscription struct {
+	C <-chan Event
+
+	c       chan Event
+	bus     *Bus
+	dropped atomic.Uint64
+	once    sync.Once
+}
+
+func NewBus() *Bus {
+	return &Bus{subs: map[*Subscription]struct{}{}}
+}
+
+// Subscribe registers a subscriber with room for buffer pending events.
+func (b *Bus) Subscribe(buffer int) *Subscription {
+	c := make(chan Event, buffer)
+	s := &Subscription{C: c, c: c, bus: b}
+	b.mu.Lock()
+	b.subs[s] = struct{}{}
+	b.mu.Unlock()
+	return s
+}
+
+// Publish hands e to every subscriber that has room for it.
+func (b *Bus) Publish(e Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for s := range b.subs {
+		select {
+		case s.c <- e:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+// Dropped returns how many events this subscriber missed.
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close unsubscribes and closes C.
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.bus.mu.Lock()
+		delete(s.bus.subs, s)
+		s.bus.mu.Unlock()
+		close(s.c)
+	})
+}
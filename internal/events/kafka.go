@@ -0,0 +1,47 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Kafka writes each event to Topic, keyed by subject so all events for one
+// todo land on the same partition in order. A send succeeds once every
+// in-sync replica has the message.
+type Kafka struct {
+	w *kafka.Writer
+}
+
+func NewKafka(brokers []string, topic string) *Kafka {
+	return &Kafka{w: &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		// Events are sent one at a time; don't hold them back for a batch.
+		BatchTimeout: 10 * time.Millisecond,
+	}}
+}
+
+func (k *Kafka) Name() string {
+	return "kafka"
+}
+
+func (k *Kafka) Send(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return k.w.WriteMessages(ctx, kafka.Message{
+		Key:     []byte(e.Subject),
+		Value:   body,
+		Headers: []kafka.Header{{Key: "content-type", Value: []byte(ContentType)}},
+	})
+}
+
+func (k *Kafka) Close() error {
+	return k.w.Close()
+}
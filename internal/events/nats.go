@@ -0,0 +1,52 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NATS publishes each event to Subject.<event type>, e.g.
+// "events.todo.created", and waits for the server to acknowledge the
+// flush before reporting it delivered.
+type NATS struct {
+	Subject string
+	conn    *nats.Conn
+}
+
+// DialNATS connects to url. It does not fail when the server is down;
+// the client keeps reconnecting and sends fail until it is back.
+func DialNATS(url, subject string) (*NATS, error) {
+	conn, err := nats.Connect(url,
+		nats.Name("todo"),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, err
+	}
+	return &NATS{Subject: subject, conn: conn}, nil
+}
+
+func (n *NATS) Name() string {
+	return "nats"
+}
+
+func (n *NATS) Send(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	msg := nats.NewMsg(n.Subject + "." + string(e.Type))
+	msg.Header.Set(nats.MsgIdHdr, e.ID)
+	msg.Header.Set("Content-Type", ContentType)
+	msg.Data = body
+	if err := n.conn.PublishMsg(msg); err != nil {
+		return err
+	}
+	return n.conn.FlushWithContext(ctx)
+}
+
+func (n *NATS) Close() error {
+	return n.conn.Drain()
+}
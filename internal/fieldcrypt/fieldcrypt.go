@@ -0,0 +1,103 @@
+// Package fieldcrypt encrypts individual document fields with AES-GCM so
+// they are stored as ciphertext at rest.
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// prefix marks encrypted values so plaintext written before encryption was
+// enabled can still be read.
+const prefix = "enc:v1:"
+
+// ErrMalformed is returned for encrypted values that can't be decoded.
+var ErrMalformed = errors.New("fieldcrypt: malformed ciphertext")
+
+// Cipher encrypts and decrypts field values. A nil *Cipher passes values
+// through unchanged, which is how encryption is disabled.
+type Cipher struct {
+	aead cipher.AEAD
+	// indexKey keys BlindIndex. It is derived from the encryption key
+	// so one secret covers both.
+	indexKey []byte
+}
+
+// New returns a Cipher for a 16, 24 or 32 byte AES key.
+func New(key []byte) (*Cipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("fieldcrypt: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("fieldcrypt: %w", err)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("fieldcrypt blind index"))
+	return &Cipher{aead: aead, indexKey: mac.Sum(nil)}, nil
+}
+
+// NewFromBase64 is New for a base64-encoded key, as found in configuration.
+func NewFromBase64(key string) (*Cipher, error) {
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("fieldcrypt: key is not valid base64: %w", err)
+	}
+	return New(raw)
+}
+
+// Encrypt seals plaintext. aad binds the ciphertext to its context (for
+// example the document ID and field name) so it can't be moved elsewhere.
+func (c *Cipher) Encrypt(plaintext string, aad []byte) (string, error) {
+	if c == nil {
+		return plaintext, nil
+	}
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(plaintext), aad)
+	return prefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// BlindIndex is a keyed hash of value, so encrypted fields can still be
+// matched for equality. Equal values give equal indexes and nothing else
+// about them can be learned without the key. A nil Cipher returns value
+// unchanged.
+func (c *Cipher) BlindIndex(value string) string {
+	if c == nil {
+		return value
+	}
+	mac := hmac.New(sha256.New, c.indexKey)
+	mac.Write([]byte(value))
+	return base64.RawStdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Decrypt opens a value produced by Encrypt with the same aad. Values
+// without the encryption prefix are returned as is.
+func (c *Cipher) Decrypt(value string, aad []byte) (string, error) {
+	if !strings.HasPrefix(value, prefix) {
+		return value, nil
+	}
+	if c == nil {
+		return "", errors.New("fieldcrypt: value is encrypted but no key is configured")
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(value, prefix))
+	if err != nil || len(sealed) < c.aead.NonceSize() {
+		return "", ErrMalformed
+	}
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return "", fmt.Errorf("fieldcrypt: %w", err)
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,136 @@
+// Package i18n provides message catalogs and Accept-Language negotiation
+// for API responses and the rendered web UI.
+package i18n
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// DefaultLanguage is served when the client asks for nothing we have and
+// is the fallback for keys missing from other catalogs.
+var DefaultLanguage = language.English
+
+//go:embed locales/*.json
+var locales embed.FS
+
+type ctxKey struct{}
+
+// Bundle holds every loaded catalog and the matcher used to pick one.
+type Bundle struct {
+	tags     []language.Tag
+	matcher  language.Matcher
+	catalogs map[language.Tag]map[string]string
+}
+
+// Localizer translates message keys for a single negotiated language.
+type Localizer struct {
+	tag      language.Tag
+	messages map[string]string
+	fallback map[string]string
+}
+
+// NewBundle loads the embedded locales/<lang>.json catalogs.
+func NewBundle() (*Bundle, error) {
+	files, err := fs.Glob(locales, "locales/*.json")
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Bundle{catalogs: map[language.Tag]map[string]string{}}
+	for _, file := range files {
+		tag, err := language.Parse(strings.TrimSuffix(path.Base(file), ".json"))
+		if err != nil {
+			return nil, fmt.Errorf("i18n: %s: %w", file, err)
+		}
+		data, err := locales.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		messages := map[string]string{}
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return nil, fmt.Errorf("i18n: %s: %w", file, err)
+		}
+		b.catalogs[tag] = messages
+		// The matcher treats the first tag as the fallback.
+		if tag == DefaultLanguage {
+			b.tags = append([]language.Tag{tag}, b.tags...)
+		} else {
+			b.tags = append(b.tags, tag)
+		}
+	}
+	if _, ok := b.catalogs[DefaultLanguage]; !ok {
+		return nil, fmt.Errorf("i18n: no catalog for default language %s", DefaultLanguage)
+	}
+	b.matcher = language.NewMatcher(b.tags)
+	return b, nil
+}
+
+// Localizer negotiates the best catalog for the given Accept-Language values.
+func (b *Bundle) Localizer(accept ...string) *Localizer {
+	_, i := language.MatchStrings(b.matcher, accept...)
+	tag := b.tags[i]
+	return &Localizer{
+		tag:      tag,
+		messages: b.catalogs[tag],
+		fallback: b.catalogs[DefaultLanguage],
+	}
+}
+
+// Lang returns the BCP 47 tag of the negotiated language.
+func (l *Localizer) Lang() string {
+	if l == nil {
+		return DefaultLanguage.String()
+	}
+	return l.tag.String()
+}
+
+// T returns the message for key, formatted with args when given. Unknown
+// keys fall back to the default language and then to the key itself.
+func (l *Localizer) T(key string, args ...interface{}) string {
+	msg := key
+	if l != nil {
+		if m, ok := l.messages[key]; ok {
+			msg = m
+		} else if m, ok := l.fallback[key]; ok {
+			msg = m
+		}
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
+
+// Middleware negotiates a Localizer per request and stores it in the context.
+func Middleware(b *Bundle) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			l := b.Localizer(r.Header.Get("Accept-Language"))
+			w.Header().Set("Content-Language", l.Lang())
+			w.Header().Add("Vary", "Accept-Language")
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), l)))
+		})
+	}
+}
+
+// NewContext returns a copy of ctx carrying l, for work done outside a
+// request in its caller's language.
+func NewContext(ctx context.Context, l *Localizer) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext returns the request's Localizer, or nil when the middleware
+// did not run. A nil Localizer returns keys untranslated.
+func FromContext(ctx context.Context) *Localizer {
+	l, _ := ctx.Value(ctxKey{}).(*Localizer)
+	return l
+}
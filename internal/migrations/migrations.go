@@ -0,0 +1,200 @@
+// Package migrations applies versioned schema changes to a MongoDB
+// database and records which ones have run, so every environment can be
+// brought to the same version and, if needed, rolled back.
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Collection holds one document per applied migration plus the lock.
+const Collection = "schema_migrations"
+
+const (
+	lockID = "lock"
+
+	// lockTTL bounds how long a crashed run can block the next one.
+	lockTTL = 10 * time.Minute
+)
+
+// ErrLocked is returned when another run holds the migration lock.
+var ErrLocked = errors.New("migrations: another migration is in progress")
+
+// Migration is one schema change. Up and Down should be idempotent: a run
+// that fails part way records nothing, so the step is retried in full.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, db *mongo.Database) error
+	Down    func(ctx context.Context, db *mongo.Database) error
+}
+
+// Status describes one known migration.
+type Status struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+type record struct {
+	Version   int       `bson:"_id"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"applied_at"`
+}
+
+// Migrator runs a fixed set of migrations against db.
+type Migrator struct {
+	db         *mongo.Database
+	coll       *mongo.Collection
+	migrations []Migration
+}
+
+// New checks that versions are positive and unique and sorts them.
+func New(db *mongo.Database, ms []Migration) (*Migrator, error) {
+	sorted := append([]Migration(nil), ms...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	for i, m := range sorted {
+		if m.Version <= 0 {
+			return nil, fmt.Errorf("migrations: %q has non-positive version %d", m.Name, m.Version)
+		}
+		if i > 0 && sorted[i-1].Version == m.Version {
+			return nil, fmt.Errorf("migrations: version %d used by %q and %q", m.Version, sorted[i-1].Name, m.Name)
+		}
+		if m.Up == nil {
+			return nil, fmt.Errorf("migrations: %d %q has no Up", m.Version, m.Name)
+		}
+	}
+	return &Migrator{db: db, coll: db.Collection(Collection), migrations: sorted}, nil
+}
+
+// Latest is the highest known version, or 0 when there are none.
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int]record, error) {
+	cursor, err := m.coll.Find(ctx, bson.M{"_id": bson.M{"$type": "number"}})
+	if err != nil {
+		return nil, err
+	}
+	var recs []record
+	if err := cursor.All(ctx, &recs); err != nil {
+		return nil, err
+	}
+	out := make(map[int]record, len(recs))
+	for _, r := range recs {
+		out[r.Version] = r
+	}
+	return out, nil
+}
+
+// Status lists every known migration and when it was applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Status, len(m.migrations))
+	for i, mg := range m.migrations {
+		out[i] = Status{Version: mg.Version, Name: mg.Name}
+		if r, ok := applied[mg.Version]; ok {
+			at := r.AppliedAt
+			out[i].AppliedAt = &at
+		}
+	}
+	return out, nil
+}
+
+// Up applies every pending migration up to and including target; a
+// target of 0 means all of them. It returns the versions it applied.
+func (m *Migrator) Up(ctx context.Context, target int) ([]int, error) {
+	if target == 0 {
+		target = m.Latest()
+	}
+	var done []int
+	err := m.locked(ctx, func() error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+		for _, mg := range m.migrations {
+			if mg.Version > target {
+				break
+			}
+			if _, ok := applied[mg.Version]; ok {
+				continue
+			}
+			if err := mg.Up(ctx, m.db); err != nil {
+				return fmt.Errorf("migrations: %d %s up: %w", mg.Version, mg.Name, err)
+			}
+			if _, err := m.coll.InsertOne(ctx, record{Version: mg.Version, Name: mg.Name, AppliedAt: time.Now()}); err != nil {
+				return err
+			}
+			done = append(done, mg.Version)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down rolls back applied migrations above target, newest first, and
+// returns the versions it reverted.
+func (m *Migrator) Down(ctx context.Context, target int) ([]int, error) {
+	var done []int
+	err := m.locked(ctx, func() error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			mg := m.migrations[i]
+			if mg.Version <= target {
+				break
+			}
+			if _, ok := applied[mg.Version]; !ok {
+				continue
+			}
+			if mg.Down == nil {
+				return fmt.Errorf("migrations: %d %s cannot be rolled back", mg.Version, mg.Name)
+			}
+			if err := mg.Down(ctx, m.db); err != nil {
+				return fmt.Errorf("migrations: %d %s down: %w", mg.Version, mg.Name, err)
+			}
+			if _, err := m.coll.DeleteOne(ctx, bson.M{"_id": mg.Version}); err != nil {
+				return err
+			}
+			done = append(done, mg.Version)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// locked runs fn while holding the migration lock. A lock older than
+// lockTTL is taken over.
+func (m *Migrator) locked(ctx context.Context, fn func() error) error {
+	now := time.Now()
+	_, err := m.coll.UpdateOne(ctx,
+		bson.M{"_id": lockID, "expires_at": bson.M{"$lt": now}},
+		bson.M{"$set": bson.M{"expires_at": now.Add(lockTTL)}},
+		options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrLocked
+	}
+	if err != nil {
+		return err
+	}
+	defer m.coll.DeleteOne(context.WithoutCancel(ctx), bson.M{"_id": lockID})
+	return fn()
+}
@@ -0,0 +1,265 @@
+// Package msgpack encodes Go values as MessagePack. It covers what the API
+// sends: scalars, strings, byte slices, slices, maps, structs (using their
+// json tags for field names) and time.Time as the timestamp extension.
+package msgpack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Marshal returns the MessagePack encoding of v.
+func Marshal(v interface{}) ([]byte, error) {
+	var e encoder
+	if err := e.encode(reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return e.buf.Bytes(), nil
+}
+
+type encoder struct {
+	buf bytes.Buffer
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (e *encoder) encode(v reflect.Value) error {
+	if !v.IsValid() {
+		e.buf.WriteByte(0xc0)
+		return nil
+	}
+	if v.Type() == timeType {
+		e.writeTime(v.Interface().(time.Time))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			e.buf.WriteByte(0xc0)
+			return nil
+		}
+		return e.encode(v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf.WriteByte(0xc3)
+		} else {
+			e.buf.WriteByte(0xc2)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.writeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.writeUint(v.Uint())
+	case reflect.Float32:
+		e.buf.WriteByte(0xca)
+		e.be(uint64(math.Float32bits(float32(v.Float()))), 4)
+	case reflect.Float64:
+		e.buf.WriteByte(0xcb)
+		e.be(math.Float64bits(v.Float()), 8)
+	case reflect.String:
+		e.writeString(v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			e.buf.WriteByte(0xc0)
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			e.writeBin(v.Bytes())
+			return nil
+		}
+		return e.writeArray(v)
+	case reflect.Array:
+		return e.writeArray(v)
+	case reflect.Map:
+		if v.IsNil() {
+			e.buf.WriteByte(0xc0)
+			return nil
+		}
+		e.writeLen(v.Len(), 0x80, 0xde, 0xdf)
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := e.encode(iter.Key()); err != nil {
+				return err
+			}
+			if err := e.encode(iter.Value()); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		return e.writeStruct(v)
+	default:
+		return fmt.Errorf("msgpack: unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+func (e *encoder) be(n uint64, size int) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], n)
+	e.buf.Write(b[8-size:])
+}
+
+func (e *encoder) writeInt(n int64) {
+	switch {
+	case n >= 0:
+		e.writeUint(uint64(n))
+	case n >= -32:
+		e.buf.WriteByte(byte(n))
+	case n >= math.MinInt8:
+		e.buf.WriteByte(0xd0)
+		e.buf.WriteByte(byte(n))
+	case n >= math.MinInt16:
+		e.buf.WriteByte(0xd1)
+		e.be(uint64(n), 2)
+	case n >= math.MinInt32:
+		e.buf.WriteByte(0xd2)
+		e.be(uint64(n), 4)
+	default:
+		e.buf.WriteByte(0xd3)
+		e.be(uint64(n), 8)
+	}
+}
+
+func (e *encoder) writeUint(n uint64) {
+	switch {
+	case n <= 0x7f:
+		e.buf.WriteByte(byte(n))
+	case n <= math.MaxUint8:
+		e.buf.WriteByte(0xcc)
+		e.buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		e.buf.WriteByte(0xcd)
+		e.be(n, 2)
+	case n <= math.MaxUint32:
+		e.buf.WriteByte(0xce)
+		e.be(n, 4)
+	default:
+		e.buf.WriteByte(0xcf)
+		e.be(n, 8)
+	}
+}
+
+// writeLen writes a map or array header: fix is the fixmap/fixarray
+// prefix, b16 and b32 the 16- and 32-bit length markers.
+func (e *encoder) writeLen(n int, fix, b16, b32 byte) {
+	switch {
+	case n < 16:
+		e.buf.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16:
+		e.buf.WriteByte(b16)
+		e.be(uint64(n), 2)
+	default:
+		e.buf.WriteByte(b32)
+		e.be(uint64(n), 4)
+	}
+}
+
+func (e *encoder) writeString(s string) {
+	n := len(s)
+	switch {
+	case n < 32:
+		e.buf.WriteByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		e.buf.WriteByte(0xd9)
+		e.buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		e.buf.WriteByte(0xda)
+		e.be(uint64(n), 2)
+	default:
+		e.buf.WriteByte(0xdb)
+		e.be(uint64(n), 4)
+	}
+	e.buf.WriteString(s)
+}
+
+func (e *encoder) writeBin(b []byte) {
+	n := len(b)
+	switch {
+	case n <= math.MaxUint8:
+		e.buf.WriteByte(0xc4)
+		e.buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		e.buf.WriteByte(0xc5)
+		e.be(uint64(n), 2)
+	default:
+		e.buf.WriteByte(0xc6)
+		e.be(uint64(n), 4)
+	}
+	e.buf.Write(b)
+}
+
+func (e *encoder) writeArray(v reflect.Value) error {
+	e.writeLen(v.Len(), 0x90, 0xdc, 0xdd)
+	for i := 0; i < v.Len(); i++ {
+		if err := e.encode(v.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeTime uses the timestamp extension (type -1) in its 32, 64 or 96
+// bit form, whichever is the smallest that fits.
+func (e *encoder) writeTime(t time.Time) {
+	sec, nsec := t.Unix(), int64(t.Nanosecond())
+	switch {
+	case sec>>34 == 0 && nsec == 0 && sec <= math.MaxUint32:
+		e.buf.Write([]byte{0xd6, 0xff})
+		e.be(uint64(sec), 4)
+	case sec>>34 == 0:
+		e.buf.Write([]byte{0xd7, 0xff})
+		e.be(uint64(nsec)<<34|uint64(sec), 8)
+	default:
+		e.buf.Write([]byte{0xc7, 12, 0xff})
+		e.be(uint64(nsec), 4)
+		e.be(uint64(sec), 8)
+	}
+}
+
+type field struct {
+	name      string
+	index     int
+	omitEmpty bool
+}
+
+func structFields(t reflect.Type) []field {
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, field{name: name, index: i, omitEmpty: strings.Contains(","+opts+",", ",omitempty,")})
+	}
+	return fields
+}
+
+func (e *encoder) writeStruct(v reflect.Value) error {
+	var present []field
+	for _, f := range structFields(v.Type()) {
+		if f.omitEmpty && v.Field(f.index).IsZero() {
+			continue
+		}
+		present = append(present, f)
+	}
+	e.writeLen(len(present), 0x80, 0xde, 0xdf)
+	for _, f := range present {
+		e.writeString(f.name)
+		if err := e.encode(v.Field(f.index)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
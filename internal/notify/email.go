@@ -0,0 +1,66 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTP is the mail server Email sends through. Without a Username it sends
+// unauthenticated, which most servers only allow from inside the network.
+type SMTP struct {
+	Addr     string // host:port
+	From     string
+	Username string
+	Password string
+}
+
+// Email sends each message to To through Server. net/smtp upgrades to TLS
+// when the server offers STARTTLS, and refuses to send credentials over
+// an unencrypted connection to anything but localhost.
+type Email struct {
+	Server SMTP
+	To     string
+}
+
+func (e *Email) Notify(ctx context.Context, m Message) error {
+	if e.Server.Addr == "" {
+		return fmt.Errorf("notify: no SMTP server configured")
+	}
+	host, _, err := net.SplitHostPort(e.Server.Addr)
+	if err != nil {
+		return fmt.Errorf("notify: SMTP address: %w", err)
+	}
+	var auth smtp.Auth
+	if e.Server.Username != "" {
+		auth = smtp.PlainAuth("", e.Server.Username, e.Server.Password, host)
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", e.Server.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", e.To)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", m.Time.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(m.Body, "\n", "\r\n"))
+	msg.WriteString("\r\n")
+
+	// smtp.SendMail takes no context, so the send runs on and its result is
+	// dropped if ctx ends first.
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(e.Server.Addr, auth, e.Server.From, []string{e.To}, []byte(msg.String()))
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,113 @@
+// Package notify sends short messages to people over email, chat apps and
+// webhooks. Each channel is a Notifier; the app decides which channels
+// hear about which events.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Message is one notification. Event names what prompted it, e.g.
+// "reminder", so receivers can route or filter on it.
+type Message struct {
+	Event   string    `json:"event"`
+	Subject string    `json:"subject"`
+	Body    string    `json:"body"`
+	Time    time.Time `json:"time"`
+}
+
+// text is the message as a single block of plain text, for channels
+// without a separate subject.
+func (m Message) text() string {
+	if m.Body == "" {
+		return m.Subject
+	}
+	return m.Subject + "\n" + m.Body
+}
+
+// Notifier delivers messages to one destination.
+type Notifier interface {
+	Notify(ctx context.Context, m Message) error
+}
+
+// Webhook POSTs each message as JSON to URL. Any 2xx response counts as
+// delivered.
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+func (w *Webhook) Notify(ctx context.Context, m Message) error {
+	return postJSON(ctx, w.Client, w.URL, m)
+}
+
+// Slack posts to a Slack incoming webhook.
+type Slack struct {
+	WebhookURL string
+	Client     *http.Client
+}
+
+func (s *Slack) Notify(ctx context.Context, m Message) error {
+	return postJSON(ctx, s.Client, s.WebhookURL, map[string]string{"text": m.text()})
+}
+
+// telegramAPI is the Bot API base URL; the bot token follows it.
+const telegramAPI = "https://api.telegram.org/bot"
+
+// Telegram sends messages from a bot to one chat. The bot must already be
+// a member of the chat, or the user must have started it.
+type Telegram struct {
+	Token  string
+	ChatID string
+	Client *http.Client
+}
+
+func (t *Telegram) Notify(ctx context.Context, m Message) error {
+	return postJSON(ctx, t.Client, telegramAPI+t.Token+"/sendMessage", map[string]string{
+		"chat_id": t.ChatID,
+		"text":    m.text(),
+	})
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		// The URL may hold a token; report the host only.
+		return fmt.Errorf("notify: POST %s: %w", req.URL.Host, unwrapURLError(err))
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("notify: POST %s: %s", req.URL.Host, resp.Status)
+	}
+	return nil
+}
+
+// unwrapURLError drops the *url.Error wrapper, whose message repeats the
+// full URL.
+func unwrapURLError(err error) error {
+	if ue, ok := err.(*url.Error); ok {
+		return ue.Err
+	}
+	return err
+}
@@ -0,0 +1,109 @@
+// Package ratelimit counts requests per key in fixed windows.
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit allows Requests per Per. A zero Requests means unlimited.
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// ParseLimit reads "<requests>/<duration>", e.g. "60/1m", or "0" for
+// unlimited. A window allows at least one request: "0/1m" is rejected
+// rather than read as either unlimited or closed.
+func ParseLimit(s string) (Limit, error) {
+	if s == "0" || s == "unlimited" {
+		return Limit{}, nil
+	}
+	n, per, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("ratelimit: %q is not <requests>/<duration>", s)
+	}
+	requests, err := strconv.Atoi(n)
+	if err != nil || requests < 1 {
+		return Limit{}, fmt.Errorf("ratelimit: %q has an invalid request count", s)
+	}
+	d, err := time.ParseDuration(per)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("ratelimit: %q has an invalid duration", s)
+	}
+	return Limit{Requests: requests, Per: d}, nil
+}
+
+func (l Limit) Unlimited() bool {
+	return l.Requests == 0
+}
+
+// Result is the outcome of one Allow call.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+type window struct {
+	start time.Time
+	end   time.Time
+	count int
+}
+
+// Limiter keeps one window per key in memory, so limits apply per process.
+type Limiter struct {
+	mu        sync.Mutex
+	windows   map[string]*window
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func New() *Limiter {
+	return &Limiter{windows: map[string]*window{}, now: time.Now}
+}
+
+// Allow counts one request for key against lim.
+func (l *Limiter) Allow(key string, lim Limit) Result {
+	if lim.Unlimited() {
+		return Result{Allowed: true}
+	}
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+
+	w := l.windows[key]
+	if w == nil || !now.Before(w.end) {
+		start := now.Truncate(lim.Per)
+		w = &window{start: start, end: start.Add(lim.Per)}
+		l.windows[key] = w
+	}
+	res := Result{Limit: lim.Requests, Reset: w.end}
+	if w.count >= lim.Requests {
+		return res
+	}
+	w.count++
+	res.Allowed = true
+	res.Remaining = lim.Requests - w.count
+	return res
+}
+
+// sweep drops expired windows at most once a minute so idle keys don't
+// accumulate.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for k, w := range l.windows {
+		if !now.Before(w.end) {
+			delete(l.windows, k)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Limit
+		wantErr bool
+	}{
+		{"60/1m", Limit{Requests: 60, Per: time.Minute}, false},
+		{"1/1s", Limit{Requests: 1, Per: time.Second}, false},
+		{"0", Limit{}, false},
+		{"unlimited", Limit{}, false},
+		{"0/1m", Limit{}, true},
+		{"-1/1m", Limit{}, true},
+		{"60", Limit{}, true},
+		{"60/0s", Limit{}, true},
+		{"60/soon", Limit{}, true},
+		{"many/1m", Limit{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLimit(tt.spec)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseLimit(%q) = %+v, %v; want %+v, error %v", tt.spec, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package render
+
+import (
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Negotiate picks the offer the Accept header prefers, honouring q-values
+// and type/* or */* wildcards. Offers earlier in the list win ties, and
+// the first offer is the answer when Accept is empty. It returns "" when
+// the client accepts none of them.
+func Negotiate(accept string, offers ...string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+	if strings.TrimSpace(accept) == "" {
+		return offers[0]
+	}
+
+	type rangeQ struct {
+		typ, sub string
+		q        float64
+	}
+	var ranges []rangeQ
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		typ, sub, _ := strings.Cut(mt, "/")
+		ranges = append(ranges, rangeQ{typ, sub, q})
+	}
+	// More specific ranges decide an offer's q before wildcards do.
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return specificity(ranges[i].typ, ranges[i].sub) > specificity(ranges[j].typ, ranges[j].sub)
+	})
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		typ, sub, _ := strings.Cut(offer, "/")
+		for _, r := range ranges {
+			if (r.typ == "*" || r.typ == typ) && (r.sub == "*" || r.sub == sub) {
+				if r.q > bestQ {
+					best, bestQ = offer, r.q
+				}
+				break
+			}
+		}
+	}
+	return best
+}
+
+func specificity(typ, sub string) int {
+	switch {
+	case typ == "*":
+		return 0
+	case sub == "*":
+		return 1
+	}
+	return 2
+}
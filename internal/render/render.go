@@ -0,0 +1,157 @@
+// Package render writes JSON, XML, MessagePack and html/template responses.
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"html/template"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"todo/internal/msgpack"
+)
+
+const (
+	ContentJSON    = "application/json; charset=utf-8"
+	ContentHTML    = "text/html; charset=utf-8"
+	ContentXML     = "application/xml; charset=utf-8"
+	ContentMsgPack = "application/msgpack"
+)
+
+// M is a convenience type for ad-hoc JSON objects.
+type M map[string]interface{}
+
+// Options configures a Render.
+type Options struct {
+	// Reload re-parses templates on every call instead of caching them,
+	// so edits show up without a restart during development.
+	Reload bool
+	// FuncMap is made available to every template.
+	FuncMap template.FuncMap
+}
+
+// Render encodes responses. Output is buffered so that an encoding or
+// template error never leaves a half-written body behind.
+type Render struct {
+	opts Options
+
+	mu        sync.RWMutex
+	templates map[string]*template.Template
+}
+
+// New returns a Render configured with opts.
+func New(opts Options) *Render {
+	return &Render{
+		opts:      opts,
+		templates: map[string]*template.Template{},
+	}
+}
+
+// JSON writes v as a JSON body with the given status.
+func (r *Render) JSON(w http.ResponseWriter, status int, v interface{}) error {
+	return r.JSONType(w, status, ContentJSON, v)
+}
+
+// JSONType is JSON with another content type, for JSON-based media types
+// such as application/vnd.api+json.
+func (r *Render) JSONType(w http.ResponseWriter, status int, contentType string, v interface{}) error {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		r.fail(w, err)
+		return err
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// XML writes v, which must be a struct or slice encoding/xml understands,
+// as an XML document with the given status.
+func (r *Render) XML(w http.ResponseWriter, status int, v interface{}) error {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	if err := xml.NewEncoder(&buf).Encode(v); err != nil {
+		r.fail(w, err)
+		return err
+	}
+	w.Header().Set("Content-Type", ContentXML)
+	w.WriteHeader(status)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// MsgPack writes v as a MessagePack body with the given status.
+func (r *Render) MsgPack(w http.ResponseWriter, status int, v interface{}) error {
+	b, err := msgpack.Marshal(v)
+	if err != nil {
+		r.fail(w, err)
+		return err
+	}
+	w.Header().Set("Content-Type", ContentMsgPack)
+	w.WriteHeader(status)
+	_, err = w.Write(b)
+	return err
+}
+
+// Template executes the first of files, with the rest available to it as
+// associated templates.
+func (r *Render) Template(w http.ResponseWriter, status int, files []string, v interface{}) error {
+	return r.Fragment(w, status, files, filepath.Base(files[0]), v)
+}
+
+// Fragment executes the template called name (typically a {{define}} block)
+// from the set parsed out of files, for partial page updates.
+func (r *Render) Fragment(w http.ResponseWriter, status int, files []string, name string, v interface{}) error {
+	t, err := r.lookup(files)
+	if err != nil {
+		r.fail(w, err)
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := t.ExecuteTemplate(&buf, name, v); err != nil {
+		r.fail(w, err)
+		return err
+	}
+	w.Header().Set("Content-Type", ContentHTML)
+	w.WriteHeader(status)
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+func (r *Render) lookup(files []string) (*template.Template, error) {
+	if r.opts.Reload {
+		return r.parse(files)
+	}
+
+	key := strings.Join(files, "\x00")
+	r.mu.RLock()
+	t, ok := r.templates[key]
+	r.mu.RUnlock()
+	if ok {
+		return t, nil
+	}
+
+	t, err := r.parse(files)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	r.templates[key] = t
+	r.mu.Unlock()
+	return t, nil
+}
+
+func (r *Render) parse(files []string) (*template.Template, error) {
+	return template.New(filepath.Base(files[0])).Funcs(r.opts.FuncMap).ParseFiles(files...)
+}
+
+func (r *Render) fail(w http.ResponseWriter, err error) {
+	log.Println("render:", err)
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
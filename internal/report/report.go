@@ -0,0 +1,128 @@
+// Package report forwards recovered panics to an external error tracker.
+package report
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Panic is a recovered panic with the request it happened in.
+type Panic struct {
+	Value     interface{}
+	Stack     []uintptr
+	RequestID string
+	Method    string
+	URL       string
+}
+
+// Reporter sends a panic somewhere a human will see it.
+type Reporter interface {
+	Report(ctx context.Context, p Panic) error
+}
+
+// Callers captures the stack of the function that calls it, skipping skip
+// extra frames, for Panic.Stack.
+func Callers(skip int) []uintptr {
+	pc := make([]uintptr, 64)
+	return pc[:runtime.Callers(skip+2, pc)]
+}
+
+// Sentry posts events to a Sentry-compatible store endpoint.
+type Sentry struct {
+	endpoint string
+	key      string
+	Client   *http.Client
+}
+
+// NewSentry parses a DSN of the form https://<key>@<host>/<project>.
+func NewSentry(dsn string) (*Sentry, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("report: invalid DSN: %w", err)
+	}
+	project := strings.Trim(u.Path, "/")
+	if u.User == nil || u.User.Username() == "" || project == "" {
+		return nil, fmt.Errorf("report: DSN must look like https://key@host/project")
+	}
+	prefix := ""
+	if i := strings.LastIndex(project, "/"); i >= 0 {
+		prefix, project = "/"+project[:i], project[i+1:]
+	}
+	return &Sentry{
+		endpoint: fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, prefix, project),
+		key:      u.User.Username(),
+		Client:   &http.Client{Timeout: 5 * time.Second},
+	}, nil
+}
+
+type sentryFrame struct {
+	Function string `json:"function"`
+	Filename string `json:"filename"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+func (s *Sentry) Report(ctx context.Context, p Panic) error {
+	// Sentry wants the outermost frame first.
+	var frames []sentryFrame
+	it := runtime.CallersFrames(p.Stack)
+	for {
+		f, more := it.Next()
+		frames = append([]sentryFrame{{
+			Function: f.Function,
+			Filename: f.File,
+			Lineno:   f.Line,
+			InApp:    !strings.HasPrefix(f.Function, "runtime.") && !strings.Contains(f.Function, "/go-chi/"),
+		}}, frames...)
+		if !more {
+			break
+		}
+	}
+
+	id := make([]byte, 16)
+	rand.Read(id)
+	event := map[string]interface{}{
+		"event_id":  hex.EncodeToString(id),
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+		"level":     "fatal",
+		"platform":  "go",
+		"exception": map[string]interface{}{
+			"values": []interface{}{map[string]interface{}{
+				"type":       fmt.Sprintf("%T", p.Value),
+				"value":      fmt.Sprint(p.Value),
+				"stacktrace": map[string]interface{}{"frames": frames},
+			}},
+		},
+		"request": map[string]string{"method": p.Method, "url": p.URL},
+		"tags":    map[string]string{"request_id": p.RequestID},
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", fmt.Sprintf("Sentry sentry_version=7, sentry_client=todo/1.0, sentry_key=%s", s.key))
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("report: sentry responded %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+// Package respcache keeps copies of responses up to a byte budget,
+// dropping the least recently used first.
+package respcache
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Entry is a stored response.
+type Entry struct {
+	Status int
+	Header http.Header
+	Body   []byte
+	Stored time.Time
+}
+
+// Cache is safe for concurrent use.
+type Cache struct {
+	maxBytes int
+
+	mu    sync.Mutex
+	size  int
+	order *list.List // of *item, most recently used first
+	items map[string]*list.Element
+}
+
+type item struct {
+	key   string
+	entry Entry
+}
+
+// New returns a cache holding at most maxBytes of response bodies.
+func New(maxBytes int) *Cache {
+	return &Cache{maxBytes: maxBytes, order: list.New(), items: map[string]*list.Element{}}
+}
+
+// Get returns the entry stored under key.
+func (c *Cache) Get(key string) (Entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return Entry{}, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*item).entry, true
+}
+
+// Put stores e under key, replacing what was there. An entry larger than
+// the whole budget isn't kept.
+func (c *Cache) Put(key string, e Entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	if len(e.Body) > c.maxBytes {
+		return
+	}
+	c.items[key] = c.order.PushFront(&item{key, e})
+	c.size += len(e.Body)
+	for c.size > c.maxBytes {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *Cache) remove(el *list.Element) {
+	it := c.order.Remove(el).(*item)
+	delete(c.items, it.key)
+	c.size -= len(it.entry.Body)
+}
@@ -0,0 +1,75 @@
+// Package secrets resolves configuration values that refer to an external
+// secret store instead of holding the secret itself.
+//
+// A value of the form "<scheme>:<reference>" is looked up with the provider
+// registered for scheme, for example
+//
+//	MONGODB_URI=vault:secret/data/todo#mongodb_uri
+//	MONGODB_URI=ssm:/todo/prod/mongodb-uri
+//
+// Any other value is returned unchanged.
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Provider fetches the secret identified by ref from one store.
+type Provider interface {
+	Get(ctx context.Context, ref string) (string, error)
+}
+
+// Resolver maps reference schemes to providers.
+type Resolver struct {
+	providers map[string]Provider
+}
+
+// NewResolver returns a Resolver with no providers registered.
+func NewResolver() *Resolver {
+	return &Resolver{providers: map[string]Provider{}}
+}
+
+// FromEnv returns a Resolver with the Vault and AWS SSM providers
+// registered, configured from their standard environment variables.
+func FromEnv() *Resolver {
+	r := NewResolver()
+	r.Register("vault", VaultFromEnv())
+	r.Register("ssm", SSMFromEnv())
+	return r
+}
+
+// Register makes p responsible for values prefixed with scheme + ":".
+func (r *Resolver) Register(scheme string, p Provider) {
+	r.providers[scheme] = p
+}
+
+// Resolve returns value itself, or the secret it refers to.
+func (r *Resolver) Resolve(ctx context.Context, value string) (string, error) {
+	scheme, ref, ok := strings.Cut(value, ":")
+	if !ok {
+		return value, nil
+	}
+	p, ok := r.providers[scheme]
+	if !ok {
+		// Not a reference, e.g. a URI such as mongodb://...
+		return value, nil
+	}
+	secret, err := p.Get(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("secrets: %s:%s: %w", scheme, ref, err)
+	}
+	return secret, nil
+}
+
+// Getenv resolves the value of the environment variable key, returning
+// fallback when it is unset.
+func (r *Resolver) Getenv(ctx context.Context, key, fallback string) (string, error) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return fallback, nil
+	}
+	return r.Resolve(ctx, v)
+}
@@ -0,0 +1,86 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Vault reads secrets from HashiCorp Vault over its HTTP API. References
+// are "<api path>#<field>", e.g. "secret/data/todo#mongodb_uri"; both KV
+// version 1 and version 2 responses are understood.
+type Vault struct {
+	Addr      string
+	Token     string
+	Namespace string
+	Client    *http.Client
+}
+
+// VaultFromEnv configures Vault from VAULT_ADDR, VAULT_TOKEN and
+// VAULT_NAMESPACE.
+func VaultFromEnv() *Vault {
+	return &Vault{
+		Addr:      os.Getenv("VAULT_ADDR"),
+		Token:     os.Getenv("VAULT_TOKEN"),
+		Namespace: os.Getenv("VAULT_NAMESPACE"),
+		Client:    http.DefaultClient,
+	}
+}
+
+func (v *Vault) Get(ctx context.Context, ref string) (string, error) {
+	if v.Addr == "" || v.Token == "" {
+		return "", errors.New("VAULT_ADDR and VAULT_TOKEN must be set")
+	}
+	path, field, ok := strings.Cut(ref, "#")
+	if !ok || field == "" {
+		return "", errors.New(`reference must look like "<path>#<field>"`)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		strings.TrimRight(v.Addr, "/")+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+	if v.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.Namespace)
+	}
+
+	resp, err := v.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault responded %s", resp.Status)
+	}
+
+	var body struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	data := body.Data
+	// KV v2 nests the secret's fields one level deeper.
+	if nested, ok := data["data"]; ok {
+		var inner map[string]json.RawMessage
+		if json.Unmarshal(nested, &inner) == nil {
+			data = inner
+		}
+	}
+
+	raw, ok := data[field]
+	if !ok {
+		return "", fmt.Errorf("field %q not found", field)
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return "", fmt.Errorf("field %q is not a string", field)
+	}
+	return s, nil
+}
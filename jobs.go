@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"todo/internal/cron"
+	"todo/internal/render"
+)
+
+const (
+	// schedulerTick is the longest the scheduler sleeps, so the lease is
+	// renewed well before schedulerLease lapses.
+	schedulerTick  = time.Minute
+	schedulerLease = 3 * schedulerTick
+)
+
+var (
+	errJobNotFound = notFoundError("jobs.not_found", "job not found")
+	errJobRunning  = conflictError("jobs.running", "job is already running")
+)
+
+// scheduler runs registered jobs on cron schedules in the process's
+// local time. Only the replica holding the lease runs them on schedule;
+// a manual trigger runs on the replica it was sent to. A job still
+// running when it comes due again skips that run.
+type scheduler struct {
+	lease lease
+
+	mu   sync.Mutex
+	ctx  context.Context
+	jobs []*scheduledJob
+}
+
+// scheduledJob is a job and, guarded by the scheduler's mutex, how its
+// runs on this replica have gone.
+type scheduledJob struct {
+	name     string
+	spec     string
+	schedule cron.Schedule
+	run      func(ctx context.Context) error
+
+	next        time.Time
+	running     bool
+	lastRun     time.Time
+	lastTook    time.Duration
+	lastError   string
+	lastFailure time.Time
+	runs        int
+	failures    int
+}
+
+// jobStatus is the admin view of a job.
+type jobStatus struct {
+	Name        string     `json:"name"`
+	Schedule    string     `json:"schedule"`
+	NextRun     *time.Time `json:"next_run,omitempty"`
+	Running     bool       `json:"running"`
+	LastRun     *time.Time `json:"last_run,omitempty"`
+	LastTookMS  int64      `json:"last_took_ms"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastFailure *time.Time `json:"last_failure,omitempty"`
+	Runs        int        `json:"runs"`
+	Failures    int        `json:"failures"`
+}
+
+func newScheduler(lease lease) *scheduler {
+	return &scheduler{lease: lease, ctx: context.Background()}
+}
+
+// Register adds a job under name, to run whenever spec matches.
+func (s *scheduler) Register(name, spec string, run func(ctx context.Context) error) error {
+	schedule, err := cron.Parse(spec)
+	if err != nil {
+		return fmt.Errorf("job %s: %w", name, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs = append(s.jobs, &scheduledJob{
+		name:     name,
+		spec:     spec,
+		schedule: schedule,
+		run:      run,
+		next:     schedule.Next(time.Now()),
+	})
+	return nil
+}
+
+// Run starts jobs as they come due until ctx is cancelled. Jobs get ctx,
+// manual runs included.
+func (s *scheduler) Run(ctx context.Context) {
+	s.mu.Lock()
+	s.ctx = ctx
+	s.mu.Unlock()
+	for {
+		wait := s.tick(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// tick starts the jobs due at now if this replica leads, moves every due
+// job on to its next run either way, and says how long to sleep.
+func (s *scheduler) tick(ctx context.Context, now time.Time) time.Duration {
+	lead, err := s.lease.Hold(ctx)
+	if err != nil && ctx.Err() == nil {
+		log.Println("jobs: holding the lease failed, skipping due jobs:", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	wait := schedulerTick
+	for _, j := range s.jobs {
+		if !j.next.IsZero() && !j.next.After(now) {
+			if lead && !j.running {
+				s.start(j)
+			}
+			j.next = j.schedule.Next(now)
+		}
+		if !j.next.IsZero() && j.next.Sub(now) < wait {
+			wait = j.next.Sub(now)
+		}
+	}
+	return wait
+}
+
+// start runs j in the background. The caller holds s.mu.
+func (s *scheduler) start(j *scheduledJob) {
+	j.running = true
+	ctx := s.ctx
+	go func() {
+		started := time.Now()
+		err := j.run(ctx)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		j.running = false
+		j.runs++
+		j.lastRun = started
+		j.lastTook = time.Since(started)
+		j.lastError = ""
+		if err != nil {
+			j.failures++
+			j.lastFailure = started
+			j.lastError = err.Error()
+			log.Printf("jobs: %s failed: %v", j.name, err)
+		}
+	}()
+}
+
+// Trigger runs the named job now, on this replica, outside its schedule.
+func (s *scheduler) Trigger(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, j := range s.jobs {
+		if j.name != name {
+			continue
+		}
+		if j.running {
+			return errJobRunning
+		}
+		s.start(j)
+		return nil
+	}
+	return errJobNotFound
+}
+
+// Jobs reports every job in the order it was registered.
+func (s *scheduler) Jobs() []jobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]jobStatus, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		out = append(out, jobStatus{
+			Name:        j.name,
+			Schedule:    j.spec,
+			NextRun:     optionalTime(j.next),
+			Running:     j.running,
+			LastRun:     optionalTime(j.lastRun),
+			LastTookMS:  j.lastTook.Milliseconds(),
+			LastError:   j.lastError,
+			LastFailure: optionalTime(j.lastFailure),
+			Runs:        j.runs,
+			Failures:    j.failures,
+		})
+	}
+	return out
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
+
+func (a *app) fetchJobs(w http.ResponseWriter, r *http.Request) {
+	a.rnd.JSON(w, http.StatusOK, render.M{"data": a.jobs.Jobs()})
+}
+
+func (a *app) runJob(w http.ResponseWriter, r *http.Request) {
+	if err := a.jobs.Trigger(chi.URLParam(r, "name")); err != nil {
+		a.fail(w, r, err, "jobs.trigger_failed")
+		return
+	}
+	a.rnd.JSON(w, http.StatusAccepted, render.M{
+		"message": tr(r, "jobs.started"),
+	})
+}
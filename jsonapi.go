@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"todo/internal/render"
+)
+
+const contentJSONAPI = "application/vnd.api+json"
+
+type (
+	jsonAPIResource struct {
+		Type       string            `json:"type"`
+		ID         string            `json:"id"`
+		Attributes interface{}       `json:"attributes"`
+		Links      map[string]string `json:"links,omitempty"`
+	}
+	jsonAPITodo struct {
+		Title     string     `json:"title"`
+		Completed bool       `json:"completed"`
+		CreatedAt time.Time  `json:"created_at"`
+		StartDate *time.Time `json:"start_date,omitempty"`
+		DueDate   *time.Time `json:"due_date,omitempty"`
+		Tags      []string   `json:"tags,omitempty"`
+		Priority  string     `json:"priority,omitempty"`
+		ParentID  string     `json:"parent_id,omitempty"`
+	}
+	jsonAPIDocument struct {
+		Data  []jsonAPIResource `json:"data"`
+		Links map[string]string `json:"links,omitempty"`
+		Meta  map[string]int64  `json:"meta,omitempty"`
+		API   map[string]string `json:"jsonapi"`
+	}
+)
+
+// todoJSONAPI is a list of todos as a JSON:API document. Resource links
+// are relative to the collection path the request came in on; a non-nil
+// fields limits the attributes.
+func todoJSONAPI(r *http.Request, todos []todo, p page, total int64, fields []string) jsonAPIDocument {
+	base := todoBase(r)
+	doc := jsonAPIDocument{
+		Data: make([]jsonAPIResource, len(todos)),
+		Meta: map[string]int64{"total": total},
+		API:  map[string]string{"version": "1.1"},
+	}
+	for i, t := range todos {
+		doc.Data[i] = jsonAPIResource{
+			Type:       "todos",
+			ID:         t.ID,
+			Attributes: jsonAPIAttributes(t, fields),
+			Links:      map[string]string{"self": base + "/" + t.ID},
+		}
+	}
+	if p.Size > 0 {
+		doc.Links = p.links(r, total)
+	} else {
+		doc.Links = map[string]string{"self": r.URL.RequestURI()}
+	}
+	return doc
+}
+
+func jsonAPIAttributes(t todo, fields []string) interface{} {
+	if fields == nil {
+		return jsonAPITodo{Title: t.Title, Completed: t.Completed, CreatedAt: t.CreatedAt, StartDate: t.StartDate, DueDate: t.DueDate, Tags: t.Tags, Priority: t.Priority, ParentID: t.ParentID}
+	}
+	// The id is the resource's own member, not an attribute.
+	attrs := t.sparse(fields).(render.M)
+	delete(attrs, "id")
+	delete(attrs, "_links")
+	return attrs
+}
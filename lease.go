@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const leasesCollection = "leases"
+
+// lease makes one replica at a time the leader for a background job.
+type lease interface {
+	// Hold takes the lease or renews it, and reports whether this
+	// replica is the leader until the next call.
+	Hold(ctx context.Context) (bool, error)
+	// Release gives the lease up so another replica can lead at once
+	// instead of waiting for it to lapse.
+	Release(ctx context.Context) error
+}
+
+// mongoLease is a lease kept as one document per job name. The holder
+// must call Hold again within ttl; after that anyone may take it over.
+type mongoLease struct {
+	coll   *mongo.Collection
+	name   string
+	holder string
+	ttl    time.Duration
+}
+
+func newMongoLease(coll *mongo.Collection, name string, ttl time.Duration) *mongoLease {
+	host, _ := os.Hostname()
+	return &mongoLease{
+		coll:   coll,
+		name:   name,
+		holder: fmt.Sprintf("%s/%s", host, primitive.NewObjectID().Hex()),
+		ttl:    ttl,
+	}
+}
+
+// Hold matches the lease only if this replica holds it or it has lapsed,
+// and upserts otherwise: when someone else holds it, the upsert collides
+// with their document's _id and this replica is not the leader.
+func (l *mongoLease) Hold(ctx context.Context) (bool, error) {
+	now := time.Now()
+	_, err := l.coll.UpdateOne(ctx,
+		bson.M{"_id": l.name, "$or": bson.A{
+			bson.M{"holder": l.holder},
+			bson.M{"expires_at": bson.M{"$lt": now}},
+		}},
+		bson.M{"$set": bson.M{"holder": l.holder, "expires_at": now.Add(l.ttl)}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (l *mongoLease) Release(ctx context.Context) error {
+	_, err := l.coll.DeleteOne(ctx, bson.M{"_id": l.name, "holder": l.holder})
+	return err
+}
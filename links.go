@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi"
+)
+
+// link is a HAL-style hyperlink. Method is set for anything but GET.
+type link struct {
+	Href   string `json:"href"`
+	Method string `json:"method,omitempty"`
+}
+
+type links map[string]link
+
+// todoBase is the collection path the request came in on, /todo or
+// /api/todo, so links keep clients on the same mount.
+func todoBase(r *http.Request) string {
+	if rc := chi.RouteContext(r.Context()); rc != nil && len(rc.RoutePatterns) > 0 {
+		return strings.TrimRight(rc.RoutePatterns[0], "/*")
+	}
+	return "/todo"
+}
+
+// siblingTodoBase is todoBase for handlers mounted next to the todo
+// collection at /name or /api/name.
+func siblingTodoBase(r *http.Request, name string) string {
+	return strings.TrimSuffix(todoBase(r), name) + "todo"
+}
+
+func todoLinks(base, id string) links {
+	self := base + "/" + id
+	return links{
+		"self":     {Href: self},
+		"update":   {Href: self, Method: http.MethodPut},
+		"delete":   {Href: self, Method: http.MethodDelete},
+		"complete": {Href: self + "/complete", Method: http.MethodPost},
+		"list":     {Href: base + "/"},
+	}
+}
+
+// listLinks are self plus, when the list is paged, its neighbours.
+func listLinks(r *http.Request, p page, total int64) links {
+	if p.Size == 0 {
+		return links{"self": {Href: todoBase(r) + "/"}}
+	}
+	out := links{}
+	for rel, href := range p.links(r, total) {
+		out[rel] = link{Href: href}
+	}
+	return out
+}
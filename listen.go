@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"net"
+	"syscall"
+)
+
+// listen opens the server socket. With cfg.ReusePort several processes can
+// bind the same address at once, which is how a new binary takes over
+// without dropping connections: start it, wait until it is listening, then
+// send SIGTERM to the old one, which stops accepting and drains.
+func listen(cfg config) (net.Listener, error) {
+	lc := net.ListenConfig{}
+	if cfg.ReusePort {
+		lc.Control = func(network, address string, c syscall.RawConn) error {
+			var sockErr error
+			if err := c.Control(func(fd uintptr) { sockErr = setReusePort(fd) }); err != nil {
+				return err
+			}
+			return sockErr
+		}
+	}
+	return lc.Listen(context.Background(), "tcp", cfg.Addr)
+}
@@ -2,281 +2,185 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
-	"strings"
+	"syscall"
 	"time"
 
-	"github.com/go-chi/chi"
-	"github.com/go-chi/chi/middleware"
-	"github.com/thedevsaddam/renderer"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
-)
-
-var rnd *renderer.Render
-var db *mongo.Database
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 
-const (
-	hostName       string = "MONGODB_URI"
-	dbName         string = "todo"
-	collectionName string = "todo"
-	port           string = ":9000"
+	"todo/internal/events"
+	"todo/internal/fieldcrypt"
 )
 
-type (
-	todoModel struct {
-		ID        primitive.ObjectID `bson:"_id,omitempty"`
-		Title     string             `bson:"title"`
-		Completed bool               `bson:"completed"`
-		CreatedAt time.Time          `bson:"created_at"`
-	}
-	todo struct {
-		ID        string    `json:"id"`
-		Title     string    `json:"title"`
-		Completed bool      `json:"completed"`
-		CreatedAt time.Time `json:"created_at"`
+func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
 	}
-)
-
-func init() {
-	rnd = renderer.New()
 
-	// For local development only - replace with environment variable in production
-	mongoURI := "mongodb://localhost:27017"
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	clientOptions := options.Client().ApplyURI(mongoURI)
-	client, err := mongo.Connect(ctx, clientOptions)
+	cfg, err := loadConfig(ctx)
+	cancel()
 	if err != nil {
-		log.Fatal("Failed to connect to MongoDB:", err)
+		log.Fatal("Invalid configuration: ", err)
 	}
 
-	// Ping the database
-	err = client.Ping(ctx, nil)
-	if err != nil {
-		log.Fatal("Failed to ping MongoDB:", err)
+	var cipher *fieldcrypt.Cipher
+	if cfg.EncryptionKey != "" {
+		if cipher, err = fieldcrypt.NewFromBase64(cfg.EncryptionKey); err != nil {
+			log.Fatal("Invalid ENCRYPTION_KEY: ", err)
+		}
 	}
 
-	log.Println("Connected to MongoDB successfully")
-	db = client.Database(dbName)
-}
-
-func homeHandler(w http.ResponseWriter, r *http.Request) {
-	err := rnd.Template(w, http.StatusOK, []string{"static/home.tpl"}, nil)
-	checkErr(err)
-}
-
-// ... existing imports and declarations ...
-
-func fetchTodos(w http.ResponseWriter, r *http.Request) {
-	// Add timeout context
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	todos := []todoModel{}
-	cursor, err := db.Collection(collectionName).Find(ctx, bson.M{})
+	conn, err := connectMongo(cfg)
 	if err != nil {
-		rnd.JSON(w, http.StatusInternalServerError, renderer.M{ // Changed from StatusProcessing
-			"message": "Failed to fetch todos",
-			"error":   err.Error(),
-		})
-		return
-	}
-	defer cursor.Close(ctx)
-
-	for cursor.Next(ctx) {
-		var t todoModel
-		if err := cursor.Decode(&t); err != nil {
-			rnd.JSON(w, http.StatusInternalServerError, renderer.M{ // Changed from StatusProcessing
-				"message": "Failed to decode todo",
-				"error":   err.Error(),
-			})
-			return
-		}
-		todos = append(todos, t)
+		log.Fatal("Failed to connect to MongoDB:", err)
 	}
+	db := conn.client.Database(dbName)
 
-	rnd.JSON(w, http.StatusOK, renderer.M{
-		"data": todos,
-	})
-}
-
-func createTodo(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	var t todo
-	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
-		rnd.JSON(w, http.StatusBadRequest, renderer.M{ // Changed from StatusProcessing
-			"message": "Invalid request body",
-			"error":   err.Error(),
-		})
-		return
-	}
-	if t.Title == "" {
-		rnd.JSON(w, http.StatusBadRequest, renderer.M{
-			"message": "Title is required",
+	var sinks []events.Sink
+	if cfg.EventWebhookURL != "" {
+		sinks = append(sinks, &events.Webhook{
+			URL:    cfg.EventWebhookURL,
+			Secret: []byte(cfg.EventWebhookSecret),
+			Client: &http.Client{Timeout: 10 * time.Second},
 		})
-		return
 	}
-
-	tm := todoModel{
-		ID:        primitive.NewObjectID(),
-		Title:     t.Title,
-		Completed: false,
-		CreatedAt: time.Now(),
+	if cfg.NATSURL != "" {
+		n, err := events.DialNATS(cfg.NATSURL, cfg.NATSSubject)
+		if err != nil {
+			log.Fatal("Invalid NATS_URL: ", err)
+		}
+		defer n.Close()
+		sinks = append(sinks, n)
+	}
+	if len(cfg.KafkaBrokers) > 0 {
+		k := events.NewKafka(cfg.KafkaBrokers, cfg.KafkaTopic)
+		defer k.Close()
+		sinks = append(sinks, k)
+	}
+	if cfg.MQTTURL != "" {
+		m, err := events.DialMQTT(cfg.MQTTURL, cfg.MQTTTopic)
+		if err != nil {
+			log.Fatal("Invalid MQTT_URL: ", err)
+		}
+		defer m.Close()
+		sinks = append(sinks, m)
+	}
+	var outbox *mongoOutbox
+	if len(sinks) > 0 {
+		outbox = newMongoOutbox(db.Collection(outboxCollection), conn, cipher, cfg, sinks)
+	}
+
+	todos := newMongoTodoRepository(db.Collection(collectionName), conn, cipher, outbox)
+	board := newMongoBoardRepository(db.Collection(columnsCollection), todos)
+	templates := newMongoTemplateRepository(db.Collection(templatesCollection), conn)
+	settings := newMongoSettingsRepository(db.Collection(settingsCollection), conn, cfg)
+	notifications := newMongoNotificationRepository(db.Collection(notificationsCollection), conn, cipher)
+	customFields := newMongoCustomFieldRepository(db.Collection(customFieldsCollection), db.Collection(collectionName), conn)
+	bus := events.NewBus()
+	a, err := newApp(cfg, todos, board, templates, settings, notifications, customFields, conn, bus)
+	if err != nil {
+		log.Fatal(err)
 	}
-
-	if _, err := db.Collection(collectionName).InsertOne(ctx, tm); err != nil {
-		rnd.JSON(w, http.StatusInternalServerError, renderer.M{ // Changed from StatusProcessing
-			"message": "Failed to create todo",
-			"error":   err.Error(),
-		})
-		return
+	if outbox != nil {
+		a.outbox = outbox
 	}
 
-	rnd.JSON(w, http.StatusCreated, renderer.M{
-		"message": "Todo created successfully",
-		"todo_id": tm.ID.Hex(),
-	})
-}
+	stopChan := make(chan os.Signal, 1)
+	signal.Notify(stopChan, os.Interrupt, syscall.SIGTERM)
 
-func updateTodo(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	// Request contexts derive from base, so cancelling it aborts in-flight
+	// database calls once the shutdown grace period is over.
+	base, cancelBase := context.WithCancel(context.Background())
+	defer cancelBase()
 
-	id := strings.TrimSpace(chi.URLParam(r, "id"))
-	if !primitive.IsValidObjectID(id) {
-		rnd.JSON(w, http.StatusBadRequest, renderer.M{
-			"message": "The id is invalid",
-		})
-		return
-	}
+	go todos.Watch(base, bus)
+	queue := newMongoQueue(db.Collection(queueCollection), cipher, cfg)
+	queue.Handle(notifyJob, sendNotification(cfg, notifications))
+	queue.Handle(importJob, a.runImport)
+	queue.Handle(exportJob, a.runExport)
+	a.queue = queue
+	a.downloads = newMongoDownloadRepository(db.Collection(downloadsCollection), cipher)
+	go queue.Run(base)
 
-	var t todo
-	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
-		rnd.JSON(w, http.StatusBadRequest, renderer.M{ // Changed from StatusProcessing
-			"message": "Invalid request body",
-			"error":   err.Error(),
-		})
-		return
+	leader := newMongoLease(db.Collection(leasesCollection), "scheduler", schedulerLease)
+	a.jobs = newScheduler(leader)
+	dispatcher := newDispatcher(cfg, todos, notifications, settings, a.messages, queue)
+	if err := a.jobs.Register("notify-sweep", dispatchSchedule, dispatcher.Sweep); err != nil {
+		log.Fatal(err)
 	}
-
-	if t.Title == "" {
-		rnd.JSON(w, http.StatusBadRequest, renderer.M{
-			"message": "The title field is required",
-		})
-		return
+	go a.jobs.Run(base)
+	go a.keyFails.Run(base)
+	if outbox != nil {
+		go outbox.Run(base)
 	}
 
-	objectID, err := primitive.ObjectIDFromHex(id)
-	if err != nil {
-		rnd.JSON(w, http.StatusBadRequest, renderer.M{
-			"message": "Invalid id format",
-			"error":   err.Error(),
-		})
-		return
+	handler := a.routes()
+	if cfg.H2C {
+		// Speak HTTP/2 without TLS, via prior knowledge or an Upgrade,
+		// for clients behind plain TCP load balancers. HTTP/1.1 still works.
+		handler = h2c.NewHandler(handler, &http2.Server{IdleTimeout: cfg.HTTPIdleTimeout})
 	}
-
-	if _, err := db.Collection(collectionName).UpdateOne(ctx,
-		bson.M{"_id": objectID},
-		bson.M{"$set": bson.M{"title": t.Title, "completed": t.Completed}}); err != nil {
-		rnd.JSON(w, http.StatusInternalServerError, renderer.M{ // Changed from StatusProcessing
-			"message": "Failed to update todo",
-			"error":   err.Error(),
-		})
-		return
-	}
-
-	rnd.JSON(w, http.StatusOK, renderer.M{
-		"message": "Todo updated successfully",
-	})
-}
-
-func deleteTodo(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	id := strings.TrimSpace(chi.URLParam(r, "id"))
-	if !primitive.IsValidObjectID(id) {
-		rnd.JSON(w, http.StatusBadRequest, renderer.M{
-			"message": "The id is invalid",
-		})
-		return
+	srv := &http.Server{
+		Addr:         cfg.Addr,
+		Handler:      handler,
+		ReadTimeout:  cfg.HTTPReadTimeout,
+		WriteTimeout: cfg.HTTPWriteTimeout,
+		IdleTimeout:  cfg.HTTPIdleTimeout,
+		BaseContext:  func(net.Listener) context.Context { return base },
 	}
 
-	objectID, err := primitive.ObjectIDFromHex(id)
+	ln, err := listen(cfg)
 	if err != nil {
-		rnd.JSON(w, http.StatusBadRequest, renderer.M{
-			"message": "Invalid id format",
-			"error":   err.Error(),
-		})
-		return
+		log.Fatal("listen: ", err)
 	}
-
-	if _, err := db.Collection(collectionName).DeleteOne(ctx, bson.M{"_id": objectID}); err != nil {
-		rnd.JSON(w, http.StatusInternalServerError, renderer.M{ // Changed from StatusProcessing
-			"message": "Failed to delete todo",
-			"error":   err.Error(),
-		})
-		return
-	}
-
-	rnd.JSON(w, http.StatusOK, renderer.M{
-		"message": "Todo deleted successfully",
-	})
-}
-
-func main() {
-	stopChan := make(chan os.Signal)
-	signal.Notify(stopChan, os.Interrupt)
-	r := chi.NewRouter()
-	r.Use(middleware.Logger)
-	r.Get("/", homeHandler)
-	r.Mount("/todo", todoHandlers())
-
-	srv := &http.Server{
-		Addr:         port,
-		Handler:      r,
-		ReadTimeout:  60 * time.Second,
-		WriteTimeout: 60 * time.Second,
-		IdleTimeout:  60 * time.Second,
-	}
-
 	go func() {
-		log.Println("Listening on port", port)
-		if err := srv.ListenAndServe(); err != nil {
+		log.Println("Listening on port", cfg.Addr)
+		if err := srv.Serve(ln); err != nil {
 			log.Printf("listen: %s\n", err)
 		}
 	}()
+
+	var admin *http.Server
+	if cfg.AdminAddr != "" {
+		// No write timeout: CPU profiles and traces stream for as long as
+		// they were asked to run.
+		admin = &http.Server{
+			Addr:        cfg.AdminAddr,
+			Handler:     a.adminRoutes(),
+			ReadTimeout: cfg.HTTPReadTimeout,
+			IdleTimeout: cfg.HTTPIdleTimeout,
+		}
+		go func() {
+			log.Println("Admin listening on", cfg.AdminAddr)
+			if err := admin.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("admin listen: %s\n", err)
+			}
+		}()
+	}
+
 	<-stopChan
 	log.Println("Shutting down server...")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	srv.Shutdown(ctx)
+	ctx, cancel = context.WithTimeout(context.Background(), cfg.ShutdownGrace)
 	defer cancel()
-	log.Println("Server gracefully stopped!")
-}
-
-func todoHandlers() http.Handler {
-	rg := chi.NewRouter()
-	rg.Group(func(r chi.Router) {
-		r.Get("/", fetchTodos)
-		r.Post("/", createTodo)
-		r.Put("/{id}", updateTodo)
-		r.Delete("/{id}", deleteTodo)
-	})
-	return rg
-}
-
-func checkErr(err error) {
-	if err != nil {
-		log.Fatal(err)
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Println("Shutdown grace period expired, cancelling in-flight requests")
+		cancelBase()
+		srv.Close()
+	}
+	if admin != nil {
+		admin.Close()
 	}
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := leader.Release(ctx); err != nil {
+		log.Println("Releasing the scheduler lease failed:", err)
+	}
+	conn.Disconnect(ctx)
+	log.Println("Server gracefully stopped!")
 }
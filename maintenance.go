@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"todo/internal/render"
+)
+
+const (
+	maintenanceOff      = "off"
+	maintenanceReadOnly = "read_only"
+	maintenanceDown     = "down"
+
+	defaultMaintenanceRetryAfter = 60
+)
+
+// maintenanceState is the current mode and the Retry-After, in seconds,
+// sent while it lasts. It is per process: set it on every replica.
+type maintenanceState struct {
+	Mode       string    `json:"mode"`
+	RetryAfter int       `json:"retry_after"`
+	Since      time.Time `json:"since"`
+}
+
+func validMaintenanceMode(mode string) bool {
+	switch mode {
+	case maintenanceOff, maintenanceReadOnly, maintenanceDown:
+		return true
+	}
+	return false
+}
+
+func (a *app) setMaintenance(mode string, retryAfter int) {
+	if mode == "" {
+		mode = maintenanceOff
+	}
+	if retryAfter <= 0 {
+		retryAfter = defaultMaintenanceRetryAfter
+	}
+	a.maint.Store(&maintenanceState{Mode: mode, RetryAfter: retryAfter, Since: time.Now().UTC()})
+}
+
+// inMaintenance answers 503 with Retry-After for every request while the
+// mode is down, and for anything but reads while it is read_only.
+func (a *app) inMaintenance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		st := a.maint.Load()
+		if st == nil || st.Mode == maintenanceOff {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := "maintenance.down"
+		if st.Mode == maintenanceReadOnly {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				next.ServeHTTP(w, r)
+				return
+			}
+			key = "maintenance.read_only"
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(st.RetryAfter))
+		a.rnd.JSON(w, http.StatusServiceUnavailable, render.M{
+			"message":     tr(r, key),
+			"maintenance": st.Mode,
+		})
+	})
+}
+
+func (a *app) fetchMaintenance(w http.ResponseWriter, r *http.Request) {
+	a.rnd.JSON(w, http.StatusOK, render.M{"data": a.maint.Load()})
+}
+
+func (a *app) updateMaintenance(w http.ResponseWriter, r *http.Request) {
+	var in maintenanceState
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "request.invalid_body"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	if !validMaintenanceMode(in.Mode) {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "maintenance.mode_invalid"),
+		})
+		return
+	}
+
+	a.setMaintenance(in.Mode, in.RetryAfter)
+	a.rnd.JSON(w, http.StatusOK, render.M{"data": a.maint.Load()})
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// markdownTask matches a task list item: indent, bullet or number, box.
+var markdownTask = regexp.MustCompile(`^(\s*)(?:[-*+]|\d+[.)])\s+\[([ xX])\]\s+(.*\S)`)
+
+// parseMarkdown turns the task list items of a Markdown document into
+// todos, checked ones completed. An item indented under another becomes
+// its subtask. Everything else, code blocks included, is skipped.
+func parseMarkdown(data []byte, _ *time.Location, now time.Time) ([]todoModel, error) {
+	type level struct {
+		indent int
+		id     primitive.ObjectID
+	}
+	var (
+		out    []todoModel
+		stack  []level
+		fenced bool
+	)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(nil, maxImportBytes)
+	for sc.Scan() {
+		line := sc.Text()
+		if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fenced = !fenced
+			continue
+		}
+		m := markdownTask.FindStringSubmatch(line)
+		if fenced || m == nil {
+			continue
+		}
+		indent := len(strings.ReplaceAll(m[1], "\t", "    "))
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		t := todoModel{
+			ID:        primitive.NewObjectID(),
+			Title:     m[3],
+			Completed: m[2] != " ",
+			CreatedAt: now,
+		}
+		if len(stack) > 0 {
+			parent := stack[len(stack)-1].id
+			t.ParentID = &parent
+		}
+		stack = append(stack, level{indent, t.ID})
+		out = append(out, t)
+	}
+	return out, sc.Err()
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// mongoStats is published on the admin listener's /debug/vars: commands
+// and slow counts by collection and command, and the number in flight.
+var (
+	mongoStats    = expvar.NewMap("mongo")
+	mongoCommands = new(expvar.Map)
+	mongoSlow     = new(expvar.Map)
+	mongoInFlight = new(expvar.Int)
+)
+
+func init() {
+	mongoStats.Set("commands", mongoCommands)
+	mongoStats.Set("slow", mongoSlow)
+	mongoStats.Set("in_flight", mongoInFlight)
+}
+
+// mongoOp is a command the driver has started and not yet finished.
+type mongoOp struct {
+	Command    string    `json:"command"`
+	Collection string    `json:"collection"`
+	Filter     string    `json:"filter,omitempty"`
+	Started    time.Time `json:"started"`
+}
+
+// mongoMonitor times every command. Those taking slow or longer are
+// logged with their filter's shape, values left out, and counted; running
+// ones at least that old show under mongo_running. A zero slow logs none.
+type mongoMonitor struct {
+	slow    time.Duration
+	running sync.Map // request ID to mongoOp
+}
+
+// liveMonitor is the monitor of the connected client, for mongo_running.
+var liveMonitor atomic.Pointer[mongoMonitor]
+
+func init() {
+	expvar.Publish("mongo_running", expvar.Func(func() interface{} {
+		if m := liveMonitor.Load(); m != nil {
+			return m.longRunning()
+		}
+		return []mongoOp{}
+	}))
+}
+
+func newMongoMonitor(slow time.Duration) *event.CommandMonitor {
+	m := &mongoMonitor{slow: slow}
+	liveMonitor.Store(m)
+	return &event.CommandMonitor{
+		Started: m.started,
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			m.finished(e.RequestID, e.Duration)
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			m.finished(e.RequestID, e.Duration)
+		},
+	}
+}
+
+func (m *mongoMonitor) started(_ context.Context, e *event.CommandStartedEvent) {
+	op := mongoOp{Command: e.CommandName, Started: time.Now()}
+	if coll, ok := e.Command.Lookup(e.CommandName).StringValueOK(); ok {
+		op.Collection = coll
+	}
+	if filter, ok := commandFilter(e.CommandName, e.Command); ok {
+		op.Filter = filterShape(filter)
+	}
+	m.running.Store(e.RequestID, op)
+	mongoInFlight.Add(1)
+}
+
+func (m *mongoMonitor) finished(requestID int64, took time.Duration) {
+	v, ok := m.running.LoadAndDelete(requestID)
+	if !ok {
+		return
+	}
+	mongoInFlight.Add(-1)
+	op := v.(mongoOp)
+	name := op.Command
+	if op.Collection != "" {
+		name = op.Collection + "." + op.Command
+	}
+	mongoCommands.Add(name, 1)
+	if m.slow > 0 && took >= m.slow {
+		mongoSlow.Add(name, 1)
+		log.Printf("mongo: slow %s took %s, filter %s", name, took.Round(time.Millisecond), op.Filter)
+	}
+}
+
+// longRunning lists the commands that have been running for at least
+// the slow threshold, oldest first.
+func (m *mongoMonitor) longRunning() []mongoOp {
+	ops := []mongoOp{}
+	m.running.Range(func(_, v interface{}) bool {
+		if op := v.(mongoOp); time.Since(op.Started) >= m.slow {
+			ops = append(ops, op)
+		}
+		return true
+	})
+	sort.Slice(ops, func(i, j int) bool { return ops[i].Started.Before(ops[j].Started) })
+	return ops
+}
+
+// commandFilter finds the query document of the commands that have one.
+func commandFilter(name string, cmd bson.Raw) (bson.Raw, bool) {
+	var v bson.RawValue
+	switch name {
+	case "find":
+		v = cmd.Lookup("filter")
+	case "count", "distinct", "findAndModify":
+		v = cmd.Lookup("query")
+	case "update":
+		v = cmd.Lookup("updates", "0", "q")
+	case "delete":
+		v = cmd.Lookup("deletes", "0", "q")
+	case "aggregate":
+		v = cmd.Lookup("pipeline")
+	}
+	switch v.Type {
+	case bson.TypeEmbeddedDocument:
+		return v.Document(), true
+	case bson.TypeArray:
+		return v.Array(), true
+	}
+	return nil, false
+}
+
+// filterShape writes doc with its field names and operators but every
+// value replaced by ?, so logs show how a query looks without its data.
+// An aggregation pipeline is an array of stages and keeps them all.
+func filterShape(doc bson.Raw) string {
+	var b strings.Builder
+	writeShape(&b, bson.RawValue{Type: bson.TypeEmbeddedDocument, Value: doc})
+	return b.String()
+}
+
+func writeShape(b *strings.Builder, v bson.RawValue) {
+	switch v.Type {
+	case bson.TypeEmbeddedDocument:
+		elems, _ := v.Document().Elements()
+		b.WriteByte('{')
+		for i, e := range elems {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(e.Key() + ": ")
+			writeShape(b, e.Value())
+		}
+		b.WriteByte('}')
+	case bson.TypeArray:
+		// Arrays of documents are $and, $or and pipelines: their
+		// structure is the query's. Other arrays are values.
+		values, _ := v.Array().Values()
+		if len(values) == 0 || values[0].Type != bson.TypeEmbeddedDocument {
+			b.WriteByte('?')
+			return
+		}
+		b.WriteByte('[')
+		for i, e := range values {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			writeShape(b, e)
+		}
+		b.WriteByte(']')
+	default:
+		b.WriteByte('?')
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"slices"
+	"time"
+
+	"todo/internal/notify"
+	"todo/internal/render"
+)
+
+const (
+	notificationsCollection = "notifications"
+
+	// Notification events. There are no accounts to assign todos to, so
+	// there is no assignment event.
+	notifyReminder = "reminder"
+	notifyOverdue  = "overdue"
+	// notifyNearby is sent when the client checks in near a todo's
+	// location.
+	notifyNearby = "nearby"
+
+	maxNotificationChannels = 20
+	notifySendLimit         = 10 * time.Second
+
+	// notifyJob is the queued job that sends one message to one channel.
+	notifyJob = "notify"
+)
+
+var (
+	notificationEvents = []string{notifyReminder, notifyOverdue, notifyNearby}
+	channelKinds       = []string{"email", "slack", "telegram", "webhook"}
+)
+
+// notificationChannel is one place notifications go, and the events it
+// wants. Which of To, URL, ChatID and Token apply depends on Kind.
+type notificationChannel struct {
+	Name   string   `bson:"name" json:"name"`
+	Kind   string   `bson:"kind" json:"kind"`
+	Events []string `bson:"events" json:"events"`
+	To     string   `bson:"to,omitempty" json:"to,omitempty"`
+	URL    string   `bson:"url,omitempty" json:"url,omitempty"`
+	ChatID string   `bson:"chat_id,omitempty" json:"chat_id,omitempty"`
+	Token  string   `bson:"token,omitempty" json:"token,omitempty"`
+}
+
+// notificationSettings are the instance owner's channels and the rules,
+// by event, deciding whether a notification goes out at all. Language
+// picks the catalog messages are written in. NearbyRadius is how close, in
+// metres, a check-in must be to a todo for a nearby reminder; zero means
+// the default of 200.
+type notificationSettings struct {
+	Language     string                      `bson:"language" json:"language"`
+	Channels     []notificationChannel       `bson:"channels" json:"channels"`
+	Rules        map[string]notificationRule `bson:"rules,omitempty" json:"rules,omitempty"`
+	NearbyRadius float64                     `bson:"nearby_radius,omitempty" json:"nearby_radius,omitempty"`
+}
+
+func (n notificationSettings) nearbyRadius() float64 {
+	if n.NearbyRadius == 0 {
+		return defaultNearbyReminderRadius
+	}
+	return n.NearbyRadius
+}
+
+// notificationRule narrows when an event is sent. Times are "15:04" in the
+// settings timezone; a quiet period whose start is after its end runs
+// past midnight. Notifications the rule holds back are dropped, not sent
+// later.
+type notificationRule struct {
+	MinPriority  string `bson:"min_priority,omitempty" json:"min_priority,omitempty"`
+	SkipWeekends bool   `bson:"skip_weekends,omitempty" json:"skip_weekends,omitempty"`
+	QuietStart   string `bson:"quiet_start,omitempty" json:"quiet_start,omitempty"`
+	QuietEnd     string `bson:"quiet_end,omitempty" json:"quiet_end,omitempty"`
+}
+
+// validate returns the message key describing the first invalid field.
+func (r notificationRule) validate() string {
+	if priorityLevel(r.MinPriority) < 0 {
+		return "todo.priority_invalid"
+	}
+	if r.QuietStart == "" && r.QuietEnd == "" {
+		return ""
+	}
+	start, err1 := time.Parse("15:04", r.QuietStart)
+	end, err2 := time.Parse("15:04", r.QuietEnd)
+	if err1 != nil || err2 != nil || start.Equal(end) {
+		return "notify.quiet_hours_invalid"
+	}
+	return ""
+}
+
+// allows reports whether t may be notified about at now, which must be in
+// the settings timezone.
+func (r notificationRule) allows(t todoModel, now time.Time) bool {
+	if t.Priority < priorityLevel(r.MinPriority) {
+		return false
+	}
+	if wd := now.Weekday(); r.SkipWeekends && (wd == time.Saturday || wd == time.Sunday) {
+		return false
+	}
+	if r.QuietStart == "" {
+		return true
+	}
+	// validate made sure these parse.
+	start, _ := time.Parse("15:04", r.QuietStart)
+	end, _ := time.Parse("15:04", r.QuietEnd)
+	clock := time.Date(0, 1, 1, now.Hour(), now.Minute(), 0, 0, time.UTC)
+	if start.Before(end) {
+		return clock.Before(start) || !clock.Before(end)
+	}
+	return clock.Before(start) && !clock.Before(end)
+}
+
+// validate returns the message key describing the first invalid channel
+// or rule.
+func (n notificationSettings) validate() string {
+	if len(n.Channels) > maxNotificationChannels {
+		return "notify.too_many_channels"
+	}
+	if n.NearbyRadius < 0 || n.NearbyRadius > maxNearbyRadius {
+		return "notify.nearby_radius_invalid"
+	}
+	for event, rule := range n.Rules {
+		if !slices.Contains(notificationEvents, event) {
+			return "notify.event_invalid"
+		}
+		if key := rule.validate(); key != "" {
+			return key
+		}
+	}
+	names := map[string]bool{}
+	for _, c := range n.Channels {
+		if c.Name == "" || names[c.Name] {
+			return "notify.name_invalid"
+		}
+		names[c.Name] = true
+		if !slices.Contains(channelKinds, c.Kind) {
+			return "notify.kind_invalid"
+		}
+		for _, e := range c.Events {
+			if !slices.Contains(notificationEvents, e) {
+				return "notify.event_invalid"
+			}
+		}
+		switch c.Kind {
+		case "email":
+			if _, err := mail.ParseAddress(c.To); err != nil {
+				return "notify.to_invalid"
+			}
+		case "slack", "webhook":
+			if u, err := url.Parse(c.URL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+				return "notify.url_invalid"
+			}
+		case "telegram":
+			if c.Token == "" || c.ChatID == "" {
+				return "notify.telegram_invalid"
+			}
+		}
+	}
+	return ""
+}
+
+// notifier builds the sender for c.
+func (c notificationChannel) notifier(cfg config, client *http.Client) notify.Notifier {
+	switch c.Kind {
+	case "email":
+		return &notify.Email{Server: cfg.SMTP, To: c.To}
+	case "slack":
+		return &notify.Slack{WebhookURL: c.URL, Client: client}
+	case "telegram":
+		return &notify.Telegram{Token: c.Token, ChatID: c.ChatID, Client: client}
+	default:
+		return &notify.Webhook{URL: c.URL, Client: client}
+	}
+}
+
+// subscribed returns the channels that want event.
+func (n notificationSettings) subscribed(event string) []notificationChannel {
+	var out []notificationChannel
+	for _, c := range n.Channels {
+		if slices.Contains(c.Events, event) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// notifyAll sends m to each channel and returns the failures by channel
+// name.
+func notifyAll(ctx context.Context, cfg config, channels []notificationChannel, m notify.Message) map[string]error {
+	client := &http.Client{Timeout: notifySendLimit}
+	failed := map[string]error{}
+	for _, c := range channels {
+		sctx, cancel := budget(ctx, notifySendLimit)
+		if err := c.notifier(cfg, client).Notify(sctx, m); err != nil {
+			failed[c.Name] = err
+		}
+		cancel()
+	}
+	return failed
+}
+
+// notifyPayload is a notify job. The channel is named rather than copied,
+// so its credentials stay out of the queue.
+type notifyPayload struct {
+	Channel string         `json:"channel"`
+	Message notify.Message `json:"message"`
+}
+
+// queueNotifications queues m for each channel. The notify job sends it
+// and retries channels that fail.
+func queueNotifications(ctx context.Context, q jobQueue, channels []notificationChannel, m notify.Message) error {
+	for _, c := range channels {
+		if _, err := q.Enqueue(ctx, notifyJob, notifyPayload{Channel: c.Name, Message: m}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendNotification handles notify jobs. Messages for a channel removed
+// since they were queued are dropped.
+func sendNotification(cfg config, notifications notificationRepository) queueHandler {
+	client := &http.Client{Timeout: notifySendLimit}
+	return func(ctx context.Context, run *jobRun) (interface{}, error) {
+		var p notifyPayload
+		if err := json.Unmarshal(run.Payload, &p); err != nil {
+			return nil, permanent(err)
+		}
+		n, err := notifications.Load(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range n.Channels {
+			if c.Name == p.Channel {
+				sctx, cancel := context.WithTimeout(ctx, notifySendLimit)
+				defer cancel()
+				return nil, c.notifier(cfg, client).Notify(sctx, p.Message)
+			}
+		}
+		return nil, nil
+	}
+}
+
+func (a *app) fetchNotifications(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	n, err := a.notifications.Load(ctx)
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "notify.fetch_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	a.rnd.JSON(w, http.StatusOK, render.M{"data": n})
+}
+
+func (a *app) updateNotifications(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	var n notificationSettings
+	if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "request.invalid_body"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	if key := n.validate(); key != "" {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, key),
+		})
+		return
+	}
+	// Messages go out in whatever language the settings were saved in,
+	// unless one is given.
+	n.Language = a.messages.Localizer(n.Language, r.Header.Get("Accept-Language")).Lang()
+	if n.Channels == nil {
+		n.Channels = []notificationChannel{}
+	}
+
+	if err := a.notifications.Save(ctx, n); err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "notify.update_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	a.rnd.JSON(w, http.StatusOK, render.M{
+		"message": tr(r, "notify.updated"),
+		"data":    n,
+	})
+}
+
+// testNotifications sends a test message to every channel, whatever events
+// it is subscribed to, and reports any that failed.
+func (a *app) testNotifications(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	n, err := a.notifications.Load(ctx)
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "notify.fetch_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	l := a.messages.Localizer(n.Language)
+	failed := notifyAll(ctx, a.cfg, n.Channels, notify.Message{
+		Event:   "test",
+		Subject: l.T("notify.test_subject"),
+		Body:    l.T("notify.test_body"),
+		Time:    time.Now().UTC(),
+	})
+	if len(failed) > 0 {
+		errs := map[string]string{}
+		for name, err := range failed {
+			errs[name] = err.Error()
+		}
+		a.rnd.JSON(w, http.StatusBadGateway, render.M{
+			"message": tr(r, "notify.test_failed", len(failed)),
+			"errors":  errs,
+		})
+		return
+	}
+	a.rnd.JSON(w, http.StatusOK, render.M{
+		"message": tr(r, "notify.test_sent", len(n.Channels)),
+	})
+}
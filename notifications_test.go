@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNotificationRuleQuietHours(t *testing.T) {
+	// 2026-01-01 is a Thursday.
+	at := func(h, m int) time.Time { return time.Date(2026, 1, 1, h, m, 0, 0, time.UTC) }
+	overnight := notificationRule{QuietStart: "22:00", QuietEnd: "07:00"}
+	daytime := notificationRule{QuietStart: "09:00", QuietEnd: "17:30"}
+	tests := []struct {
+		name string
+		rule notificationRule
+		now  time.Time
+		want bool
+	}{
+		{"no quiet hours", notificationRule{}, at(3, 0), true},
+		{"before overnight", overnight, at(21, 59), true},
+		{"overnight start", overnight, at(22, 0), false},
+		{"overnight midnight", overnight, at(0, 0), false},
+		{"overnight early", overnight, at(6, 59), false},
+		{"overnight end", overnight, at(7, 0), true},
+		{"midday overnight", overnight, at(12, 0), true},
+		{"before daytime", daytime, at(8, 59), true},
+		{"daytime start", daytime, at(9, 0), false},
+		{"in daytime", daytime, at(17, 29), false},
+		{"daytime end", daytime, at(17, 30), true},
+		{"night daytime", daytime, at(23, 0), true},
+	}
+	for _, tt := range tests {
+		if got := tt.rule.allows(todoModel{}, tt.now); got != tt.want {
+			t.Errorf("%s: allows at %s = %v, want %v", tt.name, tt.now.Format("15:04"), got, tt.want)
+		}
+	}
+}
+
+func TestNotificationRuleAllows(t *testing.T) {
+	thursday := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	saturday := thursday.AddDate(0, 0, 2)
+	low, high := todoModel{Priority: priorityLevel("low")}, todoModel{Priority: priorityLevel("high")}
+	tests := []struct {
+		name string
+		rule notificationRule
+		todo todoModel
+		now  time.Time
+		want bool
+	}{
+		{"below min priority", notificationRule{MinPriority: "medium"}, low, thursday, false},
+		{"at min priority", notificationRule{MinPriority: "high"}, high, thursday, true},
+		{"no priority, no minimum", notificationRule{}, todoModel{}, thursday, true},
+		{"weekday", notificationRule{SkipWeekends: true}, low, thursday, true},
+		{"weekend", notificationRule{SkipWeekends: true}, low, saturday, false},
+	}
+	for _, tt := range tests {
+		if got := tt.rule.allows(tt.todo, tt.now); got != tt.want {
+			t.Errorf("%s: allows = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNotificationRuleValidate(t *testing.T) {
+	tests := []struct {
+		rule notificationRule
+		want string
+	}{
+		{notificationRule{}, ""},
+		{notificationRule{QuietStart: "22:00", QuietEnd: "07:00"}, ""},
+		{notificationRule{MinPriority: "urgent"}, "todo.priority_invalid"},
+		{notificationRule{QuietStart: "22:00"}, "notify.quiet_hours_invalid"},
+		{notificationRule{QuietEnd: "07:00"}, "notify.quiet_hours_invalid"},
+		{notificationRule{QuietStart: "22:00", QuietEnd: "22:00"}, "notify.quiet_hours_invalid"},
+		{notificationRule{QuietStart: "10pm", QuietEnd: "07:00"}, "notify.quiet_hours_invalid"},
+		{notificationRule{QuietStart: "24:00", QuietEnd: "07:00"}, "notify.quiet_hours_invalid"},
+	}
+	for _, tt := range tests {
+		if got := tt.rule.validate(); got != tt.want {
+			t.Errorf("%+v.validate() = %q, want %q", tt.rule, got, tt.want)
+		}
+	}
+}
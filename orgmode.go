@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// orgPriorities are Org's default [#A]..[#C] cookies, by priority level.
+var orgPriorities = map[int]string{3: "A", 2: "B", 1: "C"}
+
+// writeOrg writes todos as an Org-mode outline: a TODO or DONE headline
+// each, with subtasks nested under their parent when it is exported too.
+// Dates are timestamps in loc, without a time of day at midnight, and notes
+// are written the way Org logs them.
+func writeOrg(todos []todoModel, loc *time.Location) []byte {
+	stamp := func(t time.Time, open, close string) string {
+		t = t.In(loc)
+		layout := "2006-01-02 Mon"
+		if t.Hour() != 0 || t.Minute() != 0 {
+			layout += " 15:04"
+		}
+		return open + t.Format(layout) + close
+	}
+
+	exported := make(map[primitive.ObjectID]bool, len(todos))
+	for _, t := range todos {
+		exported[t.ID] = true
+	}
+	children := map[primitive.ObjectID][]todoModel{}
+	var roots []todoModel
+	for _, t := range todos {
+		if t.ParentID != nil && exported[*t.ParentID] {
+			children[*t.ParentID] = append(children[*t.ParentID], t)
+		} else {
+			roots = append(roots, t)
+		}
+	}
+
+	var buf bytes.Buffer
+	var write func(t todoModel, depth int)
+	write = func(t todoModel, depth int) {
+		buf.WriteString(strings.Repeat("*", depth))
+		if t.Completed {
+			buf.WriteString(" DONE")
+		} else {
+			buf.WriteString(" TODO")
+		}
+		if p := orgPriorities[t.Priority]; p != "" {
+			buf.WriteString(" [#" + p + "]")
+		}
+		buf.WriteString(" " + strings.Join(strings.Fields(t.Title), " "))
+		if len(t.Tags) > 0 {
+			buf.WriteString(" :")
+			for _, tag := range t.Tags {
+				buf.WriteString(orgTag(tag) + ":")
+			}
+		}
+		buf.WriteByte('\n')
+
+		indent := strings.Repeat(" ", depth+1)
+		var planning []string
+		if t.Completed && t.CompletedAt != nil {
+			planning = append(planning, "CLOSED: "+stamp(*t.CompletedAt, "[", "]"))
+		}
+		if t.DueDate != nil {
+			planning = append(planning, "DEADLINE: "+stamp(*t.DueDate, "<", ">"))
+		}
+		if t.StartDate != nil {
+			planning = append(planning, "SCHEDULED: "+stamp(*t.StartDate, "<", ">"))
+		}
+		if len(planning) > 0 {
+			buf.WriteString(indent + strings.Join(planning, " ") + "\n")
+		}
+		for _, n := range t.Notes {
+			buf.WriteString(indent + "- Note taken on " + stamp(n.At, "[", "]") + " \\\\\n")
+			for _, line := range strings.Split(strings.TrimSpace(n.Text), "\n") {
+				buf.WriteString(indent + "  " + line + "\n")
+			}
+		}
+		for _, c := range children[t.ID] {
+			write(c, depth+1)
+		}
+	}
+	for _, t := range roots {
+		write(t, 1)
+	}
+	return buf.Bytes()
+}
+
+// orgTag makes tag a valid Org tag, which is letters, digits, and _@#%.
+func orgTag(tag string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r == '@' || r == '#' || r == '%' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, tag)
+}
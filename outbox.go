@@ -0,0 +1,384 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"todo/internal/events"
+	"todo/internal/fieldcrypt"
+)
+
+const (
+	outboxCollection = "outbox"
+
+	outboxPending   = "pending"
+	outboxDelivered = "delivered"
+	outboxFailed    = "failed"
+
+	// outboxLease is how long a claimed entry stays invisible to other
+	// dispatchers. An entry whose dispatcher died is retried after it.
+	outboxLease     = time.Minute
+	outboxSendLimit = 10 * time.Second
+	outboxRetryBase = time.Second
+	outboxRetryMax  = time.Hour
+
+	// Delivered entries are kept for a week, then expire.
+	outboxRetention = 7 * 24 * time.Hour
+
+	// A sink is reported as failing after this many sends in a row fail.
+	sinkFailingAfter = 5
+)
+
+var errOutboxEntryNotFound = notFoundError("outbox.not_found", "outbox entry not found")
+
+// outboxEntry is an event waiting for, or done with, delivery. The payload
+// is the JSON-encoded event, sealed like any other private field because
+// it carries the todo's title.
+type outboxEntry struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	Payload     string             `bson:"payload"`
+	Status      string             `bson:"status"`
+	Attempts    int                `bson:"attempts"`
+	NextAttempt time.Time          `bson:"next_attempt"`
+	Delivered   []string           `bson:"delivered,omitempty"`
+	LastError   string             `bson:"last_error,omitempty"`
+	CreatedAt   time.Time          `bson:"created_at"`
+	DeliveredAt *time.Time         `bson:"delivered_at,omitempty"`
+}
+
+// mongoOutbox records events in the same transaction as the write that
+// caused them and delivers them to sinks afterwards, so a crash between
+// the two neither loses an event nor sends one for a write that didn't
+// happen. Delivery is at least once: consumers should dedupe on the event
+// ID.
+type mongoOutbox struct {
+	coll        *mongo.Collection
+	conn        *mongoConn
+	cipher      *fieldcrypt.Cipher
+	sinks       []events.Sink
+	source      string
+	poll        time.Duration
+	maxAttempts int
+	wake        chan struct{}
+
+	mu     sync.Mutex
+	health map[string]*sinkStatus
+}
+
+// sinkStatus is how sends to one sink have gone since the process
+// started.
+type sinkStatus struct {
+	Name                string     `json:"name"`
+	Failing             bool       `json:"failing"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastFailure         *time.Time `json:"last_failure,omitempty"`
+	LastSuccess         *time.Time `json:"last_success,omitempty"`
+}
+
+func newMongoOutbox(coll *mongo.Collection, conn *mongoConn, cipher *fieldcrypt.Cipher, cfg config, sinks []events.Sink) *mongoOutbox {
+	return &mongoOutbox{
+		coll:        coll,
+		conn:        conn,
+		cipher:      cipher,
+		sinks:       sinks,
+		source:      cfg.EventSource,
+		poll:        cfg.OutboxPoll,
+		maxAttempts: int(cfg.OutboxMaxAttempts),
+		wake:        make(chan struct{}, 1),
+		health:      map[string]*sinkStatus{},
+	}
+}
+
+func payloadAAD(id primitive.ObjectID) []byte {
+	return []byte(id.Hex() + "/payload")
+}
+
+// enqueue stores e for delivery. It must run inside the caller's
+// transaction; the event ID and time are assigned here.
+func (o *mongoOutbox) enqueue(ctx context.Context, e events.Event) error {
+	id := primitive.NewObjectID()
+	now := time.Now()
+	e.ID = id.Hex()
+	e.Source = o.source
+	e.Time = now.UTC()
+
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	payload, err := o.cipher.Encrypt(string(raw), payloadAAD(id))
+	if err != nil {
+		return err
+	}
+	_, err = o.coll.InsertOne(ctx, outboxEntry{
+		ID:          id,
+		Payload:     payload,
+		Status:      outboxPending,
+		NextAttempt: now,
+		CreatedAt:   now,
+	})
+	return err
+}
+
+// notify tells the dispatcher there is new work without waiting for the
+// next poll.
+func (o *mongoOutbox) notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (o *mongoOutbox) ensureIndexes(ctx context.Context) error {
+	_, err := o.coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "_id", Value: -1}}},
+		{
+			Keys:    bson.D{{Key: "delivered_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(outboxRetention / time.Second)),
+		},
+	})
+	return err
+}
+
+// Run delivers pending entries until ctx is cancelled.
+func (o *mongoOutbox) Run(ctx context.Context) {
+	for attempt := 0; ; attempt++ {
+		err := o.ensureIndexes(ctx)
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		wait := backoff(attempt)
+		log.Printf("outbox: creating indexes failed, retrying in %s: %v", wait.Round(time.Millisecond), err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+
+	for {
+		entry, err := o.claim(ctx)
+		if err == nil && entry != nil {
+			o.deliver(ctx, entry)
+			continue
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Println("outbox: claiming entry failed:", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-o.wake:
+		case <-time.After(o.poll):
+		}
+	}
+}
+
+// claim leases the oldest due entry, or returns nil when there is none.
+func (o *mongoOutbox) claim(ctx context.Context) (*outboxEntry, error) {
+	now := time.Now()
+	var e outboxEntry
+	err := o.coll.FindOneAndUpdate(ctx,
+		bson.M{"status": outboxPending, "next_attempt": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{"next_attempt": now.Add(outboxLease)}},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "_id", Value: 1}}).
+			SetReturnDocument(options.After),
+	).Decode(&e)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// deliver sends entry to every sink that hasn't had it yet and records the
+// outcome. Failed entries are retried with backoff until maxAttempts.
+func (o *mongoOutbox) deliver(ctx context.Context, entry *outboxEntry) {
+	var e events.Event
+	raw, err := o.cipher.Decrypt(entry.Payload, payloadAAD(entry.ID))
+	if err == nil {
+		err = json.Unmarshal([]byte(raw), &e)
+	}
+	if err != nil {
+		// Retrying cannot fix a payload we can't read.
+		o.finish(ctx, entry.ID, bson.M{"status": outboxFailed, "last_error": err.Error()}, nil)
+		log.Printf("outbox: dropping unreadable entry %s: %v", entry.ID.Hex(), err)
+		return
+	}
+
+	if e.Source == "" {
+		// Queued before events carried a source.
+		e.Source = o.source
+	}
+
+	done := map[string]bool{}
+	for _, name := range entry.Delivered {
+		done[name] = true
+	}
+	var delivered []string
+	var lastErr error
+	for _, sink := range o.sinks {
+		if done[sink.Name()] {
+			continue
+		}
+		sctx, cancel := context.WithTimeout(ctx, outboxSendLimit)
+		err := sink.Send(sctx, e)
+		cancel()
+		o.record(sink.Name(), err)
+		if err != nil {
+			lastErr = err
+			log.Printf("outbox: delivering %s to %s failed: %v", e.ID, sink.Name(), err)
+			continue
+		}
+		delivered = append(delivered, sink.Name())
+	}
+
+	if lastErr == nil {
+		now := time.Now()
+		o.finish(ctx, entry.ID, bson.M{"status": outboxDelivered, "delivered_at": now}, delivered)
+		return
+	}
+
+	attempts := entry.Attempts + 1
+	set := bson.M{"attempts": attempts, "last_error": lastErr.Error()}
+	if attempts >= o.maxAttempts {
+		set["status"] = outboxFailed
+		log.Printf("outbox: giving up on %s after %d attempts", e.ID, attempts)
+	} else {
+		set["next_attempt"] = time.Now().Add(expBackoff(outboxRetryBase, outboxRetryMax, attempts-1))
+	}
+	o.finish(ctx, entry.ID, set, delivered)
+}
+
+func (o *mongoOutbox) finish(ctx context.Context, id primitive.ObjectID, set bson.M, delivered []string) {
+	update := bson.M{"$set": set}
+	if len(delivered) > 0 {
+		update["$addToSet"] = bson.M{"delivered": bson.M{"$each": delivered}}
+	}
+	if _, err := o.coll.UpdateOne(ctx, bson.M{"_id": id}, update); err != nil && ctx.Err() == nil {
+		// The lease runs out and the entry is retried.
+		log.Printf("outbox: recording outcome for %s failed: %v", id.Hex(), err)
+	}
+}
+
+// record notes the outcome of one send to the named sink, and logs when
+// the sink starts or stops failing.
+func (o *mongoOutbox) record(name string, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	st := o.health[name]
+	if st == nil {
+		st = &sinkStatus{Name: name}
+		o.health[name] = st
+	}
+	now := time.Now().UTC()
+	if err == nil {
+		if st.Failing {
+			log.Printf("outbox: %s is delivering again", name)
+		}
+		st.Failing = false
+		st.ConsecutiveFailures = 0
+		st.LastSuccess = &now
+		return
+	}
+	st.ConsecutiveFailures++
+	st.LastError = err.Error()
+	st.LastFailure = &now
+	if !st.Failing && st.ConsecutiveFailures >= sinkFailingAfter {
+		st.Failing = true
+		log.Printf("outbox: marking %s as failing after %d errors in a row", name, st.ConsecutiveFailures)
+	}
+}
+
+// Sinks reports every configured sink, whether or not it has been sent
+// anything yet.
+func (o *mongoOutbox) Sinks() []sinkStatus {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	out := make([]sinkStatus, 0, len(o.sinks))
+	for _, sink := range o.sinks {
+		st := sinkStatus{Name: sink.Name()}
+		if h := o.health[sink.Name()]; h != nil {
+			st = *h
+		}
+		out = append(out, st)
+	}
+	return out
+}
+
+// Failed returns up to limit dead-lettered entries, newest first.
+func (o *mongoOutbox) Failed(ctx context.Context, limit int64) ([]deadLetter, error) {
+	cur, err := o.coll.Find(ctx,
+		bson.M{"status": outboxFailed},
+		options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(limit),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var entries []outboxEntry
+	if err := cur.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+
+	out := make([]deadLetter, 0, len(entries))
+	for _, entry := range entries {
+		d := deadLetter{
+			ID:        entry.ID.Hex(),
+			Attempts:  entry.Attempts,
+			LastError: entry.LastError,
+			CreatedAt: entry.CreatedAt,
+			Delivered: entry.Delivered,
+		}
+		done := map[string]bool{}
+		for _, name := range entry.Delivered {
+			done[name] = true
+		}
+		for _, sink := range o.sinks {
+			if !done[sink.Name()] {
+				d.Pending = append(d.Pending, sink.Name())
+			}
+		}
+		// Only the envelope is shown; the data carries the todo's title.
+		var e events.Event
+		if raw, err := o.cipher.Decrypt(entry.Payload, payloadAAD(entry.ID)); err == nil && json.Unmarshal([]byte(raw), &e) == nil {
+			d.Type = e.Type
+			d.Subject = e.Subject
+		}
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+// Redeliver puts a dead-lettered entry back in the queue with a fresh set
+// of attempts. Sinks that already had it are still skipped.
+func (o *mongoOutbox) Redeliver(ctx context.Context, id primitive.ObjectID) error {
+	res, err := o.coll.UpdateOne(ctx,
+		bson.M{"_id": id, "status": outboxFailed},
+		bson.M{"$set": bson.M{"status": outboxPending, "attempts": 0, "next_attempt": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errOutboxEntryNotFound
+	}
+	o.notify()
+	return nil
+}
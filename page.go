@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// page is the slice of a list a client asked for. A zero Size means the
+// request didn't ask for paging and gets everything, if it is streamed
+// or no more than the configured maximum page size.
+type page struct {
+	Number int64
+	Size   int64
+
+	// jsonAPI records whether the client used page[number]/page[size]
+	// rather than page/per_page, so links echo the same style.
+	jsonAPI bool
+}
+
+// parsePage reads ?page=&per_page= or JSON:API's ?page[number]=&
+// page[size]=. The page size defaults to the items-per-page setting. ok
+// is false when a value is not a positive integer or the size is over
+// the configured maximum.
+func (a *app) parsePage(ctx context.Context, r *http.Request) (p page, ok bool, err error) {
+	q := r.URL.Query()
+	number, size := q.Get("page"), q.Get("per_page")
+	if q.Has("page[number]") || q.Has("page[size]") {
+		number, size = q.Get("page[number]"), q.Get("page[size]")
+		p.jsonAPI = true
+	}
+	if number == "" && size == "" {
+		return p, true, nil
+	}
+
+	p.Number = 1
+	if number != "" {
+		if p.Number, err = strconv.ParseInt(number, 10, 64); err != nil || p.Number < 1 {
+			return p, false, nil
+		}
+	}
+	if size != "" {
+		if p.Size, err = strconv.ParseInt(size, 10, 64); err != nil || p.Size < 1 || p.Size > int64(a.cfg.MaxPageSize) {
+			return p, false, nil
+		}
+		return p, true, nil
+	}
+
+	if p.Size, err = a.defaultPageSize(ctx); err != nil {
+		return p, false, err
+	}
+	return p, true, nil
+}
+
+// defaultPageSize is the items-per-page setting.
+func (a *app) defaultPageSize(ctx context.Context) (int64, error) {
+	s, err := a.settings.Load(ctx)
+	if err != nil {
+		return 0, err
+	}
+	// The setting may predate a lower MAX_PAGE_SIZE.
+	return min(int64(s.ItemsPerPage), int64(a.cfg.MaxPageSize)), nil
+}
+
+func (p page) query() listQuery {
+	if p.Size == 0 {
+		return listQuery{}
+	}
+	return listQuery{Skip: (p.Number - 1) * p.Size, Limit: p.Size}
+}
+
+// last is the number of the final page, at least 1.
+func (p page) last(total int64) int64 {
+	if p.Size == 0 || total == 0 {
+		return 1
+	}
+	return (total + p.Size - 1) / p.Size
+}
+
+// link is r's URL pointing at page number instead, with the other query
+// parameters kept.
+func (p page) link(r *http.Request, number int64) string {
+	q := r.URL.Query()
+	num, size := "page", "per_page"
+	if p.jsonAPI {
+		num, size = "page[number]", "page[size]"
+	}
+	q.Set(num, strconv.FormatInt(number, 10))
+	q.Set(size, strconv.FormatInt(p.Size, 10))
+	u := url.URL{Path: r.URL.Path, RawQuery: q.Encode()}
+	return u.String()
+}
+
+// links are the first/prev/next/last neighbours of p, omitting prev and
+// next at the ends.
+func (p page) links(r *http.Request, total int64) map[string]string {
+	last := p.last(total)
+	links := map[string]string{
+		"self":  p.link(r, p.Number),
+		"first": p.link(r, 1),
+		"last":  p.link(r, last),
+	}
+	if p.Number > 1 {
+		links["prev"] = p.link(r, min(p.Number-1, last))
+	}
+	if p.Number < last {
+		links["next"] = p.link(r, p.Number+1)
+	}
+	return links
+}
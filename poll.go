@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"todo/internal/events"
+	"todo/internal/render"
+)
+
+const (
+	defaultPollWait = 25 * time.Second
+	maxPollWait     = 55 * time.Second
+	// pollMargin is kept back from the request deadline for the final
+	// lookup and the response.
+	pollMargin = 5 * time.Second
+	// pollRecheck is how often a waiting poll looks again unprompted, in
+	// case the bus dropped the event or there is no bus.
+	pollRecheck = 10 * time.Second
+)
+
+// pollTodos is the change feed for clients that can't keep a WebSocket or
+// event stream open: it answers as soon as anything changed after ?since=,
+// like GET /changes, or with 204 after ?timeout= seconds (default 25) of
+// nothing. Without since it waits for the next change from now.
+func (a *app) pollTodos(w http.ResponseWriter, r *http.Request) {
+	wait := defaultPollWait
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || time.Duration(n)*time.Second > maxPollWait {
+			a.rnd.JSON(w, http.StatusBadRequest, render.M{
+				"message": tr(r, "poll.timeout_invalid", int(maxPollWait/time.Second)),
+			})
+			return
+		}
+		wait = time.Duration(n) * time.Second
+	}
+	if dl, ok := r.Context().Deadline(); ok {
+		wait = max(0, min(wait, time.Until(dl)-pollMargin))
+	}
+
+	since := changeToken{At: time.Now().Truncate(time.Millisecond)}
+	if v := r.URL.Query().Get("since"); v != "" {
+		var ok bool
+		if since, ok = a.parseSince(w, r, v); !ok {
+			return
+		}
+	}
+
+	// Subscribe before the first look, so a change made in between still
+	// wakes us.
+	var wake <-chan events.Event
+	if a.events != nil {
+		sub := a.events.Subscribe(16)
+		defer sub.Close()
+		wake = sub.C
+	}
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+
+	for {
+		ctx, cancel := a.dbContext(r)
+		out, next, more, err := a.collectChanges(ctx, todoBase(r), since, defaultChangeLimit)
+		cancel()
+		if err != nil {
+			a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+				"message": tr(r, "todo.fetch_failed"),
+				"error":   err.Error(),
+			})
+			return
+		}
+		if len(out) > 0 {
+			a.rnd.JSON(w, http.StatusOK, render.M{
+				"data":     out,
+				"next":     next.String(),
+				"has_more": more,
+			})
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-timeout.C:
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case <-time.After(pollRecheck):
+		case <-wake:
+			// The feed holds back the newest changes until they settle.
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(changeSettle + 100*time.Millisecond):
+			}
+		}
+	}
+}
@@ -0,0 +1,556 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"todo/internal/fieldcrypt"
+	"todo/internal/render"
+)
+
+const (
+	queueCollection = "queue"
+
+	queuePending = "pending"
+	queueRunning = "running"
+	queueDone    = "done"
+	queueFailed  = "failed"
+
+	// queueLease is how long a claimed job stays invisible to other
+	// workers, and so how long a handler may run.
+	queueLease     = 5 * time.Minute
+	queueRetryBase = 5 * time.Second
+	queueRetryMax  = time.Hour
+
+	// Finished jobs are kept for a week, then expire.
+	queueRetention = 7 * 24 * time.Hour
+)
+
+var (
+	errQueuedJobNotFound = notFoundError("queue.not_found", "queued job not found")
+	errJobIDNotFound     = notFoundError("queue.job_not_found", "job not found")
+)
+
+// jobQueue runs work off the request path. Jobs survive restarts, are
+// retried with backoff when their handler fails, and are dead-lettered
+// after too many attempts.
+type jobQueue interface {
+	Enqueue(ctx context.Context, kind string, payload interface{}) (primitive.ObjectID, error)
+	Get(ctx context.Context, id primitive.ObjectID) (jobView, error)
+	Failed(ctx context.Context, limit int64) ([]failedJob, error)
+	Retry(ctx context.Context, id primitive.ObjectID) error
+}
+
+// queueHandler does one job of its kind. What it returns is kept, as
+// JSON, as the job's result. An error retries the job unless it is
+// permanent.
+type queueHandler func(ctx context.Context, run *jobRun) (interface{}, error)
+
+// jobRun is one attempt at a job: its payload, as enqueued, and a way to
+// report how far along it is.
+type jobRun struct {
+	Payload json.RawMessage
+
+	q  *mongoQueue
+	id primitive.ObjectID
+}
+
+// Progress records that done of total steps are finished. It is best
+// effort: a failed write is logged, and the job carries on.
+func (run *jobRun) Progress(ctx context.Context, done, total int) {
+	if run.q == nil {
+		return
+	}
+	_, err := run.q.coll.UpdateOne(ctx,
+		bson.M{"_id": run.id},
+		bson.M{"$set": bson.M{"progress": jobProgress{Done: done, Total: total}}},
+	)
+	if err != nil && ctx.Err() == nil {
+		log.Printf("queue: recording progress for %s failed: %v", run.id.Hex(), err)
+	}
+}
+
+// jobProgress is how many of a job's steps are finished.
+type jobProgress struct {
+	Done  int `bson:"done" json:"done"`
+	Total int `bson:"total" json:"total"`
+}
+
+// permanentError fails a job at once: retrying will not help.
+type permanentError struct{ error }
+
+func permanent(err error) error { return permanentError{err} }
+
+// queuedJob is a job waiting for, or done with, a worker. The payload is
+// sealed like any other private field, since most carry todo titles.
+type queuedJob struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	Kind        string             `bson:"kind"`
+	Payload     string             `bson:"payload"`
+	Status      string             `bson:"status"`
+	Attempts    int                `bson:"attempts"`
+	NextAttempt time.Time          `bson:"next_attempt"`
+	LastError   string             `bson:"last_error,omitempty"`
+	Progress    *jobProgress       `bson:"progress,omitempty"`
+	Result      string             `bson:"result,omitempty"`
+	CreatedAt   time.Time          `bson:"created_at"`
+	FinishedAt  *time.Time         `bson:"finished_at,omitempty"`
+}
+
+// jobView is a job as its submitter sees it. Error is the last attempt's
+// and may be followed by a retry.
+type jobView struct {
+	ID         string          `json:"id"`
+	Kind       string          `json:"kind"`
+	Status     string          `json:"status"`
+	Attempts   int             `json:"attempts"`
+	Progress   *jobProgress    `json:"progress,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+}
+
+// failedJob is the operator's view of a dead-lettered job. The payload
+// is left out.
+type failedJob struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// mongoQueue keeps jobs in a collection and runs them on a pool of
+// workers. Like the outbox, a job is run at least once: a worker that
+// dies mid-job leaves it to be run again when the lease lapses. Each
+// claim counts as an attempt, so a job that keeps taking its worker down
+// is dead-lettered like one that keeps failing.
+type mongoQueue struct {
+	coll        *mongo.Collection
+	cipher      *fieldcrypt.Cipher
+	workers     int
+	poll        time.Duration
+	maxAttempts int
+	wake        chan struct{}
+	handlers    map[string]queueHandler
+}
+
+func newMongoQueue(coll *mongo.Collection, cipher *fieldcrypt.Cipher, cfg config) *mongoQueue {
+	return &mongoQueue{
+		coll:        coll,
+		cipher:      cipher,
+		workers:     int(cfg.QueueWorkers),
+		poll:        cfg.QueuePoll,
+		maxAttempts: int(cfg.QueueMaxAttempts),
+		wake:        make(chan struct{}, 1),
+		handlers:    map[string]queueHandler{},
+	}
+}
+
+// Handle sets the handler for kind. It must be called before Run.
+func (q *mongoQueue) Handle(kind string, h queueHandler) {
+	q.handlers[kind] = h
+}
+
+func jobPayloadAAD(id primitive.ObjectID) []byte {
+	return []byte(id.Hex() + "/job")
+}
+
+// Enqueue stores a job of kind to be run with payload, which is encoded
+// as JSON.
+func (q *mongoQueue) Enqueue(ctx context.Context, kind string, payload interface{}) (primitive.ObjectID, error) {
+	if _, ok := q.handlers[kind]; !ok {
+		return primitive.NilObjectID, fmt.Errorf("queue: no handler for %q", kind)
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	id := primitive.NewObjectID()
+	sealed, err := q.cipher.Encrypt(string(raw), jobPayloadAAD(id))
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	now := time.Now()
+	_, err = q.coll.InsertOne(ctx, queuedJob{
+		ID:          id,
+		Kind:        kind,
+		Payload:     sealed,
+		Status:      queuePending,
+		NextAttempt: now,
+		CreatedAt:   now,
+	})
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	q.notify()
+	return id, nil
+}
+
+// notify tells an idle worker there is new work without waiting for the
+// next poll.
+func (q *mongoQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *mongoQueue) ensureIndexes(ctx context.Context) error {
+	_, err := q.coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "finished_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(queueRetention / time.Second)),
+		},
+	})
+	return err
+}
+
+// Run works through due jobs on q.workers workers until ctx is
+// cancelled.
+func (q *mongoQueue) Run(ctx context.Context) {
+	for attempt := 0; ; attempt++ {
+		err := q.ensureIndexes(ctx)
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		wait := backoff(attempt)
+		log.Printf("queue: creating indexes failed, retrying in %s: %v", wait.Round(time.Millisecond), err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+	for range q.workers {
+		go q.work(ctx)
+	}
+}
+
+func (q *mongoQueue) work(ctx context.Context) {
+	for {
+		job, err := q.claim(ctx)
+		if err == nil && job != nil {
+			q.process(ctx, job)
+			continue
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Println("queue: claiming job failed:", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-time.After(q.poll):
+		}
+	}
+}
+
+// claim leases the oldest due job this process has a handler for, or
+// returns nil when there is none, and counts the attempt. A running job
+// whose lease has lapsed is due again, unless that was its last attempt.
+func (q *mongoQueue) claim(ctx context.Context) (*queuedJob, error) {
+	kinds := make([]string, 0, len(q.handlers))
+	for kind := range q.handlers {
+		kinds = append(kinds, kind)
+	}
+	now := time.Now()
+	if err := q.deadLetterLapsed(ctx, kinds, now); err != nil {
+		return nil, err
+	}
+	var job queuedJob
+	err := q.coll.FindOneAndUpdate(ctx,
+		bson.M{
+			"$or": bson.A{
+				bson.M{"status": queuePending},
+				bson.M{"status": queueRunning, "attempts": bson.M{"$lt": q.maxAttempts}},
+			},
+			"next_attempt": bson.M{"$lte": now},
+			"kind":         bson.M{"$in": kinds},
+		},
+		bson.M{
+			"$set": bson.M{"status": queueRunning, "next_attempt": now.Add(queueLease)},
+			"$inc": bson.M{"attempts": 1},
+		},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "_id", Value: 1}}).
+			SetReturnDocument(options.After),
+	).Decode(&job)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// deadLetterLapsed fails the running jobs whose lease lapsed on their
+// last attempt: their worker stopped or hung every time, and running them
+// again would most likely do the same.
+func (q *mongoQueue) deadLetterLapsed(ctx context.Context, kinds []string, now time.Time) error {
+	res, err := q.coll.UpdateMany(ctx,
+		bson.M{
+			"status":       queueRunning,
+			"next_attempt": bson.M{"$lte": now},
+			"kind":         bson.M{"$in": kinds},
+			"attempts":     bson.M{"$gte": q.maxAttempts},
+		},
+		bson.M{"$set": bson.M{
+			"status":      queueFailed,
+			"finished_at": now,
+			"last_error":  "the job's lease lapsed before it finished",
+		}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.ModifiedCount > 0 {
+		log.Printf("queue: gave up on %d jobs whose last attempt never finished", res.ModifiedCount)
+	}
+	return nil
+}
+
+// process runs job and records the outcome. Failed jobs are retried with
+// backoff until maxAttempts, then dead-lettered.
+func (q *mongoQueue) process(ctx context.Context, job *queuedJob) {
+	var result interface{}
+	raw, err := q.cipher.Decrypt(job.Payload, jobPayloadAAD(job.ID))
+	if err != nil {
+		err = permanent(err)
+	} else {
+		// The handler must stop before the lease lapses and another
+		// worker can claim the job.
+		hctx, cancel := context.WithDeadline(ctx, job.NextAttempt)
+		result, err = q.handlers[job.Kind](hctx, &jobRun{Payload: json.RawMessage(raw), q: q, id: job.ID})
+		cancel()
+	}
+
+	now := time.Now()
+	if err == nil {
+		set := bson.M{"status": queueDone, "finished_at": now}
+		if result != nil {
+			if b, err := json.Marshal(result); err != nil {
+				log.Printf("queue: encoding the result of %s failed: %v", job.ID.Hex(), err)
+			} else {
+				set["result"] = string(b)
+			}
+		}
+		q.finish(ctx, job, set)
+		return
+	}
+	if ctx.Err() != nil {
+		// Shutting down: the lease runs out and the job is run again.
+		return
+	}
+
+	attempts := job.Attempts
+	set := bson.M{"last_error": err.Error()}
+	var perm permanentError
+	if errors.As(err, &perm) || attempts >= q.maxAttempts {
+		set["status"] = queueFailed
+		set["finished_at"] = now
+		log.Printf("queue: giving up on %s job %s after %d attempts: %v", job.Kind, job.ID.Hex(), attempts, err)
+	} else {
+		set["status"] = queuePending
+		set["next_attempt"] = now.Add(expBackoff(queueRetryBase, queueRetryMax, attempts-1))
+		log.Printf("queue: %s job %s failed, retrying: %v", job.Kind, job.ID.Hex(), err)
+	}
+	q.finish(ctx, job, set)
+}
+
+// finish records the outcome of job while this worker's lease on it
+// holds. After that the job belongs to whoever claimed it next.
+func (q *mongoQueue) finish(ctx context.Context, job *queuedJob, set bson.M) {
+	res, err := q.coll.UpdateOne(ctx,
+		bson.M{"_id": job.ID, "status": queueRunning, "next_attempt": job.NextAttempt},
+		bson.M{"$set": set},
+	)
+	if err != nil {
+		if ctx.Err() == nil {
+			// The lease runs out and the job is run again.
+			log.Printf("queue: recording outcome for %s failed: %v", job.ID.Hex(), err)
+		}
+		return
+	}
+	if res.MatchedCount == 0 {
+		log.Printf("queue: lease on %s lapsed before its outcome was recorded", job.ID.Hex())
+	}
+}
+
+// Get returns the job with id.
+func (q *mongoQueue) Get(ctx context.Context, id primitive.ObjectID) (jobView, error) {
+	var job queuedJob
+	err := q.coll.FindOne(ctx, bson.M{"_id": id}).Decode(&job)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return jobView{}, errJobIDNotFound
+	}
+	if err != nil {
+		return jobView{}, err
+	}
+	v := jobView{
+		ID:         job.ID.Hex(),
+		Kind:       job.Kind,
+		Status:     job.Status,
+		Attempts:   job.Attempts,
+		Progress:   job.Progress,
+		Error:      job.LastError,
+		CreatedAt:  job.CreatedAt,
+		FinishedAt: job.FinishedAt,
+	}
+	if job.Result != "" {
+		v.Result = json.RawMessage(job.Result)
+	}
+	return v, nil
+}
+
+// Failed returns up to limit dead-lettered jobs, newest first.
+func (q *mongoQueue) Failed(ctx context.Context, limit int64) ([]failedJob, error) {
+	cur, err := q.coll.Find(ctx,
+		bson.M{"status": queueFailed},
+		options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(limit),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var jobs []queuedJob
+	if err := cur.All(ctx, &jobs); err != nil {
+		return nil, err
+	}
+	out := make([]failedJob, 0, len(jobs))
+	for _, job := range jobs {
+		out = append(out, failedJob{
+			ID:        job.ID.Hex(),
+			Kind:      job.Kind,
+			Attempts:  job.Attempts,
+			LastError: job.LastError,
+			CreatedAt: job.CreatedAt,
+		})
+	}
+	return out, nil
+}
+
+// Retry puts a dead-lettered job back in the queue with a fresh set of
+// attempts.
+func (q *mongoQueue) Retry(ctx context.Context, id primitive.ObjectID) error {
+	res, err := q.coll.UpdateOne(ctx,
+		bson.M{"_id": id, "status": queueFailed},
+		bson.M{
+			"$set":   bson.M{"status": queuePending, "attempts": 0, "next_attempt": time.Now()},
+			"$unset": bson.M{"finished_at": ""},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errQueuedJobNotFound
+	}
+	q.notify()
+	return nil
+}
+
+// queueJob enqueues a job for the client and answers 202 with where to
+// follow it.
+func (a *app) queueJob(ctx context.Context, w http.ResponseWriter, r *http.Request, kind string, payload interface{}) {
+	id, err := a.queue.Enqueue(ctx, kind, payload)
+	if err != nil {
+		a.fail(w, r, err, "queue.enqueue_failed")
+		return
+	}
+	self := strings.TrimSuffix(todoBase(r), "todo") + "jobs/" + id.Hex()
+	w.Header().Set("Location", self)
+	a.rnd.JSON(w, http.StatusAccepted, render.M{
+		"message": tr(r, "queue.queued"),
+		"id":      id.Hex(),
+		"_links":  links{"self": {Href: self}},
+	})
+}
+
+// clientJobKinds are the jobs clients queue and may look up.
+var clientJobKinds = []string{importJob, exportJob}
+
+func (a *app) fetchJob(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	id, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "queue.id_invalid"),
+		})
+		return
+	}
+	job, err := a.queue.Get(ctx, id)
+	if err == nil && !slices.Contains(clientJobKinds, job.Kind) {
+		err = errJobIDNotFound
+	}
+	if err != nil {
+		a.fail(w, r, err, "queue.job_fetch_failed")
+		return
+	}
+	a.rnd.JSON(w, http.StatusOK, render.M{"data": job})
+}
+
+func (a *app) fetchFailedJobs(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	limit := int64(defaultDeadLetterLimit)
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 1 || n > maxDeadLetterLimit {
+			a.rnd.JSON(w, http.StatusBadRequest, render.M{
+				"message": tr(r, "queue.limit_invalid", maxDeadLetterLimit),
+			})
+			return
+		}
+		limit = n
+	}
+
+	failed, err := a.queue.Failed(ctx, limit)
+	if err != nil {
+		a.fail(w, r, err, "queue.fetch_failed")
+		return
+	}
+	a.rnd.JSON(w, http.StatusOK, render.M{"data": failed})
+}
+
+func (a *app) retryJob(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	id, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "queue.id_invalid"),
+		})
+		return
+	}
+	if err := a.queue.Retry(ctx, id); err != nil {
+		a.fail(w, r, err, "queue.retry_failed")
+		return
+	}
+	a.rnd.JSON(w, http.StatusAccepted, render.M{
+		"message": tr(r, "queue.retrying"),
+	})
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// quickAdd is what parseQuickAdd found in a line like
+// "Pay rent tomorrow 5pm #finance !high".
+type quickAdd struct {
+	Title    string
+	DueDate  *time.Time
+	Tags     []string
+	Priority string
+}
+
+var (
+	clockPattern = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?(am|pm)?$`)
+	weekdays     = map[string]time.Weekday{
+		"sun": time.Sunday, "sunday": time.Sunday,
+		"mon": time.Monday, "monday": time.Monday,
+		"tue": time.Tuesday, "tuesday": time.Tuesday,
+		"wed": time.Wednesday, "wednesday": time.Wednesday,
+		"thu": time.Thursday, "thursday": time.Thursday,
+		"fri": time.Friday, "friday": time.Friday,
+		"sat": time.Saturday, "saturday": time.Saturday,
+	}
+)
+
+// parseQuickAdd pulls #tags, a !priority and an English due date out of
+// text, leaving the rest as the title. Dates are "today", "tomorrow", a
+// weekday (its next occurrence), "in N days" or "in N weeks", or
+// YYYY-MM-DD; a time is "5pm", "5:30pm" or "17:00", optionally after
+// "at". A day without a time is due at its start; a time without a day
+// is today's, or tomorrow's once it has passed. Words that aren't
+// recognised stay in the title.
+func parseQuickAdd(text string, now time.Time, loc *time.Location) quickAdd {
+	now = now.In(loc)
+	var (
+		q     quickAdd
+		title []string
+		day   *time.Time
+		clock *time.Duration
+	)
+	words := strings.Fields(text)
+	for i := 0; i < len(words); i++ {
+		w := words[i]
+		lower := strings.ToLower(w)
+		next := ""
+		if i+1 < len(words) {
+			next = strings.ToLower(words[i+1])
+		}
+
+		switch {
+		case strings.HasPrefix(w, "#") && len(w) > 1:
+			q.Tags = append(q.Tags, w)
+			continue
+		case strings.HasPrefix(w, "!") && priorityLevel(lower[1:]) > 0:
+			q.Priority = lower[1:]
+			continue
+		}
+
+		if day == nil {
+			if d, n := parseDay(lower, next, words, i, now); n > 0 {
+				day = &d
+				i += n - 1
+				continue
+			}
+		}
+		if clock == nil {
+			if lower == "at" {
+				if c, ok := parseClock(next); ok {
+					clock = &c
+					i++
+					continue
+				}
+			}
+			if c, ok := parseClock(lower); ok {
+				clock = &c
+				continue
+			}
+		}
+		title = append(title, w)
+	}
+
+	q.Title = strings.Join(title, " ")
+	if q.Title == "" {
+		q.Title = strings.TrimSpace(text)
+	}
+	q.Tags = normalizeTags(q.Tags)
+
+	switch {
+	case day != nil && clock != nil:
+		due := at(*day, *clock)
+		q.DueDate = &due
+	case day != nil:
+		q.DueDate = day
+	case clock != nil:
+		due := at(now, *clock)
+		if !due.After(now) {
+			due = at(now.AddDate(0, 0, 1), *clock)
+		}
+		q.DueDate = &due
+	}
+	return q
+}
+
+// parseDay reads a day starting at words[i] and reports how many words
+// it took, or 0 for none.
+func parseDay(w, next string, words []string, i int, now time.Time) (time.Time, int) {
+	today := startOfDay(now)
+	switch w {
+	case "today":
+		return today, 1
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), 1
+	case "in":
+		if i+2 >= len(words) {
+			return time.Time{}, 0
+		}
+		n, err := strconv.Atoi(next)
+		if err != nil || n < 0 || n > 3650 {
+			return time.Time{}, 0
+		}
+		switch strings.ToLower(words[i+2]) {
+		case "day", "days":
+			return today.AddDate(0, 0, n), 3
+		case "week", "weeks":
+			return today.AddDate(0, 0, 7*n), 3
+		}
+		return time.Time{}, 0
+	}
+	if wd, ok := weekdays[w]; ok {
+		ahead := (int(wd) - int(today.Weekday()) + 7) % 7
+		if ahead == 0 {
+			ahead = 7
+		}
+		return today.AddDate(0, 0, ahead), 1
+	}
+	if d, err := time.ParseInLocation(time.DateOnly, w, now.Location()); err == nil {
+		return d, 1
+	}
+	return time.Time{}, 0
+}
+
+// parseClock reads "5pm", "5:30am" or "17:00" as a time after midnight.
+func parseClock(w string) (time.Duration, bool) {
+	m := clockPattern.FindStringSubmatch(w)
+	// A bare number is more likely part of the title than an hour.
+	if m == nil || m[2] == "" && m[3] == "" {
+		return 0, false
+	}
+	hour, _ := strconv.Atoi(m[1])
+	minute, _ := strconv.Atoi(m[2])
+	switch m[3] {
+	case "am", "pm":
+		if hour < 1 || hour > 12 {
+			return 0, false
+		}
+		hour %= 12
+		if m[3] == "pm" {
+			hour += 12
+		}
+	default:
+		if hour > 23 {
+			return 0, false
+		}
+	}
+	if minute > 59 {
+		return 0, false
+	}
+	return time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute, true
+}
+
+func startOfDay(t time.Time) time.Time {
+	return at(t, 0)
+}
+
+// at is clock after midnight on t's day, by the wall clock.
+func at(t time.Time, clock time.Duration) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), int(clock/time.Hour), int(clock%time.Hour/time.Minute), 0, 0, t.Location())
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseQuickAdd(t *testing.T) {
+	// A Thursday morning.
+	now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	day := func(d, h, m int) *time.Time {
+		v := time.Date(2026, 1, d, h, m, 0, 0, time.UTC)
+		return &v
+	}
+	tests := []struct {
+		text string
+		want quickAdd
+	}{
+		{"Call mom", quickAdd{Title: "Call mom"}},
+		{"Pay rent tomorrow 5pm #finance !high", quickAdd{Title: "Pay rent", DueDate: day(2, 17, 0), Tags: []string{"finance"}, Priority: "high"}},
+		{"Lunch 12:00", quickAdd{Title: "Lunch", DueDate: day(1, 12, 0)}},
+		{"Standup at 9:30am", quickAdd{Title: "Standup", DueDate: day(2, 9, 30)}},
+		{"Report today", quickAdd{Title: "Report", DueDate: day(1, 0, 0)}},
+		{"Review friday", quickAdd{Title: "Review", DueDate: day(2, 0, 0)}},
+		{"Review Thursday", quickAdd{Title: "Review", DueDate: day(8, 0, 0)}},
+		{"Ship in 3 days", quickAdd{Title: "Ship", DueDate: day(4, 0, 0)}},
+		{"Ship in 2 weeks 8am", quickAdd{Title: "Ship", DueDate: day(15, 8, 0)}},
+		{"Dentist 2026-01-20 at 8am", quickAdd{Title: "Dentist", DueDate: day(20, 8, 0)}},
+		{"Buy 2 apples", quickAdd{Title: "Buy 2 apples"}},
+		{"Eat in 3 apples", quickAdd{Title: "Eat in 3 apples"}},
+		{"Meet at 13pm", quickAdd{Title: "Meet at 13pm"}},
+		{"Fix it !urgent", quickAdd{Title: "Fix it !urgent"}},
+		{"Plan #Work #work !low", quickAdd{Title: "Plan", Tags: []string{"work"}, Priority: "low"}},
+		{"#inbox", quickAdd{Title: "#inbox", Tags: []string{"inbox"}}},
+	}
+	for _, tt := range tests {
+		got := parseQuickAdd(tt.text, now, time.UTC)
+		if got.Title != tt.want.Title || got.Priority != tt.want.Priority || !slices.Equal(got.Tags, tt.want.Tags) {
+			t.Errorf("parseQuickAdd(%q) = %q %q %q, want %q %q %q", tt.text,
+				got.Title, got.Tags, got.Priority, tt.want.Title, tt.want.Tags, tt.want.Priority)
+		}
+		if (got.DueDate == nil) != (tt.want.DueDate == nil) || got.DueDate != nil && !got.DueDate.Equal(*tt.want.DueDate) {
+			t.Errorf("parseQuickAdd(%q) due = %v, want %v", tt.text, got.DueDate, tt.want.DueDate)
+		}
+	}
+}
+
+func TestParseQuickAddLocation(t *testing.T) {
+	// 23:00 UTC is already the next day in Berlin.
+	berlin := time.FixedZone("CET", 3600)
+	now := time.Date(2026, 1, 1, 23, 0, 0, 0, time.UTC)
+	got := parseQuickAdd("Call tomorrow 9am", now, berlin)
+	want := time.Date(2026, 1, 3, 9, 0, 0, 0, berlin)
+	if got.DueDate == nil || !got.DueDate.Equal(want) {
+		t.Errorf("due = %v, want %v", got.DueDate, want)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"todo/internal/render"
+)
+
+const quotaMaxTodos string = "max_todos"
+
+// quota is one configurable limit and the current usage against it.
+// A zero Limit means unlimited.
+type quota struct {
+	Name  string `json:"name"`
+	Limit int64  `json:"limit"`
+	Used  int64  `json:"used"`
+}
+
+// loadQuotaLimits reads limits such as QUOTA_MAX_TODOS from the environment.
+func loadQuotaLimits() (map[string]int64, error) {
+	limits := map[string]int64{}
+	for name, env := range map[string]string{quotaMaxTodos: "QUOTA_MAX_TODOS"} {
+		v := os.Getenv(env)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("%s must be a non-negative integer, got %q", env, v)
+		}
+		limits[name] = n
+	}
+	return limits, nil
+}
+
+func (a *app) todoQuota(ctx context.Context) (quota, error) {
+	n, err := a.todos.Count(ctx, listQuery{})
+	return quota{Name: quotaMaxTodos, Limit: a.cfg.Quotas[quotaMaxTodos], Used: n}, err
+}
+
+// allows reports whether n more items fit within the quota.
+func (q quota) allows(n int64) bool {
+	return q.Limit == 0 || q.Used+n <= q.Limit
+}
+
+// checkTodoQuota writes a 403 naming the exceeded quota and returns false
+// when n more todos would not fit. Counting is skipped when unlimited.
+func (a *app) checkTodoQuota(ctx context.Context, w http.ResponseWriter, r *http.Request, n int64) bool {
+	if a.cfg.Quotas[quotaMaxTodos] == 0 {
+		return true
+	}
+	q, err := a.todoQuota(ctx)
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "quota.fetch_failed"),
+			"error":   err.Error(),
+		})
+		return false
+	}
+	if !q.allows(n) {
+		a.rnd.JSON(w, http.StatusForbidden, render.M{
+			"message": tr(r, "quota.exceeded", q.Name),
+			"quota":   q,
+		})
+		return false
+	}
+	return true
+}
+
+func (a *app) fetchUsage(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	q, err := a.todoQuota(ctx)
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "quota.fetch_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	a.rnd.JSON(w, http.StatusOK, render.M{
+		"data": []quota{q},
+	})
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+
+	"todo/internal/render"
+	"todo/internal/report"
+)
+
+// recoverer turns a panicking handler into a 500 that carries the request
+// ID, logs the stack and, when a reporter is configured, forwards it.
+func (a *app) recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				// net/http uses this to abort a response on purpose.
+				panic(v)
+			}
+
+			id := middleware.GetReqID(r.Context())
+			log.Printf("panic serving %s %s (request %s): %v\n%s", r.Method, r.URL.Path, id, v, debug.Stack())
+			if a.reporter != nil {
+				p := report.Panic{
+					Value:     v,
+					Stack:     report.Callers(0),
+					RequestID: id,
+					Method:    r.Method,
+					URL:       r.URL.String(),
+				}
+				go func() {
+					ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+					defer cancel()
+					if err := a.reporter.Report(ctx, p); err != nil {
+						log.Println("reporting panic failed:", err)
+					}
+				}()
+			}
+
+			a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+				"message":    tr(r, "server.internal_error", id),
+				"request_id": id,
+			})
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"todo/internal/render"
+)
+
+// The ways one todo can be linked to another. relates-to goes both ways;
+// the others read from the todo holding the link, and from the other end
+// under their inverse name.
+const (
+	relatesTo    = "relates-to"
+	duplicates   = "duplicates"
+	follows      = "follows"
+	duplicatedBy = "duplicated-by"
+	followedBy   = "followed-by"
+
+	maxRelations = 100
+)
+
+var (
+	relationTypes = []string{relatesTo, duplicates, follows}
+	// relationInverse names each type as seen from the linked todo.
+	relationInverse = map[string]string{
+		relatesTo:  relatesTo,
+		duplicates: duplicatedBy,
+		follows:    followedBy,
+	}
+)
+
+// todoRelation is a link from the todo holding it to ID.
+type todoRelation struct {
+	Type string             `bson:"type"`
+	ID   primitive.ObjectID `bson:"id"`
+}
+
+// relatedTodo is a linked todo as clients see it, with enough of it to
+// show without fetching it.
+type relatedTodo struct {
+	Type      string `json:"type"`
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	Completed bool   `json:"completed"`
+	Links     links  `json:"_links"`
+}
+
+// relation works out which todo holds a link of typ between id and
+// other: id itself for the forward names, other for the inverse ones.
+// ok is false for an unknown type.
+func relation(id primitive.ObjectID, typ string, other primitive.ObjectID) (holder primitive.ObjectID, rel todoRelation, ok bool) {
+	if slices.Contains(relationTypes, typ) {
+		return id, todoRelation{Type: typ, ID: other}, true
+	}
+	for fwd, inv := range relationInverse {
+		if inv == typ {
+			return other, todoRelation{Type: fwd, ID: id}, true
+		}
+	}
+	return id, rel, false
+}
+
+// fetchRelated lists the todos linked to {id}, both the links it holds
+// and those pointing at it, with their titles and states.
+func (a *app) fetchRelated(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	id, ok := a.todoID(w, r)
+	if !ok {
+		return
+	}
+	t, err := a.todos.Get(ctx, id)
+	if err != nil {
+		a.fail(w, r, err, "todo.fetch_failed")
+		return
+	}
+
+	var targets []todoModel
+	if len(t.Related) > 0 {
+		ids := make([]primitive.ObjectID, len(t.Related))
+		for i, rel := range t.Related {
+			ids[i] = rel.ID
+		}
+		targets, err = a.todos.List(ctx, listQuery{IDs: ids})
+	}
+	var linking []todoModel
+	if err == nil {
+		linking, err = a.todos.List(ctx, listQuery{LinkedTo: id})
+	}
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "todo.fetch_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	base := todoBase(r)
+	self := base + "/" + id.Hex() + "/links/"
+	out := []relatedTodo{}
+	add := func(typ string, o todoModel) {
+		out = append(out, relatedTodo{
+			Type:      typ,
+			ID:        o.ID.Hex(),
+			Title:     o.Title,
+			Completed: o.Completed,
+			Links: links{
+				"todo":   {Href: base + "/" + o.ID.Hex()},
+				"delete": {Href: self + typ + "/" + o.ID.Hex(), Method: http.MethodDelete},
+			},
+		})
+	}
+	byID := make(map[primitive.ObjectID]todoModel, len(targets))
+	for _, o := range targets {
+		byID[o.ID] = o
+	}
+	for _, rel := range t.Related {
+		if o, ok := byID[rel.ID]; ok {
+			add(rel.Type, o)
+		}
+	}
+	for _, o := range linking {
+		for _, rel := range o.Related {
+			if rel.ID == id {
+				add(relationInverse[rel.Type], o)
+			}
+		}
+	}
+	a.rnd.JSON(w, http.StatusOK, render.M{
+		"data":   out,
+		"_links": links{"self": {Href: self}, "todo": {Href: base + "/" + id.Hex()}},
+	})
+}
+
+// relateTodo links {id} to the todo in {"type": ..., "id": ...}. The type
+// may be an inverse name, which stores the link on the other todo.
+func (a *app) relateTodo(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	id, ok := a.todoID(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Type string `json:"type"`
+		ID   string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "request.invalid_body"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	other, err := primitive.ObjectIDFromHex(strings.TrimSpace(req.ID))
+	if err != nil {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "todo.id_invalid"),
+		})
+		return
+	}
+	holder, rel, ok := a.relation(w, r, id, req.Type, other)
+	if !ok {
+		return
+	}
+	if other == id {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "todo.link_self"),
+		})
+		return
+	}
+
+	_, err = a.todos.Relate(ctx, holder, rel)
+	if holder != id {
+		// Relate names the holder not found, and the todo it links to
+		// missing; they are the body's todo and {id} here.
+		switch {
+		case errors.Is(err, errTodoNotFound):
+			err = errRelatedNotFound
+		case errors.Is(err, errRelatedNotFound):
+			err = errTodoNotFound
+		}
+	}
+	if errors.Is(err, errTooManyRelations) {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "todo.too_many_links", maxRelations),
+		})
+		return
+	}
+	if err != nil {
+		a.fail(w, r, err, "todo.update_failed")
+		return
+	}
+	a.rnd.JSON(w, http.StatusCreated, render.M{
+		"message": tr(r, "todo.linked"),
+		"_links":  links{"links": {Href: todoBase(r) + "/" + id.Hex() + "/links/"}},
+	})
+}
+
+// unrelateTodo removes the link of {type} between {id} and {target},
+// whichever of the two holds it.
+func (a *app) unrelateTodo(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	id, ok := a.todoID(w, r)
+	if !ok {
+		return
+	}
+	other, err := primitive.ObjectIDFromHex(strings.TrimSpace(chi.URLParam(r, "target")))
+	if err != nil {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "todo.id_invalid"),
+		})
+		return
+	}
+	holder, rel, ok := a.relation(w, r, id, chi.URLParam(r, "type"), other)
+	if !ok {
+		return
+	}
+	if _, err := a.todos.Unrelate(ctx, holder, rel); err != nil {
+		a.fail(w, r, err, "todo.update_failed")
+		return
+	}
+	a.rnd.JSON(w, http.StatusOK, render.M{
+		"message": tr(r, "todo.unlinked"),
+		"_links":  links{"links": {Href: todoBase(r) + "/" + id.Hex() + "/links/"}},
+	})
+}
+
+// relation is the package-level relation, answering 400 itself for an
+// unknown type.
+func (a *app) relation(w http.ResponseWriter, r *http.Request, id primitive.ObjectID, typ string, other primitive.ObjectID) (primitive.ObjectID, todoRelation, bool) {
+	holder, rel, ok := relation(id, typ, other)
+	if !ok {
+		names := append(slices.Clone(relationTypes), duplicatedBy, followedBy)
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "todo.link_type_invalid", strings.Join(names, ", ")),
+		})
+	}
+	return holder, rel, ok
+}
@@ -0,0 +1,9 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package main
+
+import "errors"
+
+func setReusePort(fd uintptr) error {
+	return errors.New("REUSE_PORT is not supported on this platform")
+}
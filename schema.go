@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"todo/internal/migrations"
+)
+
+// schemaMigrations is the ordered history of schema changes. Append new
+// ones with the next version; never edit or renumber one that has shipped.
+var schemaMigrations = []migrations.Migration{
+	{
+		Version: 1,
+		Name:    "todo_created_at_index",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection(collectionName).Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys: bson.D{{Key: "created_at", Value: 1}},
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection(collectionName).Indexes().DropOne(ctx, "created_at_1")
+			return err
+		},
+	},
+	{
+		Version: 2,
+		Name:    "todo_board_position_index",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection(collectionName).Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: "column_id", Value: 1}, {Key: "position", Value: 1}},
+				Options: options.Index().SetSparse(true),
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection(collectionName).Indexes().DropOne(ctx, "column_id_1_position_1")
+			return err
+		},
+	},
+	{
+		Version: 3,
+		Name:    "todo_blocked_by_index",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection(collectionName).Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys: bson.D{{Key: "blocked_by", Value: 1}},
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection(collectionName).Indexes().DropOne(ctx, "blocked_by_1")
+			return err
+		},
+	},
+	{
+		Version: 4,
+		Name:    "todo_tags_and_parent_indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection(collectionName).Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{Keys: bson.D{{Key: "tags", Value: 1}}},
+				{Keys: bson.D{{Key: "parent_id", Value: 1}}, Options: options.Index().SetSparse(true)},
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			indexes := db.Collection(collectionName).Indexes()
+			if _, err := indexes.DropOne(ctx, "tags_1"); err != nil {
+				return err
+			}
+			_, err := indexes.DropOne(ctx, "parent_id_1")
+			return err
+		},
+	},
+	{
+		Version: 5,
+		Name:    "todo_title_key_index",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection(collectionName).Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: "title_key", Value: 1}, {Key: "completed", Value: 1}},
+				Options: options.Index().SetSparse(true),
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection(collectionName).Indexes().DropOne(ctx, "title_key_1_completed_1")
+			return err
+		},
+	},
+	{
+		// Todos written before the change feed get their creation time,
+		// so the feed reaches them.
+		Version: 6,
+		Name:    "todo_change_feed",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			todos := db.Collection(collectionName)
+			if _, err := todos.UpdateMany(ctx,
+				bson.M{"updated_at": bson.M{"$exists": false}},
+				mongo.Pipeline{{{Key: "$set", Value: bson.M{"updated_at": "$created_at"}}}},
+			); err != nil {
+				return err
+			}
+			if _, err := todos.Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys: bson.D{{Key: "updated_at", Value: 1}, {Key: "_id", Value: 1}},
+			}); err != nil {
+				return err
+			}
+			_, err := db.Collection(tombstonesCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: "deleted_at", Value: 1}},
+				Options: options.Index().SetExpireAfterSeconds(int32(changeRetention / time.Second)),
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			if _, err := db.Collection(collectionName).Indexes().DropOne(ctx, "updated_at_1__id_1"); err != nil {
+				return err
+			}
+			_, err := db.Collection(tombstonesCollection).Indexes().DropOne(ctx, "deleted_at_1")
+			return err
+		},
+	},
+	{
+		Version: 7,
+		Name:    "todo_activity",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection(activityCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: "at", Value: 1}},
+				Options: options.Index().SetExpireAfterSeconds(int32(activityRetention / time.Second)),
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection(activityCollection).Indexes().DropOne(ctx, "at_1")
+			return err
+		},
+	},
+	{
+		Version: 8,
+		Name:    "todo_custom_fields",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			// One wildcard index serves filters on whichever fields get
+			// defined.
+			_, err := db.Collection(collectionName).Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys: bson.D{{Key: "custom.$**", Value: 1}},
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection(collectionName).Indexes().DropOne(ctx, "custom.$**_1")
+			return err
+		},
+	},
+	{
+		Version: 9,
+		Name:    "todo_location",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection(collectionName).Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys: bson.D{{Key: "location", Value: "2dsphere"}},
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection(collectionName).Indexes().DropOne(ctx, "location_2dsphere")
+			return err
+		},
+	},
+	{
+		Version: 10,
+		Name:    "download_expiry",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection(downloadsCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: "expires_at", Value: 1}},
+				Options: options.Index().SetExpireAfterSeconds(0),
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection(downloadsCollection).Indexes().DropOne(ctx, "expires_at_1")
+			return err
+		},
+	},
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"cmp"
+	"html"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"todo/internal/render"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+	maxSearchTerms     = 10
+
+	// Titles longer than this are cut down to a snippet around the first
+	// match.
+	snippetRunes = 120
+)
+
+// searchResult is a matching todo with where it matched. Matches holds
+// [start, end) offsets in Unicode code points into each field; Highlight
+// has the same text, HTML-escaped, with matches wrapped in <mark> and long
+// values trimmed to a snippet.
+type searchResult struct {
+	todo
+	Matches   map[string][][2]int `json:"matches"`
+	Highlight map[string]string   `json:"highlight"`
+	first     int
+}
+
+// searchTodos serves the todos whose title contains every word of ?q=,
+// ignoring case, best match first. Titles may be encrypted at rest, so
+// matching happens here rather than in the database.
+func (a *app) searchTodos(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	terms := strings.Fields(strings.Map(unicode.ToLower, r.URL.Query().Get("q")))
+	if len(terms) == 0 || len(terms) > maxSearchTerms {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "search.query_invalid", maxSearchTerms),
+		})
+		return
+	}
+	// MAX_PAGE_SIZE bounds search results like list pages.
+	maxLimit := min(maxSearchLimit, int(a.cfg.MaxPageSize))
+	limit := min(defaultSearchLimit, maxLimit)
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxLimit {
+			a.rnd.JSON(w, http.StatusBadRequest, render.M{
+				"message": tr(r, "search.limit_invalid", maxLimit),
+			})
+			return
+		}
+		limit = n
+	}
+
+	q := listQuery{Open: r.URL.Query().Get("completed") == "false"}
+	if tags := normalizeTags([]string{r.URL.Query().Get("tag")}); tags != nil {
+		q.Tag = tags[0]
+	}
+	todos, err := a.todos.List(ctx, q)
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "todo.fetch_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	base := todoBase(r)
+	results := []searchResult{}
+	for _, tm := range todos {
+		spans := matchTerms(tm.Title, terms)
+		if spans == nil {
+			continue
+		}
+		t := tm.toTodo()
+		t.Links = todoLinks(base, t.ID)
+		results = append(results, searchResult{
+			todo:      t,
+			Matches:   map[string][][2]int{"title": spans},
+			Highlight: map[string]string{"title": highlight(tm.Title, spans)},
+			first:     spans[0][0],
+		})
+	}
+	// Earlier matches in shorter titles rank first; newest breaks ties.
+	slices.SortStableFunc(results, func(x, y searchResult) int {
+		return cmp.Or(
+			cmp.Compare(x.first, y.first),
+			cmp.Compare(len(x.Title), len(y.Title)),
+			y.CreatedAt.Compare(x.CreatedAt),
+		)
+	})
+	total := len(results)
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	a.rnd.JSON(w, http.StatusOK, render.M{
+		"data":  results,
+		"total": total,
+	})
+}
+
+// matchTerms returns the merged, ordered spans where terms occur in s, or
+// nil unless every term occurs. Terms must already be lower case.
+func matchTerms(s string, terms []string) [][2]int {
+	text := []rune(s)
+	for i, c := range text {
+		text[i] = unicode.ToLower(c)
+	}
+	var spans [][2]int
+	for _, term := range terms {
+		needle := []rune(term)
+		found := false
+		for i := 0; i+len(needle) <= len(text); i++ {
+			if slices.Equal(text[i:i+len(needle)], needle) {
+				spans = append(spans, [2]int{i, i + len(needle)})
+				found = true
+			}
+		}
+		if !found {
+			return nil
+		}
+	}
+
+	slices.SortFunc(spans, func(x, y [2]int) int { return cmp.Compare(x[0], y[0]) })
+	merged := spans[:1]
+	for _, sp := range spans[1:] {
+		last := &merged[len(merged)-1]
+		if sp[0] <= last[1] {
+			last[1] = max(last[1], sp[1])
+			continue
+		}
+		merged = append(merged, sp)
+	}
+	return merged
+}
+
+// highlight escapes s for HTML and marks spans, trimming long values to
+// snippetRunes around the first span.
+func highlight(s string, spans [][2]int) string {
+	text := []rune(s)
+	from, to := 0, len(text)
+	if len(text) > snippetRunes {
+		from = max(0, spans[0][0]-snippetRunes/4)
+		to = min(len(text), from+snippetRunes)
+		from = max(0, to-snippetRunes)
+	}
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	pos := from
+	for _, sp := range spans {
+		start, end := max(sp[0], from), min(sp[1], to)
+		if start >= end {
+			continue
+		}
+		b.WriteString(html.EscapeString(string(text[pos:start])))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(string(text[start:end])))
+		b.WriteString("</mark>")
+		pos = end
+	}
+	b.WriteString(html.EscapeString(string(text[pos:to])))
+	if to < len(text) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
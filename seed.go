@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var seedTitles = []string{
+	"Renew passport",
+	"Book dentist appointment",
+	"Pay electricity bill",
+	"Call mum",
+	"Buy groceries for the week",
+	"Fix the leaking kitchen tap",
+	"Review pull request for the login page",
+	"Write quarterly report",
+	"Prepare slides for Monday stand-up",
+	"Cancel unused gym membership",
+	"Back up laptop",
+	"Water the plants",
+	"Return library books",
+	"Plan weekend hike",
+	"Order birthday present for Sam",
+	"Update CV",
+	"Read chapter 4 of the design book",
+	"Schedule car service",
+	"Clean out the garage",
+	"File expense receipts",
+	"Reply to landlord about the lease",
+	"Try the new pasta recipe",
+	"Set up automatic savings transfer",
+	"Sort holiday photos",
+	"Replace smoke alarm batteries",
+}
+
+// seedCommand fills a development database with sample todos. It goes
+// through the repository, so encryption applies.
+func seedCommand(ctx context.Context, cfg config, args []string) int {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	n := fs.Int("n", len(seedTitles), "number of todos to create")
+	reset := fs.Bool("reset", false, "delete existing todos first")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if !cfg.DevMode {
+		fmt.Fprintln(os.Stderr, "seed only runs with APP_ENV=development")
+		return 1
+	}
+
+	todos, _, _, closeFn, err := repositories(ctx, cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer closeFn()
+
+	if *reset {
+		existing, err := todos.List(ctx, listQuery{})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		for _, t := range existing {
+			if err := todos.Delete(ctx, t.ID, nil); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+		}
+		fmt.Printf("deleted %d todos\n", len(existing))
+	}
+
+	now := time.Now()
+	for i := 0; i < *n; i++ {
+		// Spread creation over the last month, roughly a third done.
+		created := now.Add(-time.Duration(rand.Int64N(int64(30 * 24 * time.Hour))))
+		t := todoModel{
+			ID:        primitive.NewObjectID(),
+			Title:     seedTitles[i%len(seedTitles)],
+			Completed: rand.IntN(3) == 0,
+			CreatedAt: created,
+		}
+		if err := todos.Create(ctx, t); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	fmt.Printf("created %d todos\n", *n)
+	return 0
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"todo/internal/render"
+)
+
+// todoService holds the rules for changing todos, whichever way the
+// change comes in: the API, a form, sync or an automation hook. Handlers
+// decode the request and render the outcome; the service decides.
+type todoService struct {
+	todos todoRepository
+}
+
+// blockedError is why a todo can't be completed: these todos it waits on
+// are still open.
+type blockedError struct {
+	Blockers []primitive.ObjectID
+}
+
+func (e *blockedError) Error() string {
+	return fmt.Sprintf("blocked by %d open todos", len(e.Blockers))
+}
+
+func (e *blockedError) Is(target error) bool { return target == errConflict }
+
+func (e *blockedError) body(r *http.Request) render.M {
+	return render.M{"message": tr(r, "todo.blocked"), "blocked_by": e.Blockers}
+}
+
+// Complete completes id and, to any depth, its open subtasks. Unless
+// force is set, it fails with *blockedError while id waits on an open
+// blocker. Subtasks are completed with their parent whatever they wait on.
+func (s todoService) Complete(ctx context.Context, id primitive.ObjectID, force bool) error {
+	if err := s.checkUnblocked(ctx, id, force); err != nil {
+		return err
+	}
+	if err := s.todos.SetCompleted(ctx, id, true); err != nil {
+		return err
+	}
+	return s.completeSubtasks(ctx, id)
+}
+
+// Update stores next over the todo with its ID, if it was last written
+// at one of match. When that completes the todo, the rules of Complete
+// apply.
+func (s todoService) Update(ctx context.Context, next todoModel, force bool, match revisions) error {
+	completing := false
+	if next.Completed {
+		current, err := s.todos.Get(ctx, next.ID)
+		if err != nil {
+			return err
+		}
+		if completing = !current.Completed; completing {
+			if err := s.checkUnblocked(ctx, next.ID, force); err != nil {
+				return err
+			}
+		}
+	}
+	if err := s.todos.Update(ctx, next, match); err != nil {
+		return err
+	}
+	if completing {
+		return s.completeSubtasks(ctx, next.ID)
+	}
+	return nil
+}
+
+func (s todoService) checkUnblocked(ctx context.Context, id primitive.ObjectID, force bool) error {
+	if force {
+		return nil
+	}
+	open, err := s.todos.OpenBlockers(ctx, id)
+	if err != nil {
+		return err
+	}
+	if len(open) > 0 {
+		return &blockedError{Blockers: open}
+	}
+	return nil
+}
+
+func (s todoService) completeSubtasks(ctx context.Context, parent primitive.ObjectID) error {
+	subtasks, err := s.todos.List(ctx, listQuery{Parent: parent, Open: true, Fields: []string{"_id"}})
+	if err != nil {
+		return err
+	}
+	for _, t := range subtasks {
+		if err := s.todos.SetCompleted(ctx, t.ID, true); err != nil {
+			return err
+		}
+		if err := s.completeSubtasks(ctx, t.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+	// Embedded so timezone validation works on images without zoneinfo.
+	_ "time/tzdata"
+
+	"github.com/go-chi/chi"
+
+	"todo/internal/render"
+)
+
+const (
+	settingsCollection string = "settings"
+	// The app has no accounts, so preferences live in one document that
+	// belongs to whoever runs the instance.
+	settingsID string = "me"
+)
+
+type settings struct {
+	Timezone     string `bson:"timezone" json:"timezone"`
+	Theme        string `bson:"theme" json:"theme"`
+	ItemsPerPage int    `bson:"items_per_page" json:"items_per_page"`
+	DigestOptIn  bool   `bson:"digest_opt_in" json:"digest_opt_in"`
+	// UpdatedAt is when the settings were last saved, zero until then.
+	UpdatedAt time.Time `bson:"updated_at,omitempty" json:"-"`
+}
+
+var themes = map[string]bool{"system": true, "light": true, "dark": true}
+
+// defaultSettings are the settings until they are saved, with pages of
+// itemsPerPage todos.
+func defaultSettings(itemsPerPage int) settings {
+	return settings{
+		Timezone:     "UTC",
+		Theme:        "system",
+		ItemsPerPage: itemsPerPage,
+	}
+}
+
+// location is the configured timezone, or UTC if it no longer loads.
+func (s settings) location() *time.Location {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// validate returns the message key describing the first invalid field.
+// Pages may hold up to maxItemsPerPage todos.
+func (s settings) validate(maxItemsPerPage int) string {
+	if s.Timezone == "" || s.Timezone == "Local" {
+		return "settings.timezone_invalid"
+	}
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return "settings.timezone_invalid"
+	}
+	if !themes[s.Theme] {
+		return "settings.theme_invalid"
+	}
+	if s.ItemsPerPage < 1 || s.ItemsPerPage > maxItemsPerPage {
+		return "settings.items_per_page_invalid"
+	}
+	return ""
+}
+
+func (a *app) fetchSettings(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	s, err := a.settings.Load(ctx)
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "settings.fetch_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	a.rnd.JSON(w, http.StatusOK, render.M{
+		"data": s,
+	})
+}
+
+func (a *app) updateSettings(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	s := defaultSettings(int(a.cfg.PageSize))
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "request.invalid_body"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	if key := s.validate(int(a.cfg.MaxPageSize)); key != "" {
+		var args []interface{}
+		if key == "settings.items_per_page_invalid" {
+			args = append(args, a.cfg.MaxPageSize)
+		}
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, key, args...),
+		})
+		return
+	}
+
+	if err := a.settings.Save(ctx, s); err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "settings.update_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	a.rnd.JSON(w, http.StatusOK, render.M{
+		"message": tr(r, "settings.updated"),
+		"data":    s,
+	})
+}
+
+func (a *app) meHandlers() http.Handler {
+	rg := chi.NewRouter()
+	rg.Group(func(r chi.Router) {
+		r.Get("/settings", a.fetchSettings)
+		r.Put("/settings", a.updateSettings)
+		r.Get("/usage", a.fetchUsage)
+		r.Get("/notifications", a.fetchNotifications)
+		r.Put("/notifications", a.updateNotifications)
+		r.Post("/notifications/test", a.testNotifications)
+		r.Post("/location", a.checkIn)
+	})
+	return rg
+}
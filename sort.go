@@ -0,0 +1,73 @@
+package main
+
+import (
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"todo/internal/render"
+)
+
+// todoSorts maps the names clients use in ?sort= to stored fields.
+var todoSorts = map[string]string{
+	"id":           "_id",
+	"title":        "title",
+	"completed":    "completed",
+	"created_at":   "created_at",
+	"updated_at":   "updated_at",
+	"completed_at": "completed_at",
+	"start_date":   "start_date",
+	"due_date":     "due_date",
+	"priority":     "priority",
+}
+
+// sortNames are what ?sort= accepts, for error messages.
+func sortNames() []string {
+	return append(slices.Sorted(maps.Keys(todoSorts)), customFilterPrefix+"<key>")
+}
+
+// sortKey orders a list on one stored field.
+type sortKey struct {
+	Field string
+	Desc  bool
+}
+
+// parseSort reads ?sort=-created_at,title: a comma-separated list of
+// fields, each descending when prefixed with "-". It writes a 400 and
+// returns ok false for unknown fields, and for title when titles are
+// encrypted, since ciphertext order says nothing about the title.
+// custom.<key> sorts on a custom field; the key isn't looked up, and todos
+// without a value sort first.
+func (a *app) parseSort(w http.ResponseWriter, r *http.Request) (keys []sortKey, ok bool) {
+	v := r.URL.Query().Get("sort")
+	if v == "" {
+		return nil, true
+	}
+	seen := map[string]bool{}
+	for _, name := range strings.Split(v, ",") {
+		name = strings.TrimSpace(name)
+		desc := strings.HasPrefix(name, "-")
+		name = strings.TrimPrefix(name, "-")
+		field, known := todoSorts[name]
+		if key, ok := strings.CutPrefix(name, customFilterPrefix); ok && customKeyPattern.MatchString(key) {
+			field, known = name, true
+		}
+		if !known {
+			a.rnd.JSON(w, http.StatusBadRequest, render.M{
+				"message": tr(r, "request.sort_invalid", strings.Join(sortNames(), ", ")),
+			})
+			return nil, false
+		}
+		if field == "title" && a.cfg.EncryptionKey != "" {
+			a.rnd.JSON(w, http.StatusBadRequest, render.M{"message": tr(r, "request.sort_encrypted")})
+			return nil, false
+		}
+		// Mongo rejects a field named twice; the first mention wins.
+		if !seen[field] {
+			seen[field] = true
+			keys = append(keys, sortKey{Field: field, Desc: desc})
+		}
+	}
+	return keys, true
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// fingerprinted matches bundler output such as app.3f2a9c1d.js or
+// index-B7xK29qa.css, whose names change whenever their content does.
+var fingerprinted = regexp.MustCompile(`[.-]([A-Za-z0-9_]{8,})\.[A-Za-z0-9]+$`)
+
+// spaHandler serves a built frontend bundle from dir under prefix. Paths
+// without a file extension that don't exist fall back to index.html so the
+// client-side router can handle them.
+func spaHandler(prefix, dir string) http.Handler {
+	root := http.Dir(dir)
+	return http.StripPrefix(prefix, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Clean("/" + r.URL.Path)
+		if name == "/" {
+			name = "/index.html"
+		}
+
+		if serveFile(w, r, root, name) {
+			return
+		}
+		if path.Ext(name) != "" {
+			http.NotFound(w, r)
+			return
+		}
+		if !serveFile(w, r, root, "/index.html") {
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+// serveFile writes name from root with cache headers and reports whether it
+// was found. Directories count as not found.
+func serveFile(w http.ResponseWriter, r *http.Request, root http.FileSystem, name string) bool {
+	f, err := root.Open(name)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return true
+		}
+		return false
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		return false
+	}
+
+	w.Header().Set("Cache-Control", cacheControl(name))
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+	return true
+}
+
+// cacheControl lets browsers keep fingerprinted assets forever and makes
+// them revalidate everything else, index.html in particular, so a deploy
+// is picked up on the next load.
+func cacheControl(name string) string {
+	if m := fingerprinted.FindStringSubmatch(path.Base(name)); m != nil && strings.ContainsAny(m[1], "0123456789") {
+		return "public, max-age=31536000, immutable"
+	}
+	return "no-cache"
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"time"
+
+	"todo/internal/respcache"
+)
+
+// maxStaleResponse is the largest response body kept for serving stale.
+const maxStaleResponse = 1 << 20
+
+// staleHeaders are the response headers a stale copy is served with.
+var staleHeaders = []string{"Content-Type", "Content-Language", "Content-Disposition", "Vary", "ETag", "Last-Modified", "Cache-Control"}
+
+// serveStale keeps the latest successful response to each GET while the
+// database is up, and answers GETs from those copies, with a Warning,
+// while it is down. Requests it has no copy for, and writes, go on to
+// requireDB and its 503.
+func (a *app) serveStale(next http.Handler) http.Handler {
+	if a.stale == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// The same URL renders differently for these.
+		key := r.URL.RequestURI() + "\x00" + r.Header.Get("Accept") + "\x00" + r.Header.Get("Accept-Language") + "\x00" + r.Header.Get("HX-Request")
+		if !a.health.Ready() {
+			e, ok := a.stale.Get(key)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			h := w.Header()
+			for k, v := range e.Header {
+				h[k] = v
+			}
+			h.Set("Warning", `110 - "Response is Stale"`)
+			h.Set("Age", strconv.Itoa(int(time.Since(e.Stored)/time.Second)))
+			w.WriteHeader(e.Status)
+			w.Write(e.Body)
+			return
+		}
+
+		rec := &staleRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		if rec.status == http.StatusOK && !rec.tooLarge {
+			header := http.Header{}
+			for _, k := range staleHeaders {
+				if v := w.Header().Values(k); len(v) > 0 {
+					header[k] = v
+				}
+			}
+			a.stale.Put(key, respcache.Entry{Status: rec.status, Header: header, Body: rec.body.Bytes(), Stored: time.Now()})
+		}
+	})
+}
+
+// staleRecorder copies what it writes through, up to maxStaleResponse.
+type staleRecorder struct {
+	http.ResponseWriter
+	status   int
+	body     bytes.Buffer
+	tooLarge bool
+}
+
+func (rec *staleRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *staleRecorder) Write(p []byte) (int, error) {
+	if !rec.tooLarge {
+		if rec.body.Len()+len(p) > maxStaleResponse {
+			rec.tooLarge = true
+			rec.body = bytes.Buffer{}
+		} else {
+			rec.body.Write(p)
+		}
+	}
+	return rec.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController flush streamed lists through.
+func (rec *staleRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
@@ -1,19 +1,12 @@
 <!doctype html>
-<html lang="en">
+<html lang="{{ .Lang }}">
   <head>
-    <title>Todo</title>
-    <div v-if="errorMessage" class="alert alert-danger" role="alert">
-      @{ errorMessage }
-    </div>
-
-<div v-if="isLoading" class="alert alert-info" role="alert">
-      Loading...
-    </div>
+    <title>{{ .T "ui.page_title" }}</title>
     <!-- Required meta tags -->
     <meta charset="utf-8">
     <meta name="viewport" content="width=device-width, initial-scale=1, shrink-to-fit=no">
-    <script type="text/javascript" src="https://unpkg.com/vue@2.3.4"></script>
-    <script src="https://cdn.jsdelivr.net/npm/vue-resource@1.3.4"></script>
+    <meta name="csrf-token" content="{{ .CSRFToken }}">
+    <script src="https://unpkg.com/htmx.org@2.0.3"></script>
     <!-- Bootstrap CSS -->
     <link rel="stylesheet" href="https://maxcdn.bootstrapcdn.com/bootstrap/4.0.0-beta.2/css/bootstrap.min.css" integrity="sha384-PsH8R72JQ3SOdhVi3uxftmaW6Vc51MKb0q5P2rRUpPvrszuE4W1povHYgTpBfshb" crossorigin="anonymous">
     <link rel="stylesheet" href="https://maxcdn.bootstrapcdn.com/font-awesome/4.7.0/css/font-awesome.min.css">
@@ -23,14 +16,11 @@
   border-radius: 0;
 }
 
-.loading {
-  opacity: 0.7;
+.htmx-request {
+  opacity: 0.6;
   pointer-events: none;
 }
 
-input:disabled, button:disabled {
-        cursor: not-allowed;
-      }
       .del {
           text-decoration: line-through;
       }
@@ -68,233 +58,101 @@ input:disabled, button:disabled {
         box-shadow: none !important;
       }
       .list-group li{
-        cursor: pointer;
         border-radius: 0 !important;
       }
+      .todo-form{
+        display: flex;
+        align-items: center;
+      }
+      .todo-form input[type=checkbox]{
+        cursor: pointer;
+        margin-right: 10px;
+      }
+      .todo-item-title{
+        flex: 1;
+        background: transparent;
+        border: none;
+        color: inherit;
+        font-weight: inherit;
+      }
       .checked{
         background: #5e6669;
         color: #95a5a6;
       }
-      .error{
-        border: 2px solid #e74c3c !important;
-      }
       .not-checked{
         background: #2227c7;
         color: #FFF;
         font-weight: bold;
       }
-      .loading {
-        opacity: 0.6;
-        pointer-events: none;
-      }
     </style>
   </head>
-  <body>
-    <div class="container" id="root">
+  <body hx-headers='{"X-CSRF-Token": "{{ .CSRFToken }}"}'>
+    <div id="error" class="alert alert-danger" role="alert" {{ if not .Error }}hidden{{ end }}>{{ .Error }}</div>
+    <div class="container">
         <div class="row">
             <div class="col-6 offset-3">
                 <br><br>
                 <div class="card">
                   <div class="todo-title">
-                    Daily Todo Lists
+                    {{ .T "ui.heading" }}
                   </div>
                   <div class="card-body">
-                      <form v-on:submit.prevent>
+                      <form hx-post="/todo"
+                            hx-target="#todo-list"
+                            hx-swap="beforeend"
+                            hx-on::after-request="if (event.detail.successful) this.reset()">
                         <div class="input-group">
-                          <input type="text" 
-                                 v-model="todo.title" 
-                                 :disabled="isLoading"
-                                 v-on:keyup="checkForEnter($event)" 
-                                 class="form-control custom-input" 
-                                 :class="{ 'error': showError, 'loading': isLoading }" 
-                                 placeholder="Add your todo">
+                          <input type="text"
+                                 name="title"
+                                 required
+                                 class="form-control custom-input"
+                                 placeholder="{{ .T "ui.add_placeholder" }}">
                           <span class="input-group-btn">
-                            <button class="btn custom-button" 
-                                    :disabled="isLoading"
-                                    :class="{'btn-success' : !enableEdit, 'btn-warning' : enableEdit}" 
-                                    type="button"  
-                                    v-on:click="addTodo">
-                              <span v-if="isLoading" class="fa fa-spinner fa-spin"></span>
-                              <span v-else :class="{'fa fa-plus' : !enableEdit, 'fa fa-edit' : enableEdit}"></span>
+                            <button class="btn btn-success custom-button" type="submit" aria-label="{{ .T "ui.add" }}">
+                              <span class="fa fa-plus"></span>
                             </button>
                           </span>
                         </div>
                       </form>
-                      <ul class="list-group">
-                        <li class="list-group-item" 
-                            :class="{ 'checked': todo.completed, 'not-checked': !todo.completed, 'loading': isLoading }" 
-                            v-for="(todo, todoIndex) in todos" 
-                            v-on:click="toggleTodo(todo, todoIndex)">
-                            <i :class="{'fa fa-circle': !todo.completed, 'fa fa-check-circle text-success': todo.completed }">&nbsp;</i>
-                            <span :class="{ 'del': todo.completed }">@{ todo.title }</span>
-                            <div class="btn-group float-right" role="group" aria-label="Basic example">
-                              <button type="button" 
-                                      :disabled="isLoading"
-                                      class="btn btn-success btn-sm custom-button" 
-                                      v-on:click.prevent.stop 
-                                      v-on:click="editTodo(todo, todoIndex)">
-                                <span class="fa fa-edit"></span>
-                              </button>
-                              <button type="button" 
-                                      :disabled="isLoading"
-                                      class="btn btn-danger btn-sm custom-button" 
-                                      v-on:click.prevent.stop 
-                                      v-on:click="deleteTodo(todo, todoIndex)">
-                                <span class="fa fa-trash"></span>
-                              </button>
-                            </div>
-                        </li>
+                      <ul class="list-group" id="todo-list">
+                        {{ range .Items }}{{ template "todo-item" . }}{{ end }}
                       </ul>
+                      {{ if .More }}
+                      <a class="btn btn-link btn-block" href="{{ .More }}">{{ .T "ui.more" }}</a>
+                      {{ end }}
                   </div>
                 </div>
             </div>
         </div>
     </div>
-    <!-- Optional JavaScript -->
-    <!-- jQuery first, then Popper.js, then Bootstrap JS -->
-    <script src="https://code.jquery.com/jquery-3.2.1.slim.min.js" integrity="sha384-KJ3o2DKtIkvYIK3UENzmM7KCkRr/rE9/Qpg6aAZGJwFDMVNA/GpGFF93hXpG5KkN" crossorigin="anonymous"></script>
-    <script src="https://cdnjs.cloudflare.com/ajax/libs/popper.js/1.12.3/umd/popper.min.js" integrity="sha384-vFJXuSJphROIrBnz7yo7oB41mKfc8JzQZiCq4NCceLEaO4IHwicKwpJf9c9IpFgh" crossorigin="anonymous"></script>
-    <script src="https://maxcdn.bootstrapcdn.com/bootstrap/4.0.0-beta.2/js/bootstrap.min.js" integrity="sha384-alpBpkh1PFOepccYVYDB4do5UnbKysX5WZXm3XxPqe5iKTfUKjNkCk9SaVuEZflJ" crossorigin="anonymous"></script>
 
 <script type="text/javascript">
-  // Configure Vue Resource
-  Vue.http.options.timeout = 10000;
-  Vue.http.options.root = 'http://localhost:9000';
+  (function () {
+    var errorBox = document.getElementById('error');
 
-  new Vue({
-    el: '#root',
-    delimiters: ['@{', '}'],
-    data: {
-      showError: false,
-      enableEdit: false,
-      isLoading: false,
-      errorMessage: '',
-      todo: {id: '', title: '', completed: false},
-      todos: []
-    },
-    mounted() {
-      this.fetchTodos();
-    },
-    methods: {
-      fetchTodos() {
-        this.isLoading = true;
-        this.errorMessage = '';
-        
-        this.$http.get('/todo')
-          .then(response => {
-            this.todos = response.body.data || [];
-          })
-          .catch(error => {
-            console.error('Failed to fetch todos:', error);
-            this.errorMessage = 'Failed to load todos. Please try again.';
-          })
-          .finally(() => {
-            this.isLoading = false;
-          });
-      },
-
-      checkForEnter(event) {
-        if (event.key === "Enter") {
-          this.addTodo();
-        }
-      },
-
-      addTodo() {
-        if (this.isLoading) return;
-        
-        if (!this.todo.title) {
-          this.showError = true;
-          return;
-        }
-
-        this.showError = false;
-        this.isLoading = true;
-        this.errorMessage = '';
-
-        const request = this.enableEdit
-          ? this.$http.put('/todo/' + this.todo.id, this.todo)
-          : this.$http.post('/todo', { title: this.todo.title });
-
-        request
-          .then(response => {
-            if (this.enableEdit) {
-              this.todos[this.todo.todoIndex] = { ...this.todo };
-              this.enableEdit = false;
-            } else {
-              this.todos.push({
-                id: response.body.todo_id,
-                title: this.todo.title,
-                completed: false,
-                createdAt: new Date()
-              });
-            }
-            this.todo = { id: '', title: '', completed: false };
-          })
-          .catch(error => {
-            console.error('Failed to save todo:', error);
-            this.errorMessage = 'Failed to save todo. Please try again.';
-          })
-          .finally(() => {
-            this.isLoading = false;
-          });
-      },
-
-      toggleTodo(todo, todoIndex) {
-        if (this.isLoading) return;
-        
-        this.isLoading = true;
-        this.errorMessage = '';
-        
-        const updatedTodo = {
-          ...todo,
-          completed: !todo.completed
-        };
-
-        this.$http.put('/todo/' + todo.id, updatedTodo)
-          .then(() => {
-            this.todos[todoIndex].completed = !todo.completed;
-          })
-          .catch(error => {
-            console.error('Failed to update todo:', error);
-            this.errorMessage = 'Failed to update todo. Please try again.';
-          })
-          .finally(() => {
-            this.isLoading = false;
-          });
-      },
+    function showError(message) {
+      errorBox.textContent = message;
+      errorBox.hidden = false;
+    }
 
-      editTodo(todo, todoIndex) {
-        this.enableEdit = true;
-        this.todo = { ...todo };
-        this.todo.todoIndex = todoIndex;
-      },
+    document.body.addEventListener('htmx:responseError', function (event) {
+      var message = {{ .T "ui.request_failed" }};
+      try {
+        message = JSON.parse(event.detail.xhr.responseText).message || message;
+      } catch (e) {}
+      showError(message);
+    });
 
-      deleteTodo(todo, todoIndex) {
-        if (this.isLoading) return;
-        
-        if (!confirm("Are you sure?")) return;
-        
-        this.isLoading = true;
-        this.errorMessage = '';
+    document.body.addEventListener('htmx:sendError', function () {
+      showError({{ .T "ui.network_error" }});
+    });
 
-        this.$http.delete('/todo/' + todo.id)
-          .then(() => {
-            this.todos.splice(todoIndex, 1);
-            if (this.enableEdit && this.todo.id === todo.id) {
-              this.todo = { id: '', title: '', completed: false };
-              this.enableEdit = false;
-            }
-          })
-          .catch(error => {
-            console.error('Failed to delete todo:', error);
-            this.errorMessage = 'Failed to delete todo. Please try again.';
-          })
-          .finally(() => {
-            this.isLoading = false;
-          });
+    document.body.addEventListener('htmx:afterRequest', function (event) {
+      if (event.detail.successful) {
+        errorBox.hidden = true;
       }
-    }
     });
+  })();
   </script>
   </body>
-</html>
\ No newline at end of file
+</html>
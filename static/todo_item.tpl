@@ -0,0 +1,22 @@
+{{ define "todo-item" }}
+<li class="list-group-item {{ if .Completed }}checked{{ else }}not-checked{{ end }}" id="todo-{{ .ID }}">
+  <form class="todo-form"
+        hx-put="/todo/{{ .ID }}"
+        hx-trigger="change, submit"
+        hx-target="closest li"
+        hx-swap="outerHTML">
+    <input type="checkbox" name="completed" value="true" aria-label="{{ .T "ui.toggle" }}" {{ if .Completed }}checked{{ end }}>
+    <input type="text" name="title" value="{{ .Title }}" required aria-label="{{ .T "ui.title_label" }}"
+           class="todo-item-title {{ if .Completed }}del{{ end }}">
+    <button type="button"
+            class="btn btn-danger btn-sm custom-button"
+            aria-label="{{ .T "ui.delete" }}"
+            hx-delete="/todo/{{ .ID }}"
+            hx-target="closest li"
+            hx-swap="outerHTML"
+            hx-confirm="{{ .T "ui.confirm_delete" }}">
+      <span class="fa fa-trash"></span>
+    </button>
+  </form>
+</li>
+{{ end }}
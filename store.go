@@ -0,0 +1,1644 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+
+	"todo/internal/breaker"
+	"todo/internal/events"
+	"todo/internal/fieldcrypt"
+)
+
+var (
+	errTodoNotFound        = notFoundError("todo.not_found", "todo not found")
+	errTodoModified        = preconditionError("todo.modified", "todo changed since it was read")
+	errColumnNotFound      = notFoundError("board.column_not_found", "column not found")
+	errColumnNotEmpty      = conflictError("board.column_not_empty", "column still has todos")
+	errBlockerCycle        = conflictError("todo.blocker_cycle", "dependency would form a cycle")
+	errBlockerNotFound     = invalidError("todo.blocker_not_found", "blocking todo not found")
+	errRelatedNotFound     = invalidError("todo.link_not_found", "linked todo not found")
+	errTemplateNotFound    = notFoundError("template.not_found", "template not found")
+	errCustomFieldNotFound = notFoundError("custom_field.not_found", "custom field not found")
+	// errTooManyRelations has a count in its message, so relateTodo
+	// answers it itself.
+	errTooManyRelations = errors.New("todo holds too many links")
+)
+
+const (
+	connectBackoffBase time.Duration = 500 * time.Millisecond
+	connectBackoffMax  time.Duration = 30 * time.Second
+	retryBackoffBase   time.Duration = 100 * time.Millisecond
+	retryBackoffMax    time.Duration = 2 * time.Second
+)
+
+type (
+	// listQuery narrows and pages a List call. The zero value lists
+	// everything.
+	listQuery struct {
+		Skip  int64
+		Limit int64
+		// Fields, when set, limits the stored fields loaded; _id always
+		// is.
+		Fields []string
+		// Sort orders the results, ahead of the _id tiebreaker.
+		Sort []sortKey
+		// DueFrom and DueTo, when either is set, keep only todos due in
+		// [DueFrom, DueTo).
+		DueFrom, DueTo time.Time
+		// StartFrom and StartTo do the same for the start date.
+		StartFrom, StartTo time.Time
+		// Open keeps only todos not yet completed, and Done only
+		// completed ones.
+		Open, Done bool
+		// OnBoard keeps only todos placed in a board column.
+		OnBoard bool
+		// Actionable keeps only open todos with no open blockers.
+		Actionable bool
+		// Scheduled keeps only todos with a due date.
+		Scheduled bool
+		// Tag keeps only todos carrying it.
+		Tag string
+		// IDs, when set, keeps only these todos.
+		IDs []primitive.ObjectID
+		// LinkedTo, when set, keeps only todos with a link to it.
+		LinkedTo primitive.ObjectID
+		// Parent, when set, keeps only its subtasks.
+		Parent primitive.ObjectID
+		// Within, when set, keeps only todos located inside it.
+		Within *geoCircle
+		// Custom keeps only todos whose custom fields hold these values.
+		Custom map[string]interface{}
+	}
+	todoRepository interface {
+		List(ctx context.Context, q listQuery) ([]todoModel, error)
+		// Each calls fn with q's todos in List's order without holding
+		// them all, stopping at the first error fn returns.
+		Each(ctx context.Context, q listQuery, fn func(todoModel) error) error
+		// Get and SetCompleted return errTodoNotFound for unknown ids.
+		Get(ctx context.Context, id primitive.ObjectID) (todoModel, error)
+		Create(ctx context.Context, t todoModel) error
+		// FindDuplicate returns an open todo whose title matches title
+		// once normalized, or errTodoNotFound.
+		FindDuplicate(ctx context.Context, title string) (todoModel, error)
+		// CreateMany creates todos together: all of them or, on a
+		// replica set, none.
+		CreateMany(ctx context.Context, todos []todoModel) error
+		// Update and Delete write only if the todo was last written at
+		// one of match, and otherwise return errTodoModified. A nil
+		// match writes unconditionally.
+		Update(ctx context.Context, t todoModel, match revisions) error
+		SetCompleted(ctx context.Context, id primitive.ObjectID, completed bool) error
+		Delete(ctx context.Context, id primitive.ObjectID, match revisions) error
+		// LastModified is when any todo was last written or deleted, or
+		// the zero time if none ever was.
+		LastModified(ctx context.Context) (time.Time, error)
+		// Count is how many todos List would return for q unpaged.
+		Count(ctx context.Context, q listQuery) (int64, error)
+		// Counts tallies todos by status and tag, and open todos by due
+		// bucket.
+		Counts(ctx context.Context, b dueBounds) (todoCounts, error)
+		// AddBlocker records that id can't be completed before blocker.
+		// It returns errTodoNotFound or errBlockerNotFound for unknown
+		// ids and errBlockerCycle when blocker already waits on id.
+		AddBlocker(ctx context.Context, id, blocker primitive.ObjectID) (todoModel, error)
+		RemoveBlocker(ctx context.Context, id, blocker primitive.ObjectID) (todoModel, error)
+		// OpenBlockers are the todos blocking id that aren't completed.
+		OpenBlockers(ctx context.Context, id primitive.ObjectID) ([]primitive.ObjectID, error)
+		// Relate links id to rel.ID. It returns errTodoNotFound or
+		// errRelatedNotFound for unknown ids, and errTooManyRelations
+		// when id already holds maxRelations. Unrelate removes the link,
+		// from either side for relates-to.
+		Relate(ctx context.Context, id primitive.ObjectID, rel todoRelation) (todoModel, error)
+		Unrelate(ctx context.Context, id primitive.ObjectID, rel todoRelation) (todoModel, error)
+		// Changes returns up to limit todos changed, and deletions made,
+		// after since and no later than until, oldest first. A zero since
+		// starts from scratch and skips deletions.
+		Changes(ctx context.Context, since changeToken, until time.Time, limit int64) ([]todoChange, error)
+		// Activity returns up to limit activity entries older than
+		// before, newest first. A zero before starts from the latest.
+		Activity(ctx context.Context, before primitive.ObjectID, limit int64) ([]activityEntry, error)
+	}
+	// boardRepository keeps the kanban columns and the order of todos
+	// within them. Positions are dense from 0 and every change renumbers
+	// its neighbours in the same transaction.
+	boardRepository interface {
+		Columns(ctx context.Context) ([]column, error)
+		// CreateColumn appends a column to the end of the board.
+		CreateColumn(ctx context.Context, name string) (column, error)
+		// UpdateColumn renames a column and moves it to position.
+		UpdateColumn(ctx context.Context, id primitive.ObjectID, name string, position int) (column, error)
+		// DeleteColumn returns errColumnNotEmpty while todos are in it.
+		DeleteColumn(ctx context.Context, id primitive.ObjectID) error
+		// Move puts a todo in a column at position, clamped to the
+		// column's length.
+		Move(ctx context.Context, id, columnID primitive.ObjectID, position int) (todoModel, error)
+	}
+	templateRepository interface {
+		List(ctx context.Context) ([]todoTemplate, error)
+		// Get and Delete return errTemplateNotFound for unknown ids.
+		Get(ctx context.Context, id primitive.ObjectID) (todoTemplate, error)
+		// Save creates or replaces the template with t's id.
+		Save(ctx context.Context, t todoTemplate) error
+		Delete(ctx context.Context, id primitive.ObjectID) error
+	}
+	settingsRepository interface {
+		// Load returns the stored settings, or the defaults when none have
+		// been saved yet.
+		Load(ctx context.Context) (settings, error)
+		Save(ctx context.Context, s settings) error
+	}
+	customFieldRepository interface {
+		List(ctx context.Context) ([]customField, error)
+		// Save creates or replaces the field with f's key, dropping the
+		// values todos hold that no longer fit it.
+		Save(ctx context.Context, f customField) error
+		// Delete removes the field and its values, or returns
+		// errCustomFieldNotFound.
+		Delete(ctx context.Context, key string) error
+	}
+	notificationRepository interface {
+		// Load returns the saved channels, or none when nothing has been
+		// saved yet.
+		Load(ctx context.Context) (notificationSettings, error)
+		Save(ctx context.Context, n notificationSettings) error
+	}
+	healthChecker interface {
+		Ready() bool
+		Ping(ctx context.Context) error
+	}
+)
+
+// mongoConn is the shared MongoDB connection. It is Ready once the first
+// ping succeeds.
+type mongoConn struct {
+	client *mongo.Client
+	ready  atomic.Bool
+
+	// Calls made through retry are tried up to attempts times and feed
+	// breaker, which Ready consults.
+	attempts int
+	breaker  breaker.Breaker
+
+	// txSupport caches whether the deployment accepts multi-document
+	// transactions: 0 unknown, 1 yes, 2 no.
+	txSupport atomic.Int32
+}
+
+// mongoClientOptions layers the pool, read preference and write concern
+// settings from cfg over the connection URI.
+func mongoClientOptions(cfg config) (*options.ClientOptions, error) {
+	opts := options.Client().ApplyURI(cfg.MongoURI)
+	if cfg.MongoMaxPoolSize > 0 {
+		opts.SetMaxPoolSize(cfg.MongoMaxPoolSize)
+	}
+	if cfg.MongoMinPoolSize > 0 {
+		opts.SetMinPoolSize(cfg.MongoMinPoolSize)
+	}
+	if cfg.MongoMaxConnecting > 0 {
+		opts.SetMaxConnecting(cfg.MongoMaxConnecting)
+	}
+	if cfg.MongoServerSelection > 0 {
+		opts.SetServerSelectionTimeout(cfg.MongoServerSelection)
+	}
+
+	if cfg.MongoReadPreference != "" {
+		mode, err := readpref.ModeFromString(cfg.MongoReadPreference)
+		if err != nil {
+			return nil, fmt.Errorf("MONGO_READ_PREFERENCE: %w", err)
+		}
+		rp, err := readpref.New(mode)
+		if err != nil {
+			return nil, fmt.Errorf("MONGO_READ_PREFERENCE: %w", err)
+		}
+		opts.SetReadPreference(rp)
+	}
+
+	switch w := cfg.MongoWriteConcern; w {
+	case "":
+	case "majority":
+		opts.SetWriteConcern(writeconcern.Majority())
+	default:
+		n, err := strconv.Atoi(w)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf(`MONGO_WRITE_CONCERN must be "majority" or a node count, got %q`, w)
+		}
+		opts.SetWriteConcern(&writeconcern.WriteConcern{W: n})
+	}
+
+	// Validate also catches a minimum pool size above the maximum.
+	return opts, opts.Validate()
+}
+
+// connectMongo creates the client and pings the server in the background,
+// retrying with exponential backoff and jitter for up to cfg.ConnectRetry
+// before giving up. The driver reconnects on its own after that first
+// success.
+func connectMongo(cfg config) (*mongoConn, error) {
+	opts, err := mongoClientOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	opts.SetMonitor(newMongoMonitor(cfg.MongoSlowQuery))
+	client, err := mongo.Connect(context.Background(), opts)
+	if err != nil {
+		return nil, err
+	}
+	c := &mongoConn{
+		client:   client,
+		attempts: int(cfg.MongoRetryAttempts),
+		breaker:  breaker.Breaker{Threshold: int(cfg.MongoBreakerThreshold), Cooldown: cfg.MongoBreakerCooldown},
+	}
+
+	period := cfg.ConnectRetry
+	go func() {
+		deadline := time.Now().Add(period)
+		for attempt := 0; ; attempt++ {
+			ctx, cancel := context.WithTimeout(context.Background(), min(5*time.Second, max(time.Until(deadline), time.Second)))
+			err := client.Ping(ctx, nil)
+			cancel()
+			if err == nil {
+				c.ready.Store(true)
+				log.Println("Connected to MongoDB successfully")
+				return
+			}
+
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				log.Fatalf("Failed to connect to MongoDB within %s: %v", period, err)
+			}
+			wait := min(backoff(attempt), remaining)
+			log.Printf("MongoDB not reachable (attempt %d), retrying in %s: %v", attempt+1, wait.Round(time.Millisecond), err)
+			time.Sleep(wait)
+		}
+	}()
+	return c, nil
+}
+
+// Ready reports whether the first connection succeeded and the breaker
+// isn't open.
+func (c *mongoConn) Ready() bool {
+	return c.ready.Load() && !c.breaker.Open()
+}
+
+// transientCodes are server errors from a node that is stepping down,
+// shutting down or unreachable, which a retry can get past.
+var transientCodes = []int32{6, 7, 89, 91, 189, 10107, 11600, 11602, 13435, 13436}
+
+// transient reports whether err is a failure to reach a usable server,
+// rather than a problem with the operation itself.
+func transient(err error) bool {
+	if mongo.IsNetworkError(err) {
+		return true
+	}
+	var sel topology.ServerSelectionError
+	if errors.As(err, &sel) {
+		return true
+	}
+	var labeled mongo.LabeledError
+	if errors.As(err, &labeled) && (labeled.HasErrorLabel("RetryableWriteError") || labeled.HasErrorLabel("TransientTransactionError")) {
+		return true
+	}
+	var cmd mongo.CommandError
+	return errors.As(err, &cmd) && slices.Contains(transientCodes, cmd.Code)
+}
+
+// retry runs fn, and again after a backoff while it fails transiently, up
+// to c.attempts times and while ctx leaves time for it. Transient failures
+// count towards the breaker and anything else resets it; while it is open
+// fn isn't run at all and retry returns errDBUnavailable.
+func (c *mongoConn) retry(ctx context.Context, fn func(ctx context.Context) error) error {
+	for attempt := 0; ; attempt++ {
+		if !c.breaker.Allow() {
+			return errDBUnavailable
+		}
+		err := fn(ctx)
+		if !transient(err) {
+			c.breaker.Success()
+			return err
+		}
+		c.breaker.Failure()
+		if attempt+1 >= c.attempts {
+			return err
+		}
+		wait := expBackoff(retryBackoffBase, retryBackoffMax, attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (c *mongoConn) Ping(ctx context.Context) error {
+	return c.client.Ping(ctx, nil)
+}
+
+func (c *mongoConn) Disconnect(ctx context.Context) error {
+	return c.client.Disconnect(ctx)
+}
+
+// supportsTransactions reports whether the server is a replica set member
+// or a mongos. Standalone servers reject multi-document transactions.
+func (c *mongoConn) supportsTransactions(ctx context.Context) (bool, error) {
+	switch c.txSupport.Load() {
+	case 1:
+		return true, nil
+	case 2:
+		return false, nil
+	}
+
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := c.client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return false, err
+	}
+	ok := hello.SetName != "" || hello.Msg == "isdbgrid"
+	if ok {
+		c.txSupport.Store(1)
+	} else {
+		c.txSupport.Store(2)
+	}
+	return ok, nil
+}
+
+// withTransaction runs fn in a multi-document transaction when the
+// deployment supports them and directly otherwise, so compound writes are
+// atomic on replica sets and still work against a standalone dev server.
+// fn may be retried on transient errors and must be safe to run again.
+func (c *mongoConn) withTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	ok, err := c.supportsTransactions(ctx)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fn(ctx)
+	}
+
+	// An aborted transaction left nothing behind, so all of it can be
+	// tried again.
+	return c.retry(ctx, func(ctx context.Context) error {
+		sess, err := c.client.StartSession()
+		if err != nil {
+			return err
+		}
+		defer sess.EndSession(ctx)
+		_, err = sess.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+			return nil, fn(sc)
+		})
+		return err
+	})
+}
+
+// backoff doubles from connectBackoffBase up to connectBackoffMax and picks
+// a random point in the upper half so replicas don't retry in lockstep.
+func backoff(attempt int) time.Duration {
+	return expBackoff(connectBackoffBase, connectBackoffMax, attempt)
+}
+
+func expBackoff(base, limit time.Duration, attempt int) time.Duration {
+	d := limit
+	if attempt < 32 && base<<attempt > 0 {
+		d = min(base<<attempt, limit)
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// mongoTodoRepository stores todos in a collection, encrypting private
+// fields on the way in and decrypting them on the way out. Every write
+// adds to the activity feed and, when outbox is set, records an event, in
+// the same transaction.
+type mongoTodoRepository struct {
+	coll   *mongo.Collection
+	conn   *mongoConn
+	cipher *fieldcrypt.Cipher
+	outbox *mongoOutbox
+	// tombstones remember deleted todos for the change feed.
+	tombstones *mongo.Collection
+	activity   *mongo.Collection
+}
+
+func newMongoTodoRepository(coll *mongo.Collection, conn *mongoConn, cipher *fieldcrypt.Cipher, outbox *mongoOutbox) *mongoTodoRepository {
+	return &mongoTodoRepository{
+		coll:       coll,
+		conn:       conn,
+		cipher:     cipher,
+		outbox:     outbox,
+		tombstones: coll.Database().Collection(tombstonesCollection),
+		activity:   coll.Database().Collection(activityCollection),
+	}
+}
+
+func titleAAD(id primitive.ObjectID) []byte {
+	return []byte(id.Hex() + "/title")
+}
+
+func notesAAD(id primitive.ObjectID) []byte {
+	return []byte(id.Hex() + "/notes")
+}
+
+// seal encrypts t's private fields in place before it is stored, and
+// indexes the title for duplicate checks. Notes are copied first, as
+// callers keep the plain todo too.
+func (s *mongoTodoRepository) seal(t *todoModel) (err error) {
+	t.TitleKey = s.cipher.BlindIndex(titleKey(t.Title))
+	if t.Title, err = s.cipher.Encrypt(t.Title, titleAAD(t.ID)); err != nil {
+		return err
+	}
+	t.Notes = slices.Clone(t.Notes)
+	for i := range t.Notes {
+		if t.Notes[i].Text, err = s.cipher.Encrypt(t.Notes[i].Text, notesAAD(t.ID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// open reverses seal after a todo is read back.
+func (s *mongoTodoRepository) open(t *todoModel) (err error) {
+	if t.Title, err = s.cipher.Decrypt(t.Title, titleAAD(t.ID)); err != nil {
+		return err
+	}
+	for i := range t.Notes {
+		if t.Notes[i].Text, err = s.cipher.Decrypt(t.Notes[i].Text, notesAAD(t.ID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *mongoTodoRepository) List(ctx context.Context, q listQuery) ([]todoModel, error) {
+	filter, err := s.filter(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	todos := []todoModel{}
+	err = s.conn.retry(ctx, func(ctx context.Context) error {
+		cursor, err := s.coll.Find(ctx, filter, findOptions(q))
+		if err != nil {
+			return err
+		}
+		return cursor.All(ctx, &todos)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range todos {
+		if err := s.open(&todos[i]); err != nil {
+			return nil, err
+		}
+	}
+	return todos, nil
+}
+
+// Each decodes one todo at a time off the cursor, so memory stays flat
+// however many match. Only opening the cursor is retried: once fn has
+// seen a todo, starting over would repeat it.
+func (s *mongoTodoRepository) Each(ctx context.Context, q listQuery, fn func(todoModel) error) error {
+	filter, err := s.filter(ctx, q)
+	if err != nil {
+		return err
+	}
+	var cursor *mongo.Cursor
+	err = s.conn.retry(ctx, func(ctx context.Context) error {
+		cursor, err = s.coll.Find(ctx, filter, findOptions(q))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(context.Background())
+	for cursor.Next(ctx) {
+		var t todoModel
+		if err := cursor.Decode(&t); err != nil {
+			return err
+		}
+		if err := s.open(&t); err != nil {
+			return err
+		}
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// findOptions sorts, pages and projects a find for q.
+func findOptions(q listQuery) *options.FindOptions {
+	// End on _id so pages don't shift between requests.
+	sort := bson.D{}
+	for _, k := range q.Sort {
+		dir := 1
+		if k.Desc {
+			dir = -1
+		}
+		sort = append(sort, bson.E{Key: k.Field, Value: dir})
+		if k.Field == "_id" {
+			break
+		}
+	}
+	if len(sort) == 0 || sort[len(sort)-1].Key != "_id" {
+		sort = append(sort, bson.E{Key: "_id", Value: 1})
+	}
+	opts := options.Find().SetSort(sort)
+	if q.Skip > 0 {
+		opts.SetSkip(q.Skip)
+	}
+	if q.Limit > 0 {
+		opts.SetLimit(q.Limit)
+	}
+	if q.Fields != nil {
+		projection := bson.D{}
+		for _, f := range q.Fields {
+			projection = append(projection, bson.E{Key: f, Value: 1})
+		}
+		opts.SetProjection(projection)
+	}
+	return opts
+}
+
+// filter is the query document selecting q's todos.
+func (s *mongoTodoRepository) filter(ctx context.Context, q listQuery) (bson.M, error) {
+	filter := bson.M{}
+	if q.Scheduled {
+		filter["due_date"] = bson.M{"$type": "date"}
+	}
+	if !q.DueFrom.IsZero() || !q.DueTo.IsZero() {
+		due := bson.M{"$type": "date"}
+		if !q.DueFrom.IsZero() {
+			due["$gte"] = q.DueFrom
+		}
+		if !q.DueTo.IsZero() {
+			due["$lt"] = q.DueTo
+		}
+		filter["due_date"] = due
+	}
+	if !q.StartFrom.IsZero() || !q.StartTo.IsZero() {
+		start := bson.M{"$type": "date"}
+		if !q.StartFrom.IsZero() {
+			start["$gte"] = q.StartFrom
+		}
+		if !q.StartTo.IsZero() {
+			start["$lt"] = q.StartTo
+		}
+		filter["start_date"] = start
+	}
+	if q.Open {
+		filter["completed"] = false
+	}
+	if q.Done {
+		filter["completed"] = true
+	}
+	if !q.Parent.IsZero() {
+		filter["parent_id"] = q.Parent
+	}
+	if q.IDs != nil {
+		filter["_id"] = bson.M{"$in": q.IDs}
+	}
+	if !q.LinkedTo.IsZero() {
+		filter["related.id"] = q.LinkedTo
+	}
+	if q.Within != nil {
+		filter["location"] = bson.M{"$geoWithin": bson.M{
+			"$centerSphere": bson.A{q.Within.Center.Coordinates, q.Within.Radius / earthRadius},
+		}}
+	}
+	for key, v := range q.Custom {
+		filter["custom."+key] = v
+	}
+	if q.Tag != "" {
+		filter["tags"] = q.Tag
+	}
+	if q.OnBoard {
+		filter["column_id"] = bson.M{"$type": "objectId"}
+	}
+	if q.Actionable {
+		blocking, err := s.openBlockersOf(ctx, bson.M{"completed": false})
+		if err != nil {
+			return nil, err
+		}
+		filter["completed"] = false
+		filter["blocked_by"] = bson.M{"$nin": blocking}
+	}
+	return filter, nil
+}
+
+// writeTx runs fn in a transaction and, when there is an outbox, enqueues
+// the event it returns within it. fn returns a nil event when it changed
+// nothing, or when there is no outbox to tell.
+func (s *mongoTodoRepository) writeTx(ctx context.Context, fn func(ctx context.Context) (*events.Event, error)) error {
+	err := s.conn.withTransaction(ctx, func(ctx context.Context) error {
+		e, err := fn(ctx)
+		if err != nil || e == nil || s.outbox == nil {
+			return err
+		}
+		return s.outbox.enqueue(ctx, *e)
+	})
+	if err == nil && s.outbox != nil {
+		s.outbox.notify()
+	}
+	return err
+}
+
+func (s *mongoTodoRepository) Create(ctx context.Context, t todoModel) error {
+	t.UpdatedAt = time.Now()
+	if t.Completed && t.CompletedAt == nil {
+		t.CompletedAt = &t.UpdatedAt
+	}
+	plain := t
+	if err := s.seal(&t); err != nil {
+		return err
+	}
+	return s.writeTx(ctx, func(ctx context.Context) (*events.Event, error) {
+		if _, err := s.coll.InsertOne(ctx, t); err != nil {
+			return nil, err
+		}
+		if err := s.logActivity(ctx, activityCreated, t.ID, t.Title); err != nil {
+			return nil, err
+		}
+		return &events.Event{Type: events.TodoCreated, Subject: t.ID.Hex(), Data: plain.toTodo()}, nil
+	})
+}
+
+func (s *mongoTodoRepository) CreateMany(ctx context.Context, todos []todoModel) error {
+	docs := make([]interface{}, len(todos))
+	logged := make([]interface{}, len(todos))
+	now := time.Now()
+	for i := range todos {
+		todos[i].UpdatedAt = now
+		if todos[i].Completed && todos[i].CompletedAt == nil {
+			todos[i].CompletedAt = &now
+		}
+	}
+	for i, t := range todos {
+		if err := s.seal(&t); err != nil {
+			return err
+		}
+		docs[i] = t
+		logged[i] = newActivityEntry(activityCreated, t.ID, t.Title)
+	}
+	err := s.conn.withTransaction(ctx, func(ctx context.Context) error {
+		if _, err := s.coll.InsertMany(ctx, docs); err != nil {
+			return err
+		}
+		if _, err := s.activity.InsertMany(ctx, logged); err != nil {
+			return err
+		}
+		if s.outbox == nil {
+			return nil
+		}
+		for _, t := range todos {
+			e := events.Event{Type: events.TodoCreated, Subject: t.ID.Hex(), Data: t.toTodo()}
+			if err := s.outbox.enqueue(ctx, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil && s.outbox != nil {
+		s.outbox.notify()
+	}
+	return err
+}
+
+func (s *mongoTodoRepository) Get(ctx context.Context, id primitive.ObjectID) (todoModel, error) {
+	var t todoModel
+	err := s.conn.retry(ctx, func(ctx context.Context) error {
+		return s.coll.FindOne(ctx, bson.M{"_id": id}).Decode(&t)
+	})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return t, errTodoNotFound
+	}
+	if err != nil {
+		return t, err
+	}
+	return t, s.open(&t)
+}
+
+// LastModified reads the newest updated_at and deleted_at, each off its
+// index.
+func (s *mongoTodoRepository) LastModified(ctx context.Context) (time.Time, error) {
+	var latest time.Time
+	for _, src := range []struct {
+		coll  *mongo.Collection
+		field string
+	}{{s.coll, "updated_at"}, {s.tombstones, "deleted_at"}} {
+		var doc bson.Raw
+		err := s.conn.retry(ctx, func(ctx context.Context) error {
+			opts := options.FindOne().
+				SetSort(bson.D{{Key: src.field, Value: -1}}).
+				SetProjection(bson.M{src.field: 1})
+			return src.coll.FindOne(ctx, bson.M{}, opts).Decode(&doc)
+		})
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			continue
+		}
+		if err != nil {
+			return time.Time{}, err
+		}
+		if at, ok := doc.Lookup(src.field).TimeOK(); ok && at.After(latest) {
+			latest = at
+		}
+	}
+	return latest, nil
+}
+
+func (s *mongoTodoRepository) FindDuplicate(ctx context.Context, title string) (todoModel, error) {
+	var t todoModel
+	key := s.cipher.BlindIndex(titleKey(title))
+	err := s.conn.retry(ctx, func(ctx context.Context) error {
+		return s.coll.FindOne(ctx, bson.M{"title_key": key, "completed": false}).Decode(&t)
+	})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return t, errTodoNotFound
+	}
+	if err != nil {
+		return t, err
+	}
+	return t, s.open(&t)
+}
+
+func (s *mongoTodoRepository) Update(ctx context.Context, t todoModel, match revisions) error {
+	if err := s.seal(&t); err != nil {
+		return err
+	}
+	_, err := s.update(ctx, t.ID, match, bson.M{"title": t.Title, "completed": t.Completed, "title_key": t.TitleKey, "start_date": t.StartDate, "due_date": t.DueDate, "tags": t.Tags, "priority": t.Priority, "custom": t.Custom, "location": t.Location, "location_label": t.LocationLabel})
+	return err
+}
+
+func (s *mongoTodoRepository) SetCompleted(ctx context.Context, id primitive.ObjectID, completed bool) error {
+	found, err := s.update(ctx, id, nil, bson.M{"completed": completed})
+	if err == nil && !found {
+		return errTodoNotFound
+	}
+	return err
+}
+
+// update $sets already sealed fields on one todo and reports whether it
+// exists. With a match it fails with errTodoModified instead.
+func (s *mongoTodoRepository) update(ctx context.Context, id primitive.ObjectID, match revisions, set bson.M) (found bool, err error) {
+	filter := bson.M{"_id": id}
+	set["updated_at"] = time.Now()
+	err = s.writeTx(ctx, func(ctx context.Context) (*events.Event, error) {
+		// The activity feed tells completing a todo from editing it, so
+		// read back what it was.
+		var before todoModel
+		err := s.coll.FindOneAndUpdate(ctx, match.filter(id), bson.M{"$set": set}).Decode(&before)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			found = false
+			if match != nil {
+				return nil, errTodoModified
+			}
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		found = true
+		if c, ok := set["completed"].(bool); ok && c != before.Completed {
+			done := bson.M{"$unset": bson.M{"completed_at": ""}}
+			if c {
+				done = bson.M{"$set": bson.M{"completed_at": set["updated_at"]}}
+			}
+			if _, err := s.coll.UpdateOne(ctx, filter, done); err != nil {
+				return nil, err
+			}
+		}
+		title := before.Title
+		if t, ok := set["title"].(string); ok {
+			title = t
+		}
+		if err := s.logActivity(ctx, updateActivity(before, set), id, title); err != nil {
+			return nil, err
+		}
+		if s.outbox == nil {
+			return nil, nil
+		}
+
+		// The event carries the whole todo.
+		var after todoModel
+		if err := s.coll.FindOne(ctx, filter).Decode(&after); err != nil {
+			return nil, err
+		}
+		if err := s.open(&after); err != nil {
+			return nil, err
+		}
+		return &events.Event{Type: events.TodoUpdated, Subject: id.Hex(), Data: after.toTodo()}, nil
+	})
+	return found, err
+}
+
+func (s *mongoTodoRepository) Delete(ctx context.Context, id primitive.ObjectID, match revisions) error {
+	return s.writeTx(ctx, func(ctx context.Context) (*events.Event, error) {
+		var gone todoModel
+		err := s.coll.FindOneAndDelete(ctx, match.filter(id)).Decode(&gone)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			if match != nil {
+				return nil, errTodoModified
+			}
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := s.logActivity(ctx, activityDeleted, id, gone.Title); err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		if _, err := s.tombstones.ReplaceOne(ctx, bson.M{"_id": id}, tombstone{ID: id, DeletedAt: now}, options.Replace().SetUpsert(true)); err != nil {
+			return nil, err
+		}
+		// Nothing waits on a todo that is gone. A leftover reference
+		// would be harmless, since only open blockers count.
+		if _, err := s.coll.UpdateMany(ctx, bson.M{"blocked_by": id}, bson.M{
+			"$pull": bson.M{"blocked_by": id},
+			"$set":  bson.M{"updated_at": now},
+		}); err != nil {
+			return nil, err
+		}
+		if _, err := s.coll.UpdateMany(ctx, bson.M{"related.id": id}, bson.M{
+			"$pull": bson.M{"related": bson.M{"id": id}},
+			"$set":  bson.M{"updated_at": now},
+		}); err != nil {
+			return nil, err
+		}
+		// Subtasks outlive their parent as top-level todos rather than
+		// pointing at one that is gone.
+		if _, err := s.coll.UpdateMany(ctx, bson.M{"parent_id": id}, bson.M{
+			"$unset": bson.M{"parent_id": ""},
+			"$set":   bson.M{"updated_at": now},
+		}); err != nil {
+			return nil, err
+		}
+		return &events.Event{Type: events.TodoDeleted, Subject: id.Hex()}, nil
+	})
+}
+
+// tombstone records that a todo was deleted, for as long as change
+// tokens stay valid.
+type tombstone struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	DeletedAt time.Time          `bson:"deleted_at"`
+}
+
+func (s *mongoTodoRepository) Changes(ctx context.Context, since changeToken, until time.Time, limit int64) ([]todoChange, error) {
+	after := func(field string) (bson.M, *options.FindOptions) {
+		filter := bson.M{field: bson.M{"$lte": until}}
+		if !since.At.IsZero() {
+			filter["$or"] = bson.A{
+				bson.M{field: bson.M{"$gt": since.At}},
+				bson.M{field: since.At, "_id": bson.M{"$gt": since.ID}},
+			}
+		}
+		return filter, options.Find().SetSort(bson.D{{Key: field, Value: 1}, {Key: "_id", Value: 1}}).SetLimit(limit)
+	}
+
+	filter, opts := after("updated_at")
+	var todos []todoModel
+	err := s.conn.retry(ctx, func(ctx context.Context) error {
+		cursor, err := s.coll.Find(ctx, filter, opts)
+		if err != nil {
+			return err
+		}
+		return cursor.All(ctx, &todos)
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]todoChange, 0, len(todos))
+	for _, t := range todos {
+		if err := s.open(&t); err != nil {
+			return nil, err
+		}
+		out = append(out, todoChange{Todo: t, At: t.UpdatedAt})
+	}
+
+	if !since.At.IsZero() {
+		filter, opts := after("deleted_at")
+		var gone []tombstone
+		err := s.conn.retry(ctx, func(ctx context.Context) error {
+			cursor, err := s.tombstones.Find(ctx, filter, opts)
+			if err != nil {
+				return err
+			}
+			return cursor.All(ctx, &gone)
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, g := range gone {
+			out = append(out, todoChange{Todo: todoModel{ID: g.ID}, At: g.DeletedAt, Deleted: true})
+		}
+	}
+
+	slices.SortFunc(out, func(x, y todoChange) int {
+		return cmp.Or(x.At.Compare(y.At), bytes.Compare(x.Todo.ID[:], y.Todo.ID[:]))
+	})
+	if int64(len(out)) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+// logActivity records action on the todo id. title is as stored, sealed
+// to the todo, which the entry keeps it sealed to.
+func (s *mongoTodoRepository) logActivity(ctx context.Context, action string, id primitive.ObjectID, title string) error {
+	_, err := s.activity.InsertOne(ctx, newActivityEntry(action, id, title))
+	return err
+}
+
+func (s *mongoTodoRepository) Activity(ctx context.Context, before primitive.ObjectID, limit int64) ([]activityEntry, error) {
+	filter := bson.M{}
+	if !before.IsZero() {
+		filter["_id"] = bson.M{"$lt": before}
+	}
+	out := []activityEntry{}
+	err := s.conn.retry(ctx, func(ctx context.Context) error {
+		cur, err := s.activity.Find(ctx, filter, options.Find().
+			SetSort(bson.D{{Key: "_id", Value: -1}}).
+			SetLimit(limit))
+		if err != nil {
+			return err
+		}
+		return cur.All(ctx, &out)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range out {
+		if out[i].Title, err = s.cipher.Decrypt(out[i].Title, titleAAD(out[i].TodoID)); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (s *mongoTodoRepository) AddBlocker(ctx context.Context, id, blocker primitive.ObjectID) (todoModel, error) {
+	if id == blocker {
+		return todoModel{}, errBlockerCycle
+	}
+	return s.editTodo(ctx, id, func(ctx context.Context) (bson.M, error) {
+		// Walk everything blocker waits on, directly or not.
+		cursor, err := s.coll.Aggregate(ctx, mongo.Pipeline{
+			{{Key: "$match", Value: bson.M{"_id": blocker}}},
+			{{Key: "$graphLookup", Value: bson.M{
+				"from":             s.coll.Name(),
+				"startWith":        "$blocked_by",
+				"connectFromField": "blocked_by",
+				"connectToField":   "_id",
+				"as":               "chain",
+			}}},
+			{{Key: "$project", Value: bson.M{"chain._id": 1}}},
+		})
+		if err != nil {
+			return nil, err
+		}
+		var res []struct {
+			Chain []struct {
+				ID primitive.ObjectID `bson:"_id"`
+			} `bson:"chain"`
+		}
+		if err := cursor.All(ctx, &res); err != nil {
+			return nil, err
+		}
+		if len(res) == 0 {
+			return nil, errBlockerNotFound
+		}
+		for _, c := range res[0].Chain {
+			if c.ID == id {
+				return nil, errBlockerCycle
+			}
+		}
+		return bson.M{"$addToSet": bson.M{"blocked_by": blocker}}, nil
+	})
+}
+
+func (s *mongoTodoRepository) RemoveBlocker(ctx context.Context, id, blocker primitive.ObjectID) (todoModel, error) {
+	return s.editTodo(ctx, id, func(context.Context) (bson.M, error) {
+		return bson.M{"$pull": bson.M{"blocked_by": blocker}}, nil
+	})
+}
+
+func (s *mongoTodoRepository) Relate(ctx context.Context, id primitive.ObjectID, rel todoRelation) (todoModel, error) {
+	return s.editTodo(ctx, id, func(ctx context.Context) (bson.M, error) {
+		n, err := s.coll.CountDocuments(ctx, bson.M{"_id": rel.ID})
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return nil, errRelatedNotFound
+		}
+		if rel.Type == relatesTo {
+			// Already related the other way round; once is enough.
+			n, err := s.coll.CountDocuments(ctx, bson.M{
+				"_id":     rel.ID,
+				"related": bson.M{"$elemMatch": bson.M{"type": relatesTo, "id": id}},
+			})
+			if err != nil {
+				return nil, err
+			}
+			if n > 0 {
+				return bson.M{}, nil
+			}
+		}
+		// Counted here rather than by the caller so two links added at
+		// once can't both squeeze under the limit.
+		n, err = s.coll.CountDocuments(ctx, bson.M{
+			"_id": id,
+			"related." + strconv.Itoa(maxRelations-1): bson.M{"$exists": true},
+			"related": bson.M{"$ne": rel},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			return nil, errTooManyRelations
+		}
+		return bson.M{"$addToSet": bson.M{"related": rel}}, nil
+	})
+}
+
+func (s *mongoTodoRepository) Unrelate(ctx context.Context, id primitive.ObjectID, rel todoRelation) (todoModel, error) {
+	return s.editTodo(ctx, id, func(ctx context.Context) (bson.M, error) {
+		if rel.Type == relatesTo {
+			if _, err := s.coll.UpdateOne(ctx, bson.M{"_id": rel.ID}, bson.M{
+				"$pull": bson.M{"related": bson.M{"type": relatesTo, "id": id}},
+				"$set":  bson.M{"updated_at": time.Now()},
+			}); err != nil {
+				return nil, err
+			}
+		}
+		return bson.M{"$pull": bson.M{"related": bson.M{"type": rel.Type, "id": rel.ID}}}, nil
+	})
+}
+
+// editTodo applies the update check returns to id in a transaction, so
+// what check saw still holds: two dependencies added at once can't close
+// a cycle between them, nor a link point at a todo just deleted. An empty
+// update changes nothing, so the todo is returned as it is, unbumped and
+// without an event.
+func (s *mongoTodoRepository) editTodo(ctx context.Context, id primitive.ObjectID, check func(ctx context.Context) (bson.M, error)) (todoModel, error) {
+	var after todoModel
+	err := s.writeTx(ctx, func(ctx context.Context) (*events.Event, error) {
+		update, err := check(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if len(update) == 0 {
+			err := s.coll.FindOne(ctx, bson.M{"_id": id}).Decode(&after)
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return nil, errTodoNotFound
+			}
+			if err != nil {
+				return nil, err
+			}
+			return nil, s.open(&after)
+		}
+		update["$set"] = bson.M{"updated_at": time.Now()}
+		err = s.coll.FindOneAndUpdate(ctx, bson.M{"_id": id}, update,
+			options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&after)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errTodoNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := s.open(&after); err != nil {
+			return nil, err
+		}
+		return &events.Event{Type: events.TodoUpdated, Subject: id.Hex(), Data: after.toTodo()}, nil
+	})
+	return after, err
+}
+
+func (s *mongoTodoRepository) OpenBlockers(ctx context.Context, id primitive.ObjectID) ([]primitive.ObjectID, error) {
+	return s.openBlockersOf(ctx, bson.M{"_id": id})
+}
+
+// openBlockersOf is the open todos blocking any todo matching filter.
+func (s *mongoTodoRepository) openBlockersOf(ctx context.Context, filter bson.M) ([]primitive.ObjectID, error) {
+	var open []primitive.ObjectID
+	err := s.conn.retry(ctx, func(ctx context.Context) error {
+		blockers, err := s.coll.Distinct(ctx, "blocked_by", filter)
+		if err != nil {
+			return err
+		}
+		if len(blockers) == 0 {
+			open = []primitive.ObjectID{}
+			return nil
+		}
+		open, err = orderedIDs(ctx, s.coll, bson.M{"_id": bson.M{"$in": blockers}, "completed": false})
+		return err
+	})
+	return open, err
+}
+
+func (s *mongoTodoRepository) Count(ctx context.Context, q listQuery) (int64, error) {
+	filter, err := s.filter(ctx, q)
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	err = s.conn.retry(ctx, func(ctx context.Context) error {
+		n, err = s.coll.CountDocuments(ctx, filter)
+		return err
+	})
+	return n, err
+}
+
+func (s *mongoTodoRepository) Counts(ctx context.Context, b dueBounds) (todoCounts, error) {
+	bucket := bson.M{"$switch": bson.M{
+		"branches": bson.A{
+			bson.M{"case": bson.M{"$in": bson.A{bson.M{"$type": "$due_date"}, bson.A{"missing", "null"}}}, "then": "none"},
+			bson.M{"case": bson.M{"$lt": bson.A{"$due_date", b.Today}}, "then": "overdue"},
+			bson.M{"case": bson.M{"$lt": bson.A{"$due_date", b.Tomorrow}}, "then": "today"},
+			bson.M{"case": bson.M{"$lt": bson.A{"$due_date", b.NextWeek}}, "then": "this_week"},
+		},
+		"default": "later",
+	}}
+	pipeline := mongo.Pipeline{{{Key: "$facet", Value: bson.M{
+		"status": bson.A{
+			bson.M{"$group": bson.M{"_id": "$completed", "n": bson.M{"$sum": 1}}},
+		},
+		"due": bson.A{
+			bson.M{"$match": bson.M{"completed": false}},
+			bson.M{"$group": bson.M{"_id": bucket, "n": bson.M{"$sum": 1}}},
+		},
+		"tags": bson.A{
+			bson.M{"$unwind": "$tags"},
+			bson.M{"$group": bson.M{"_id": "$tags", "n": bson.M{"$sum": 1}}},
+		},
+	}}}}
+	type group struct {
+		ID    interface{} `bson:"_id"`
+		Count int64       `bson:"n"`
+	}
+	var res []struct {
+		Status []group `bson:"status"`
+		Due    []group `bson:"due"`
+		Tags   []group `bson:"tags"`
+	}
+	err := s.conn.retry(ctx, func(ctx context.Context) error {
+		cursor, err := s.coll.Aggregate(ctx, pipeline)
+		if err != nil {
+			return err
+		}
+		return cursor.All(ctx, &res)
+	})
+	if err != nil {
+		return todoCounts{}, err
+	}
+
+	c := todoCounts{Tags: map[string]int64{}}
+	if len(res) == 0 {
+		return c, nil
+	}
+	for _, g := range res[0].Status {
+		if g.ID == true {
+			c.Status.Completed = g.Count
+		} else {
+			c.Status.Open = g.Count
+		}
+		c.Total += g.Count
+	}
+	for _, g := range res[0].Due {
+		name, _ := g.ID.(string)
+		c.Due.add(name, g.Count)
+	}
+	for _, g := range res[0].Tags {
+		if name, ok := g.ID.(string); ok {
+			c.Tags[name] = g.Count
+		}
+	}
+	return c, nil
+}
+
+// mongoBoardRepository keeps columns in their own collection and a
+// todo's column and position on the todo, writing through todos so
+// moves reach the outbox.
+type mongoBoardRepository struct {
+	columns *mongo.Collection
+	todos   *mongoTodoRepository
+}
+
+func newMongoBoardRepository(columns *mongo.Collection, todos *mongoTodoRepository) *mongoBoardRepository {
+	return &mongoBoardRepository{columns: columns, todos: todos}
+}
+
+func (b *mongoBoardRepository) Columns(ctx context.Context) ([]column, error) {
+	columns := []column{}
+	err := b.todos.conn.retry(ctx, func(ctx context.Context) error {
+		cursor, err := b.columns.Find(ctx, bson.M{}, options.Find().SetSort(byPosition))
+		if err != nil {
+			return err
+		}
+		return cursor.All(ctx, &columns)
+	})
+	return columns, err
+}
+
+func (b *mongoBoardRepository) CreateColumn(ctx context.Context, name string) (column, error) {
+	c := column{ID: primitive.NewObjectID(), Name: name}
+	err := b.todos.conn.withTransaction(ctx, func(ctx context.Context) error {
+		n, err := b.columns.CountDocuments(ctx, bson.M{})
+		if err != nil {
+			return err
+		}
+		c.Position = int(n)
+		_, err = b.columns.InsertOne(ctx, c)
+		return err
+	})
+	return c, err
+}
+
+func (b *mongoBoardRepository) UpdateColumn(ctx context.Context, id primitive.ObjectID, name string, position int) (column, error) {
+	var c column
+	err := b.todos.conn.withTransaction(ctx, func(ctx context.Context) error {
+		res, err := b.columns.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"name": name}})
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount == 0 {
+			return errColumnNotFound
+		}
+		if err := reorder(ctx, b.columns, bson.M{}, id, position); err != nil {
+			return err
+		}
+		return b.columns.FindOne(ctx, bson.M{"_id": id}).Decode(&c)
+	})
+	return c, err
+}
+
+func (b *mongoBoardRepository) DeleteColumn(ctx context.Context, id primitive.ObjectID) error {
+	return b.todos.conn.withTransaction(ctx, func(ctx context.Context) error {
+		n, err := b.todos.coll.CountDocuments(ctx, bson.M{"column_id": id}, options.Count().SetLimit(1))
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return errColumnNotEmpty
+		}
+		res, err := b.columns.DeleteOne(ctx, bson.M{"_id": id})
+		if err != nil {
+			return err
+		}
+		if res.DeletedCount == 0 {
+			return errColumnNotFound
+		}
+		ids, err := orderedIDs(ctx, b.columns, bson.M{})
+		if err != nil {
+			return err
+		}
+		return renumber(ctx, b.columns, ids)
+	})
+}
+
+// Move emits an update for the moved todo only; neighbours whose
+// position shifted are not announced, nor do they show in the change
+// feed.
+func (b *mongoBoardRepository) Move(ctx context.Context, id, columnID primitive.ObjectID, position int) (todoModel, error) {
+	var moved todoModel
+	err := b.todos.writeTx(ctx, func(ctx context.Context) (*events.Event, error) {
+		if err := b.columns.FindOne(ctx, bson.M{"_id": columnID}).Err(); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return nil, errColumnNotFound
+			}
+			return nil, err
+		}
+		var before todoModel
+		if err := b.todos.coll.FindOne(ctx, bson.M{"_id": id}).Decode(&before); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return nil, errTodoNotFound
+			}
+			return nil, err
+		}
+
+		if _, err := b.todos.coll.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"column_id": columnID, "updated_at": time.Now()}}); err != nil {
+			return nil, err
+		}
+		if before.ColumnID != nil && *before.ColumnID != columnID {
+			// Close the gap the todo left behind.
+			ids, err := orderedIDs(ctx, b.todos.coll, bson.M{"column_id": *before.ColumnID})
+			if err != nil {
+				return nil, err
+			}
+			if err := renumber(ctx, b.todos.coll, ids); err != nil {
+				return nil, err
+			}
+		}
+		if err := reorder(ctx, b.todos.coll, bson.M{"column_id": columnID}, id, position); err != nil {
+			return nil, err
+		}
+
+		if err := b.todos.coll.FindOne(ctx, bson.M{"_id": id}).Decode(&moved); err != nil {
+			return nil, err
+		}
+		if err := b.todos.open(&moved); err != nil {
+			return nil, err
+		}
+		return &events.Event{Type: events.TodoUpdated, Subject: id.Hex(), Data: moved.toTodo()}, nil
+	})
+	return moved, err
+}
+
+// byPosition is board order; _id settles any tie left by a racing insert.
+var byPosition = bson.D{{Key: "position", Value: 1}, {Key: "_id", Value: 1}}
+
+// reorder moves id to position among the documents matching filter and
+// renumbers them all.
+func reorder(ctx context.Context, coll *mongo.Collection, filter bson.M, id primitive.ObjectID, position int) error {
+	ids, err := orderedIDs(ctx, coll, filter)
+	if err != nil {
+		return err
+	}
+	ids = slices.DeleteFunc(ids, func(other primitive.ObjectID) bool { return other == id })
+	position = min(max(position, 0), len(ids))
+	return renumber(ctx, coll, slices.Insert(ids, position, id))
+}
+
+func orderedIDs(ctx context.Context, coll *mongo.Collection, filter bson.M) ([]primitive.ObjectID, error) {
+	cursor, err := coll.Find(ctx, filter, options.Find().SetSort(byPosition).SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var docs []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, len(docs))
+	for i, d := range docs {
+		ids[i] = d.ID
+	}
+	return ids, nil
+}
+
+// renumber stores position i on ids[i].
+func renumber(ctx context.Context, coll *mongo.Collection, ids []primitive.ObjectID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	models := make([]mongo.WriteModel, len(ids))
+	for i, id := range ids {
+		models[i] = mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": id}).
+			SetUpdate(bson.M{"$set": bson.M{"position": i}})
+	}
+	_, err := coll.BulkWrite(ctx, models)
+	return err
+}
+
+// The repositories below go through conn.retry like the todos do. Each
+// retried write is safe to repeat, though a delete repeated after one
+// that landed unseen reports the document as not found.
+type mongoTemplateRepository struct {
+	coll *mongo.Collection
+	conn *mongoConn
+}
+
+func newMongoTemplateRepository(coll *mongo.Collection, conn *mongoConn) *mongoTemplateRepository {
+	return &mongoTemplateRepository{coll: coll, conn: conn}
+}
+
+func (s *mongoTemplateRepository) List(ctx context.Context) ([]todoTemplate, error) {
+	templates := []todoTemplate{}
+	err := s.conn.retry(ctx, func(ctx context.Context) error {
+		cursor, err := s.coll.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+		if err != nil {
+			return err
+		}
+		return cursor.All(ctx, &templates)
+	})
+	return templates, err
+}
+
+func (s *mongoTemplateRepository) Get(ctx context.Context, id primitive.ObjectID) (todoTemplate, error) {
+	var t todoTemplate
+	err := s.conn.retry(ctx, func(ctx context.Context) error {
+		return s.coll.FindOne(ctx, bson.M{"_id": id}).Decode(&t)
+	})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return t, errTemplateNotFound
+	}
+	return t, err
+}
+
+func (s *mongoTemplateRepository) Save(ctx context.Context, t todoTemplate) error {
+	return s.conn.retry(ctx, func(ctx context.Context) error {
+		_, err := s.coll.ReplaceOne(ctx, bson.M{"_id": t.ID}, t, options.Replace().SetUpsert(true))
+		return err
+	})
+}
+
+func (s *mongoTemplateRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	var deleted int64
+	err := s.conn.retry(ctx, func(ctx context.Context) error {
+		res, err := s.coll.DeleteOne(ctx, bson.M{"_id": id})
+		if err == nil {
+			deleted = res.DeletedCount
+		}
+		return err
+	})
+	if err == nil && deleted == 0 {
+		return errTemplateNotFound
+	}
+	return err
+}
+
+type mongoCustomFieldRepository struct {
+	coll *mongo.Collection
+	// todos hold the values, which change with the definition.
+	todos *mongo.Collection
+	conn  *mongoConn
+}
+
+func newMongoCustomFieldRepository(coll, todos *mongo.Collection, conn *mongoConn) *mongoCustomFieldRepository {
+	return &mongoCustomFieldRepository{coll: coll, todos: todos, conn: conn}
+}
+
+func (s *mongoCustomFieldRepository) List(ctx context.Context) ([]customField, error) {
+	fields := []customField{}
+	err := s.conn.retry(ctx, func(ctx context.Context) error {
+		cursor, err := s.coll.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+		if err != nil {
+			return err
+		}
+		return cursor.All(ctx, &fields)
+	})
+	return fields, err
+}
+
+// Save compares f with the definition it replaced. A retry after a
+// replace that landed unseen compares f with itself and leaves stale
+// values for the next save to clear.
+func (s *mongoCustomFieldRepository) Save(ctx context.Context, f customField) error {
+	var before customField
+	err := s.conn.retry(ctx, func(ctx context.Context) error {
+		return s.coll.FindOneAndReplace(ctx, bson.M{"_id": f.Key}, f, options.FindOneAndReplace().SetUpsert(true)).Decode(&before)
+	})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	field := "custom." + f.Key
+	var stale bson.M
+	switch {
+	case before.Type != f.Type:
+		stale = bson.M{field: bson.M{"$exists": true}}
+	case f.Type == customSelect:
+		stale = bson.M{field: bson.M{"$exists": true, "$nin": f.Options}}
+	default:
+		return nil
+	}
+	// Not in a transaction: a value written in between is caught by the
+	// next save, and reads tolerate it meanwhile.
+	return s.unset(ctx, field, stale)
+}
+
+func (s *mongoCustomFieldRepository) Delete(ctx context.Context, key string) error {
+	var deleted int64
+	err := s.conn.retry(ctx, func(ctx context.Context) error {
+		res, err := s.coll.DeleteOne(ctx, bson.M{"_id": key})
+		if err == nil {
+			deleted = res.DeletedCount
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return errCustomFieldNotFound
+	}
+	field := "custom." + key
+	return s.unset(ctx, field, bson.M{field: bson.M{"$exists": true}})
+}
+
+// unset removes field from the todos matching filter.
+func (s *mongoCustomFieldRepository) unset(ctx context.Context, field string, filter bson.M) error {
+	return s.conn.retry(ctx, func(ctx context.Context) error {
+		_, err := s.todos.UpdateMany(ctx, filter, bson.M{
+			"$unset": bson.M{field: ""},
+			"$set":   bson.M{"updated_at": time.Now()},
+		})
+		return err
+	})
+}
+
+// mongoSettingsRepository loads unsaved settings with pages of
+// cfg.PageSize todos.
+type mongoSettingsRepository struct {
+	coll     *mongo.Collection
+	conn     *mongoConn
+	pageSize int
+}
+
+func newMongoSettingsRepository(coll *mongo.Collection, conn *mongoConn, cfg config) *mongoSettingsRepository {
+	return &mongoSettingsRepository{coll: coll, conn: conn, pageSize: int(cfg.PageSize)}
+}
+
+func (s *mongoSettingsRepository) Load(ctx context.Context) (settings, error) {
+	out := defaultSettings(s.pageSize)
+	err := s.conn.retry(ctx, func(ctx context.Context) error {
+		return s.coll.FindOne(ctx, bson.M{"_id": settingsID}).Decode(&out)
+	})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return defaultSettings(s.pageSize), nil
+	}
+	return out, err
+}
+
+func (s *mongoSettingsRepository) Save(ctx context.Context, v settings) error {
+	v.UpdatedAt = time.Now()
+	return s.conn.retry(ctx, func(ctx context.Context) error {
+		_, err := s.coll.ReplaceOne(ctx, bson.M{"_id": settingsID}, v, options.Replace().SetUpsert(true))
+		return err
+	})
+}
+
+// mongoNotificationRepository keeps the notification channels in one
+// document, like settings. Webhook URLs and bot tokens are credentials,
+// so they are sealed like todo titles.
+type mongoNotificationRepository struct {
+	coll   *mongo.Collection
+	conn   *mongoConn
+	cipher *fieldcrypt.Cipher
+}
+
+func newMongoNotificationRepository(coll *mongo.Collection, conn *mongoConn, cipher *fieldcrypt.Cipher) *mongoNotificationRepository {
+	return &mongoNotificationRepository{coll: coll, conn: conn, cipher: cipher}
+}
+
+func channelAAD(name, field string) []byte {
+	return []byte("notifications/" + name + "/" + field)
+}
+
+func (s *mongoNotificationRepository) Load(ctx context.Context) (notificationSettings, error) {
+	out := notificationSettings{Channels: []notificationChannel{}}
+	err := s.conn.retry(ctx, func(ctx context.Context) error {
+		return s.coll.FindOne(ctx, bson.M{"_id": settingsID}).Decode(&out)
+	})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return out, nil
+	}
+	if err != nil {
+		return out, err
+	}
+	for i := range out.Channels {
+		c := &out.Channels[i]
+		if c.URL, err = s.cipher.Decrypt(c.URL, channelAAD(c.Name, "url")); err != nil {
+			return out, err
+		}
+		if c.Token, err = s.cipher.Decrypt(c.Token, channelAAD(c.Name, "token")); err != nil {
+			return out, err
+		}
+	}
+	return out, nil
+}
+
+func (s *mongoNotificationRepository) Save(ctx context.Context, v notificationSettings) error {
+	sealed := v
+	sealed.Channels = slices.Clone(v.Channels)
+	for i := range sealed.Channels {
+		c := &sealed.Channels[i]
+		var err error
+		if c.URL != "" {
+			if c.URL, err = s.cipher.Encrypt(c.URL, channelAAD(c.Name, "url")); err != nil {
+				return err
+			}
+		}
+		if c.Token != "" {
+			if c.Token, err = s.cipher.Encrypt(c.Token, channelAAD(c.Name, "token")); err != nil {
+				return err
+			}
+		}
+	}
+	return s.conn.retry(ctx, func(ctx context.Context) error {
+		_, err := s.coll.ReplaceOne(ctx, bson.M{"_id": settingsID}, sealed, options.Replace().SetUpsert(true))
+		return err
+	})
+}
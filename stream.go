@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"todo/internal/render"
+)
+
+// contentNDJSON is newline-delimited JSON: one todo per line.
+const contentNDJSON = "application/x-ndjson"
+
+// streamFlushEvery is how many todos a stream writes between flushes.
+const streamFlushEvery = 100
+
+// streamTodos writes q's todos to w as they come off the cursor instead
+// of listing them first. start runs before the first todo is written, or
+// at the end when there are none, and sends the headers. An error before
+// then is returned for the caller to answer as usual; after it the status
+// is already out, so the response is aborted and the client sees a body
+// cut short rather than a complete-looking one.
+func (a *app) streamTodos(ctx context.Context, w http.ResponseWriter, r *http.Request, q listQuery, start func(), write func(todoModel) error) error {
+	rc := http.NewResponseController(w)
+	started, n := false, 0
+	err := a.todos.Each(ctx, q, func(t todoModel) error {
+		if !started {
+			start()
+			started = true
+		}
+		if err := write(t); err != nil {
+			return err
+		}
+		if n++; n%streamFlushEvery == 0 {
+			// Not every writer can flush; those send it all at the end.
+			rc.Flush()
+		}
+		return nil
+	})
+	if err != nil && started {
+		log.Printf("streaming %s %s stopped after %d todos: %v", r.Method, r.URL.Path, n, err)
+		panic(http.ErrAbortHandler)
+	}
+	if err != nil {
+		return err
+	}
+	if !started {
+		start()
+	}
+	return nil
+}
+
+// streamedList is the type fetchTodos should stream its answer as, or ""
+// to have respond buffer it. NDJSON always streams; plain JSON only does
+// unpaged, since a page is small and carries a total worked out up front.
+// The offers are respond's for the list, so both settle on the same type.
+func streamedList(r *http.Request, p page, fields []string) string {
+	offers := []string{"application/json"}
+	if fields == nil {
+		offers = append(offers, "application/xml", "text/xml")
+	}
+	offers = append(offers, "application/msgpack", "application/x-msgpack", contentJSONAPI, contentNDJSON)
+	switch render.Negotiate(r.Header.Get("Accept"), offers...) {
+	case contentNDJSON:
+		return contentNDJSON
+	case "application/json":
+		if p.Size == 0 {
+			return render.ContentJSON
+		}
+	}
+	return ""
+}
+
+// streamList answers fetchTodos with q's todos streamed as contentType,
+// which streamedList chose: a line each for NDJSON, or the usual
+// {"data": [...], "_links": ...} body for JSON.
+func (a *app) streamList(ctx context.Context, w http.ResponseWriter, r *http.Request, q listQuery, p page, fields []string, contentType string) {
+	base := todoBase(r)
+	array := contentType != contentNDJSON
+	sep := []byte{}
+	start := func() {
+		w.Header().Add("Vary", "Accept")
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(http.StatusOK)
+		if array {
+			io.WriteString(w, `{"data":[`)
+		}
+	}
+	err := a.streamTodos(ctx, w, r, q, start, func(m todoModel) error {
+		t := m.toTodo()
+		t.Links = todoLinks(base, t.ID)
+		b, err := json.Marshal(t.sparse(fields))
+		if err != nil {
+			return err
+		}
+		if array {
+			b, sep = append(sep, b...), []byte{','}
+		} else {
+			b = append(b, '\n')
+		}
+		_, err = w.Write(b)
+		return err
+	})
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "todo.fetch_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	if array {
+		b, _ := json.Marshal(listLinks(r, p, 0))
+		fmt.Fprintf(w, "],\"_links\":%s}\n", b)
+	}
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"todo/internal/render"
+)
+
+const (
+	maxSyncChanges = 500
+
+	syncLastWriterWins = "lww"
+	syncFieldMerge     = "merge"
+)
+
+// syncRequest is a batch of changes a client made offline, and the token
+// from its last sync.
+type syncRequest struct {
+	Since    string       `json:"since"`
+	Strategy string       `json:"strategy"`
+	Changes  []syncChange `json:"changes"`
+}
+
+// syncChange is one client-side change. At is when the client made it.
+// Data holds only the fields it changed; Base, for merges, holds those
+// fields as the client last saw them from the server. ClientID names a
+// created todo until the client learns its ID.
+type syncChange struct {
+	Action   string                     `json:"action"`
+	ID       string                     `json:"id,omitempty"`
+	ClientID string                     `json:"client_id,omitempty"`
+	At       time.Time                  `json:"at"`
+	Data     map[string]json.RawMessage `json:"data,omitempty"`
+	Base     map[string]json.RawMessage `json:"base,omitempty"`
+}
+
+// syncResult says what became of the change at Index: applied, merged
+// (applied with some fields lost to the server), conflict (nothing
+// applied), not_found or rejected.
+type syncResult struct {
+	Index     int            `json:"index"`
+	Status    string         `json:"status"`
+	ID        string         `json:"id,omitempty"`
+	ClientID  string         `json:"client_id,omitempty"`
+	Conflicts []syncConflict `json:"conflicts,omitempty"`
+	Message   string         `json:"message,omitempty"`
+}
+
+type syncConflict struct {
+	Field  string `json:"field"`
+	Winner string `json:"winner"`
+}
+
+// syncTodos applies a client's offline changes in order and answers with
+// the outcome of each and everything that changed on the server since the
+// client's token, including the changes just applied once they settle.
+//
+// Conflicts are settled with ?strategy=lww (the default), where a change
+// loses outright to any server write made after it, or with merge, where
+// only the fields both sides changed are contested and each goes to the
+// later writer. A change and a concurrent request to the same todo race
+// like any two updates.
+func (a *app) syncTodos(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	var in syncRequest
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "request.invalid_body"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	if in.Strategy == "" {
+		in.Strategy = syncLastWriterWins
+	}
+	if in.Strategy != syncLastWriterWins && in.Strategy != syncFieldMerge {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "sync.strategy_invalid"),
+		})
+		return
+	}
+	if len(in.Changes) > maxSyncChanges {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "sync.too_many_changes", maxSyncChanges),
+		})
+		return
+	}
+	since, ok := a.parseSince(w, r, in.Since)
+	if !ok {
+		return
+	}
+	var creates int64
+	for _, c := range in.Changes {
+		if c.Action == "create" {
+			creates++
+		}
+	}
+	if creates > 0 && !a.checkTodoQuota(ctx, w, r, creates) {
+		return
+	}
+
+	results := make([]syncResult, len(in.Changes))
+	for i, c := range in.Changes {
+		if c.At.IsZero() || c.At.After(time.Now()) {
+			// A client clock ahead of ours would otherwise win every
+			// conflict.
+			c.At = time.Now()
+		}
+		var res syncResult
+		var err error
+		switch c.Action {
+		case "create":
+			res, err = a.syncCreate(ctx, r, c)
+		case "update":
+			res, err = a.syncUpdate(ctx, r, c, in.Strategy)
+		case "delete":
+			res, err = a.syncDelete(ctx, r, c)
+		default:
+			res = syncResult{Status: "rejected", Message: tr(r, "sync.action_invalid")}
+		}
+		if err != nil {
+			a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+				"message": tr(r, "sync.failed", i),
+				"error":   err.Error(),
+				"results": results[:i],
+			})
+			return
+		}
+		res.Index, res.ClientID = i, c.ClientID
+		if res.ID == "" && c.Action != "create" {
+			res.ID = c.ID
+		}
+		results[i] = res
+	}
+
+	changes, next, more, err := a.collectChanges(ctx, siblingTodoBase(r, "sync"), since, defaultChangeLimit)
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "todo.fetch_failed"),
+			"error":   err.Error(),
+			"results": results,
+		})
+		return
+	}
+	a.rnd.JSON(w, http.StatusOK, render.M{
+		"results":  results,
+		"changes":  changes,
+		"next":     next.String(),
+		"has_more": more,
+	})
+}
+
+// syncCreate stores a todo made offline. Only storage errors are
+// returned; anything wrong with the change itself is a rejected result.
+func (a *app) syncCreate(ctx context.Context, r *http.Request, c syncChange) (syncResult, error) {
+	t := todoModel{ID: primitive.NewObjectID(), CreatedAt: time.Now()}
+	if err := setSyncFields(&t, c.Data); err != nil || t.Title == "" {
+		return rejected(r, err), nil
+	}
+	if key := syncCheck(t); key != "" {
+		return syncResult{Status: "rejected", Message: tr(r, key)}, nil
+	}
+	if err := a.todos.Create(ctx, t); err != nil {
+		return syncResult{}, err
+	}
+	return syncResult{Status: "applied", ID: t.ID.Hex()}, nil
+}
+
+func (a *app) syncUpdate(ctx context.Context, r *http.Request, c syncChange, strategy string) (syncResult, error) {
+	id, err := primitive.ObjectIDFromHex(c.ID)
+	if err != nil {
+		return syncResult{Status: "rejected", Message: tr(r, "todo.id_invalid")}, nil
+	}
+	current, err := a.todos.Get(ctx, id)
+	if errors.Is(err, errTodoNotFound) {
+		return syncResult{Status: "not_found", ID: c.ID}, nil
+	}
+	if err != nil {
+		return syncResult{}, err
+	}
+	serverNewer := current.UpdatedAt.After(c.At)
+	if strategy == syncLastWriterWins && serverNewer {
+		return syncResult{Status: "conflict", ID: c.ID}, nil
+	}
+
+	base := current
+	if err := setSyncFields(&base, c.Base); err != nil {
+		return rejected(r, err), nil
+	}
+	next := current
+	changed := false
+	var conflicts []syncConflict
+	fields := make([]string, 0, len(c.Data))
+	for f := range c.Data {
+		fields = append(fields, f)
+	}
+	slices.Sort(fields)
+	for _, f := range fields {
+		mine := next
+		if err := setSyncField(&mine, f, c.Data[f]); err != nil {
+			return rejected(r, err), nil
+		}
+		server := syncValue(current, f)
+		if syncValue(mine, f) == server {
+			continue
+		}
+		// Without a base, any server write after the change may have
+		// touched the field.
+		contested := serverNewer
+		if _, ok := c.Base[f]; ok {
+			contested = syncValue(base, f) != server
+		}
+		if contested && serverNewer {
+			conflicts = append(conflicts, syncConflict{Field: f, Winner: "server"})
+			continue
+		}
+		if contested {
+			conflicts = append(conflicts, syncConflict{Field: f, Winner: "client"})
+		}
+		next, changed = mine, true
+	}
+	if !changed {
+		status := "applied"
+		if len(conflicts) > 0 {
+			status = "conflict"
+		}
+		return syncResult{Status: status, ID: c.ID, Conflicts: conflicts}, nil
+	}
+
+	if key := syncCheck(next); key != "" {
+		return syncResult{Status: "rejected", Message: tr(r, key)}, nil
+	}
+	var blocked *blockedError
+	if err := a.service.Update(ctx, next, false, nil); errors.As(err, &blocked) {
+		return syncResult{Status: "rejected", Message: tr(r, "todo.blocked")}, nil
+	} else if err != nil {
+		return syncResult{}, err
+	}
+	status := "applied"
+	if slices.ContainsFunc(conflicts, func(c syncConflict) bool { return c.Winner == "server" }) {
+		status = "merged"
+	}
+	return syncResult{Status: status, ID: c.ID, Conflicts: conflicts}, nil
+}
+
+// syncDelete deletes a todo unless the server changed it after the client
+// deleted it, in which case the todo stays and shows in the changes.
+func (a *app) syncDelete(ctx context.Context, r *http.Request, c syncChange) (syncResult, error) {
+	id, err := primitive.ObjectIDFromHex(c.ID)
+	if err != nil {
+		return syncResult{Status: "rejected", Message: tr(r, "todo.id_invalid")}, nil
+	}
+	current, err := a.todos.Get(ctx, id)
+	if errors.Is(err, errTodoNotFound) {
+		return syncResult{Status: "not_found", ID: c.ID}, nil
+	}
+	if err != nil {
+		return syncResult{}, err
+	}
+	if current.UpdatedAt.After(c.At) {
+		return syncResult{Status: "conflict", ID: c.ID}, nil
+	}
+	if err := a.todos.Delete(ctx, id, nil); err != nil {
+		return syncResult{}, err
+	}
+	return syncResult{Status: "applied", ID: c.ID}, nil
+}
+
+func rejected(r *http.Request, err error) syncResult {
+	if err == nil {
+		return syncResult{Status: "rejected", Message: tr(r, "todo.title_field_required")}
+	}
+	return syncResult{Status: "rejected", Message: tr(r, "sync.data_invalid", err.Error())}
+}
+
+// syncCheck is checkTodo for a todo that came in through sync. It returns
+// the message key of the first problem.
+func syncCheck(t todoModel) string {
+	if t.StartDate != nil && t.DueDate != nil && t.StartDate.After(*t.DueDate) {
+		return "todo.start_after_due"
+	}
+	return ""
+}
+
+func setSyncFields(t *todoModel, data map[string]json.RawMessage) error {
+	for f, raw := range data {
+		if err := setSyncField(t, f, raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setSyncField decodes one of the fields a client may sync into t.
+func setSyncField(t *todoModel, field string, raw json.RawMessage) error {
+	var err error
+	switch field {
+	case "title":
+		var title string
+		err = json.Unmarshal(raw, &title)
+		t.Title = strings.TrimSpace(title)
+	case "completed":
+		err = json.Unmarshal(raw, &t.Completed)
+	case "start_date":
+		t.StartDate = nil
+		err = json.Unmarshal(raw, &t.StartDate)
+	case "due_date":
+		t.DueDate = nil
+		err = json.Unmarshal(raw, &t.DueDate)
+	case "tags":
+		var tags []string
+		err = json.Unmarshal(raw, &tags)
+		t.Tags = normalizeTags(tags)
+	case "priority":
+		var name string
+		if err = json.Unmarshal(raw, &name); err == nil {
+			if t.Priority = priorityLevel(name); t.Priority < 0 {
+				err = fmt.Errorf("must be one of: %s", strings.Join(priorityNames[1:], ", "))
+			}
+		}
+	default:
+		return fmt.Errorf("%s: cannot be synced", field)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", field, err)
+	}
+	return nil
+}
+
+// syncValue is field of t in a canonical form, for telling whether two
+// versions differ.
+func syncValue(t todoModel, field string) string {
+	out := t.toTodo()
+	var v interface{}
+	switch field {
+	case "title":
+		v = out.Title
+	case "completed":
+		v = out.Completed
+	case "start_date":
+		v = out.StartDate
+	case "due_date":
+		v = out.DueDate
+	case "tags":
+		v = out.Tags
+	case "priority":
+		v = out.Priority
+	}
+	if d, ok := v.(*time.Time); ok && d != nil {
+		v = d.UTC()
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
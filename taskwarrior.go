@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// taskwarriorLayout is how Taskwarrior's JSON writes dates, always UTC.
+const taskwarriorLayout = "20060102T150405Z"
+
+// taskwarriorPriorities are Taskwarrior's H/M/L, by priority level.
+var taskwarriorPriorities = map[int]string{3: "H", 2: "M", 1: "L"}
+
+type (
+	// taskwarriorTask is a task as `task export` writes it and `task
+	// import` reads it. Attributes without a counterpart here are dropped
+	// on import.
+	taskwarriorTask struct {
+		UUID        string                  `json:"uuid"`
+		Description string                  `json:"description"`
+		Status      string                  `json:"status"`
+		Entry       taskwarriorTime         `json:"entry"`
+		Modified    *taskwarriorTime        `json:"modified,omitempty"`
+		End         *taskwarriorTime        `json:"end,omitempty"`
+		Due         *taskwarriorTime        `json:"due,omitempty"`
+		Scheduled   *taskwarriorTime        `json:"scheduled,omitempty"`
+		Wait        *taskwarriorTime        `json:"wait,omitempty"`
+		Priority    string                  `json:"priority,omitempty"`
+		Project     string                  `json:"project,omitempty"`
+		Tags        []string                `json:"tags,omitempty"`
+		Depends     taskwarriorDepends      `json:"depends,omitempty"`
+		Annotations []taskwarriorAnnotation `json:"annotations,omitempty"`
+	}
+	taskwarriorAnnotation struct {
+		Entry       taskwarriorTime `json:"entry"`
+		Description string          `json:"description"`
+	}
+	taskwarriorTime struct{ time.Time }
+	// taskwarriorDepends are the UUIDs a task waits on. Taskwarrior 2.6
+	// writes an array; older versions a comma-separated string.
+	taskwarriorDepends []string
+)
+
+func (t taskwarriorTime) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.UTC().Format(taskwarriorLayout))
+}
+
+func (t *taskwarriorTime) UnmarshalJSON(data []byte) (err error) {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	t.Time, err = time.Parse(taskwarriorLayout, s)
+	return err
+}
+
+func (d *taskwarriorDepends) UnmarshalJSON(data []byte) error {
+	var s string
+	if json.Unmarshal(data, &s) == nil {
+		*d = nil
+		if s != "" {
+			*d = strings.Split(s, ",")
+		}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(d))
+}
+
+func newTaskwarriorTime(t *time.Time) *taskwarriorTime {
+	if t == nil {
+		return nil
+	}
+	return &taskwarriorTime{*t}
+}
+
+// taskwarriorUUID is the stable UUID a todo is exported under, so
+// exporting again updates a mirrored copy instead of duplicating it. The
+// twelve ObjectID bytes fill a version 8 (custom) UUID.
+func taskwarriorUUID(id primitive.ObjectID) string {
+	var u [16]byte
+	copy(u[:6], id[:6])
+	u[6] = 0x80
+	u[7] = id[6]
+	u[8] = 0x80
+	copy(u[9:14], id[7:])
+	h := hex.EncodeToString(u[:])
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+// writeTaskwarrior writes todos as a Taskwarrior JSON array. Blockers
+// become depends and notes annotations; the start date is scheduled.
+func writeTaskwarrior(todos []todoModel) ([]byte, error) {
+	tasks := make([]taskwarriorTask, len(todos))
+	for i, t := range todos {
+		task := taskwarriorTask{
+			UUID:        taskwarriorUUID(t.ID),
+			Description: t.Title,
+			Status:      "pending",
+			Entry:       taskwarriorTime{t.CreatedAt},
+			Due:         newTaskwarriorTime(t.DueDate),
+			Scheduled:   newTaskwarriorTime(t.StartDate),
+			Priority:    taskwarriorPriorities[t.Priority],
+			Tags:        t.Tags,
+		}
+		if t.Completed {
+			task.Status = "completed"
+			task.End = newTaskwarriorTime(t.CompletedAt)
+		}
+		if !t.UpdatedAt.IsZero() {
+			task.Modified = &taskwarriorTime{t.UpdatedAt}
+		}
+		for _, id := range t.BlockedBy {
+			task.Depends = append(task.Depends, taskwarriorUUID(id))
+		}
+		for _, n := range t.Notes {
+			task.Annotations = append(task.Annotations, taskwarriorAnnotation{taskwarriorTime{n.At}, n.Text})
+		}
+		tasks[i] = task
+	}
+	return json.Marshal(tasks)
+}
+
+// parseTaskwarrior reads a Taskwarrior JSON array, or one task per line as
+// older versions export. Deleted tasks and recurrence templates are
+// skipped; the templates' pending instances are imported instead. A
+// project becomes a tag, wait stands in for a missing scheduled date, and
+// depends on tasks in the same file become blockers.
+func parseTaskwarrior(data []byte, _ *time.Location, now time.Time) ([]todoModel, error) {
+	var tasks []taskwarriorTask
+	if data = bytes.TrimSpace(data); bytes.HasPrefix(data, []byte("[")) {
+		if err := json.Unmarshal(data, &tasks); err != nil {
+			return nil, err
+		}
+	} else {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		for dec.More() {
+			var task taskwarriorTask
+			if err := dec.Decode(&task); err != nil {
+				return nil, fmt.Errorf("task %d: %w", len(tasks)+1, err)
+			}
+			tasks = append(tasks, task)
+		}
+	}
+
+	var (
+		out     []todoModel
+		depends []taskwarriorDepends
+		ids     = map[string]primitive.ObjectID{}
+	)
+	for i, task := range tasks {
+		if task.Status == "deleted" || task.Status == "recurring" {
+			continue
+		}
+		if strings.TrimSpace(task.Description) == "" {
+			return nil, fmt.Errorf("task %d: no description", i+1)
+		}
+		t := todoModel{
+			ID:        primitive.NewObjectID(),
+			Title:     task.Description,
+			Completed: task.Status == "completed",
+			CreatedAt: task.Entry.Time,
+			Tags:      task.Tags,
+		}
+		if t.CreatedAt.IsZero() {
+			t.CreatedAt = now
+		}
+		if t.Completed && task.End != nil {
+			t.CompletedAt = &task.End.Time
+		}
+		if task.Due != nil {
+			t.DueDate = &task.Due.Time
+		}
+		if start := task.Scheduled; start != nil || task.Wait != nil {
+			if start == nil {
+				start = task.Wait
+			}
+			t.StartDate = &start.Time
+		}
+		for level, p := range taskwarriorPriorities {
+			if p == task.Priority {
+				t.Priority = level
+			}
+		}
+		if task.Project != "" {
+			t.Tags = append(t.Tags, task.Project)
+		}
+		t.Tags = normalizeTags(t.Tags)
+		for _, a := range task.Annotations {
+			t.Notes = append(t.Notes, todoNote{At: a.Entry.Time, Text: a.Description})
+		}
+		if task.UUID != "" {
+			ids[task.UUID] = t.ID
+		}
+		out = append(out, t)
+		depends = append(depends, task.Depends)
+	}
+	for i := range out {
+		for _, uuid := range depends[i] {
+			if id, ok := ids[strings.TrimSpace(uuid)]; ok && id != out[i].ID {
+				out[i].BlockedBy = append(out[i].BlockedBy, id)
+			}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"todo/internal/render"
+)
+
+const templatesCollection string = "templates"
+
+type (
+	// todoTemplate is a reusable todo with preset subtasks. Due dates
+	// are whole days from the moment it is instantiated.
+	todoTemplate struct {
+		ID        primitive.ObjectID `bson:"_id" json:"id"`
+		Name      string             `bson:"name" json:"name"`
+		Title     string             `bson:"title" json:"title"`
+		Tags      []string           `bson:"tags,omitempty" json:"tags,omitempty"`
+		DueInDays *int               `bson:"due_in_days,omitempty" json:"due_in_days,omitempty"`
+		Subtasks  []templateTask     `bson:"subtasks,omitempty" json:"subtasks,omitempty"`
+	}
+	templateTask struct {
+		Title     string   `bson:"title" json:"title"`
+		Tags      []string `bson:"tags,omitempty" json:"tags,omitempty"`
+		DueInDays *int     `bson:"due_in_days,omitempty" json:"due_in_days,omitempty"`
+	}
+)
+
+// normalize trims the template and reports the message key for the
+// first invalid field.
+func (t *todoTemplate) normalize() string {
+	t.Name = strings.TrimSpace(t.Name)
+	t.Title = strings.TrimSpace(t.Title)
+	if t.Name == "" {
+		return "template.name_required"
+	}
+	if t.Title == "" {
+		return "template.title_required"
+	}
+	if len(t.Subtasks) > maxTemplateSubtasks {
+		return "template.too_many_subtasks"
+	}
+	t.Tags = normalizeTags(t.Tags)
+	for i := range t.Subtasks {
+		st := &t.Subtasks[i]
+		st.Title = strings.TrimSpace(st.Title)
+		if st.Title == "" {
+			return "template.title_required"
+		}
+		st.Tags = normalizeTags(st.Tags)
+	}
+	return ""
+}
+
+// maxTemplateSubtasks keeps one instantiation to a bounded write.
+const maxTemplateSubtasks = 100
+
+// instantiate is the todos t describes: the parent first, then its
+// subtasks, with due dates counted in days from now in loc.
+func (t todoTemplate) instantiate(now time.Time, loc *time.Location) []todoModel {
+	due := func(days *int) *time.Time {
+		if days == nil {
+			return nil
+		}
+		d := now.In(loc).AddDate(0, 0, *days)
+		return &d
+	}
+	parent := todoModel{
+		ID:        primitive.NewObjectID(),
+		Title:     t.Title,
+		CreatedAt: now,
+		DueDate:   due(t.DueInDays),
+		Tags:      t.Tags,
+	}
+	out := []todoModel{parent}
+	for _, st := range t.Subtasks {
+		out = append(out, todoModel{
+			ID:        primitive.NewObjectID(),
+			Title:     st.Title,
+			CreatedAt: now,
+			DueDate:   due(st.DueInDays),
+			Tags:      st.Tags,
+			ParentID:  &parent.ID,
+		})
+	}
+	return out
+}
+
+func (a *app) templateHandlers() http.Handler {
+	rg := chi.NewRouter()
+	rg.Group(func(r chi.Router) {
+		r.Get("/", a.fetchTemplates)
+		r.Post("/", a.createTemplate)
+		r.Get("/{id}", a.getTemplate)
+		r.Put("/{id}", a.updateTemplate)
+		r.Delete("/{id}", a.deleteTemplate)
+	})
+	return rg
+}
+
+func (a *app) fetchTemplates(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	templates, err := a.templates.List(ctx)
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "template.fetch_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	a.rnd.JSON(w, http.StatusOK, render.M{"data": templates})
+}
+
+func (a *app) getTemplate(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	id, ok := a.templateID(w, r)
+	if !ok {
+		return
+	}
+	t, err := a.templates.Get(ctx, id)
+	if err != nil {
+		a.fail(w, r, err, "template.fetch_failed")
+		return
+	}
+	a.rnd.JSON(w, http.StatusOK, render.M{"data": t})
+}
+
+func (a *app) createTemplate(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	t, ok := a.decodeTemplate(w, r)
+	if !ok {
+		return
+	}
+	t.ID = primitive.NewObjectID()
+	if err := a.templates.Save(ctx, t); err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "template.save_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	a.rnd.JSON(w, http.StatusCreated, render.M{"data": t})
+}
+
+func (a *app) updateTemplate(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	id, ok := a.templateID(w, r)
+	if !ok {
+		return
+	}
+	t, ok := a.decodeTemplate(w, r)
+	if !ok {
+		return
+	}
+	t.ID = id
+	if _, err := a.templates.Get(ctx, id); err != nil {
+		a.fail(w, r, err, "template.save_failed")
+		return
+	}
+	if err := a.templates.Save(ctx, t); err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "template.save_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	a.rnd.JSON(w, http.StatusOK, render.M{"data": t})
+}
+
+func (a *app) deleteTemplate(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	id, ok := a.templateID(w, r)
+	if !ok {
+		return
+	}
+	if err := a.templates.Delete(ctx, id); err != nil {
+		a.fail(w, r, err, "template.delete_failed")
+		return
+	}
+	a.rnd.JSON(w, http.StatusOK, render.M{"message": tr(r, "template.deleted")})
+}
+
+// createFromTemplate creates a template's todo and its subtasks in one
+// write.
+func (a *app) createFromTemplate(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	id, ok := a.templateID(w, r)
+	if !ok {
+		return
+	}
+	t, err := a.templates.Get(ctx, id)
+	if err != nil {
+		a.fail(w, r, err, "template.fetch_failed")
+		return
+	}
+	s, err := a.settings.Load(ctx)
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "settings.fetch_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	todos := t.instantiate(time.Now(), s.location())
+	if !a.checkTodoQuota(ctx, w, r, int64(len(todos))) {
+		return
+	}
+	if err := a.todos.CreateMany(ctx, todos); err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "todo.create_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	base := todoBase(r)
+	out := make([]todo, len(todos))
+	for i, tm := range todos {
+		out[i] = tm.toTodo()
+		out[i].Links = todoLinks(base, out[i].ID)
+	}
+	w.Header().Set("Location", base+"/"+out[0].ID)
+	a.rnd.JSON(w, http.StatusCreated, render.M{
+		"message":  tr(r, "todo.created"),
+		"data":     out[0],
+		"subtasks": out[1:],
+	})
+}
+
+// templateID parses the {id} URL parameter, answering 400 itself when
+// it isn't an ObjectID.
+func (a *app) templateID(w http.ResponseWriter, r *http.Request) (primitive.ObjectID, bool) {
+	id, err := primitive.ObjectIDFromHex(strings.TrimSpace(chi.URLParam(r, "id")))
+	if err != nil {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "template.id_invalid"),
+		})
+		return id, false
+	}
+	return id, true
+}
+
+func (a *app) decodeTemplate(w http.ResponseWriter, r *http.Request) (todoTemplate, bool) {
+	var t todoTemplate
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "request.invalid_body"),
+			"error":   err.Error(),
+		})
+		return t, false
+	}
+	if key := t.normalize(); key != "" {
+		var args []interface{}
+		if key == "template.too_many_subtasks" {
+			args = append(args, maxTemplateSubtasks)
+		}
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, key, args...),
+		})
+		return t, false
+	}
+	return t, true
+}
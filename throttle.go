@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"todo/internal/ratelimit"
+	"todo/internal/render"
+)
+
+// unlimitedTier is always defined and never throttled.
+const unlimitedTier = "unlimited"
+
+// parseRateTiers reads RATE_LIMIT_TIERS, e.g.
+// "anonymous=60/1m,free=600/1m,partner=0". Anonymous callers use the
+// anonymous tier, limited per client IP; a missing anonymous tier means
+// they aren't limited.
+func parseRateTiers(v string) (map[string]ratelimit.Limit, error) {
+	tiers := map[string]ratelimit.Limit{unlimitedTier: {}}
+	for _, entry := range strings.Split(v, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, spec, ok := strings.Cut(entry, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("RATE_LIMIT_TIERS entries must be name=<requests>/<duration>")
+		}
+		lim, err := ratelimit.ParseLimit(spec)
+		if err != nil {
+			return nil, fmt.Errorf("RATE_LIMIT_TIERS: %w", err)
+		}
+		tiers[name] = lim
+	}
+	return tiers, nil
+}
+
+// throttle applies the caller's tier: per key for API keys, per client IP
+// for anonymous callers. Every response gets X-RateLimit-* headers,
+// "unlimited" ones without a reset for callers whose tier has no limit,
+// and limited tiers get a 429 once the window is used up.
+func (a *app) throttle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := identityFrom(r.Context())
+		lim := a.cfg.RateTiers[id.Tier]
+		if lim.Unlimited() {
+			w.Header().Set("X-RateLimit-Limit", "unlimited")
+			w.Header().Set("X-RateLimit-Remaining", "unlimited")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		bucket := "key:" + id.KeyName
+		if id.KeyName == "" {
+			bucket = "ip:" + clientHost(r)
+		}
+		res := a.limiter.Allow(bucket, lim)
+
+		h := w.Header()
+		h.Set("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+		h.Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		h.Set("X-RateLimit-Reset", strconv.FormatInt(res.Reset.Unix(), 10))
+		if !res.Allowed {
+			retry := int(time.Until(res.Reset).Round(time.Second) / time.Second)
+			retry = max(retry, 1)
+			h.Set("Retry-After", strconv.Itoa(retry))
+			a.rnd.JSON(w, http.StatusTooManyRequests, render.M{
+				"message": tr(r, "rate.limited", retry),
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientHost is the caller's IP, from RemoteAddr.
+func clientHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
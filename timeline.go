@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"todo/internal/render"
+)
+
+// timelineTask is one bar of a Gantt chart. Start is the todo's start
+// date, or its due date when it has none, so every bar has both ends.
+type timelineTask struct {
+	ID           string    `json:"id"`
+	Title        string    `json:"title"`
+	Completed    bool      `json:"completed"`
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+	Dependencies []string  `json:"dependencies"`
+	Critical     bool      `json:"critical"`
+	Links        links     `json:"_links"`
+}
+
+// timeline serves every todo with a due date as a Gantt task, with its
+// blockers as dependencies and the critical path marked.
+func (a *app) timeline(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	todos, err := a.todos.List(ctx, listQuery{Scheduled: true, Sort: []sortKey{{Field: "due_date"}}})
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "todo.fetch_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	path := criticalPath(todos)
+	critical := map[primitive.ObjectID]bool{}
+	for _, id := range path {
+		critical[id] = true
+	}
+	scheduled := map[primitive.ObjectID]bool{}
+	for _, t := range todos {
+		scheduled[t.ID] = true
+	}
+
+	base := siblingTodoBase(r, "timeline")
+	tasks := make([]timelineTask, len(todos))
+	for i, t := range todos {
+		task := timelineTask{
+			ID:           t.ID.Hex(),
+			Title:        t.Title,
+			Completed:    t.Completed,
+			Start:        *t.DueDate,
+			End:          *t.DueDate,
+			Dependencies: []string{},
+			Critical:     critical[t.ID],
+			Links:        todoLinks(base, t.ID.Hex()),
+		}
+		if t.StartDate != nil {
+			task.Start = *t.StartDate
+		}
+		// A blocker without a due date has no bar to point at.
+		for _, b := range t.BlockedBy {
+			if scheduled[b] {
+				task.Dependencies = append(task.Dependencies, b.Hex())
+			}
+		}
+		tasks[i] = task
+	}
+	ids := make([]string, len(path))
+	for i, id := range path {
+		ids[i] = id.Hex()
+	}
+
+	a.rnd.JSON(w, http.StatusOK, render.M{
+		"data": render.M{"tasks": tasks, "critical_path": ids},
+	})
+}
+
+// criticalPath is the chain of dependent todos with the greatest total
+// duration, first to last. A todo lasts from its start to its due date;
+// one without a start takes no time. Blockers outside todos are ignored.
+func criticalPath(todos []todoModel) []primitive.ObjectID {
+	index := map[primitive.ObjectID]int{}
+	for i, t := range todos {
+		index[t.ID] = i
+	}
+	// Count each todo's known blockers and who waits on whom.
+	waiting := make([]int, len(todos))
+	unblocks := make([][]int, len(todos))
+	for i, t := range todos {
+		for _, b := range t.BlockedBy {
+			if j, ok := index[b]; ok {
+				waiting[i]++
+				unblocks[j] = append(unblocks[j], i)
+			}
+		}
+	}
+
+	// Longest path in topological order. Dependencies can't form a
+	// cycle, but anything caught in one would simply never be reached.
+	finish := make([]time.Duration, len(todos))
+	prev := make([]int, len(todos))
+	var ready []int
+	for i := range todos {
+		prev[i] = -1
+		if waiting[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+	end := -1
+	for len(ready) > 0 {
+		i := ready[0]
+		ready = ready[1:]
+		if t := todos[i]; t.StartDate != nil {
+			finish[i] += t.DueDate.Sub(*t.StartDate)
+		}
+		if end < 0 || finish[i] > finish[end] {
+			end = i
+		}
+		for _, j := range unblocks[i] {
+			if prev[j] < 0 || finish[i] > finish[j] {
+				finish[j], prev[j] = finish[i], i
+			}
+			if waiting[j]--; waiting[j] == 0 {
+				ready = append(ready, j)
+			}
+		}
+	}
+
+	var path []primitive.ObjectID
+	for i := end; i >= 0; i = prev[i] {
+		path = append([]primitive.ObjectID{todos[i].ID}, path...)
+	}
+	return path
+}
@@ -0,0 +1,638 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"todo/internal/i18n"
+	"todo/internal/render"
+)
+
+type (
+	todoModel struct {
+		ID    primitive.ObjectID `bson:"_id,omitempty"`
+		Title string             `bson:"title"`
+		// TitleKey matches near-identical titles, encrypted or not. See
+		// titleKey.
+		TitleKey  string    `bson:"title_key,omitempty"`
+		Completed bool      `bson:"completed"`
+		CreatedAt time.Time `bson:"created_at"`
+		// CompletedAt is when the todo was last completed, and unset
+		// while it is open.
+		CompletedAt *time.Time `bson:"completed_at,omitempty"`
+		// UpdatedAt is bumped by every write to the todo itself, which
+		// is what the change feed pages through.
+		UpdatedAt time.Time  `bson:"updated_at,omitempty"`
+		StartDate *time.Time `bson:"start_date,omitempty"`
+		DueDate   *time.Time `bson:"due_date,omitempty"`
+		// ColumnID and Position place the todo on the board.
+		ColumnID *primitive.ObjectID `bson:"column_id,omitempty"`
+		Position int                 `bson:"position,omitempty"`
+		// BlockedBy are the todos that must be completed first.
+		BlockedBy []primitive.ObjectID `bson:"blocked_by,omitempty"`
+		// Related are the links made from this todo to others.
+		Related []todoRelation `bson:"related,omitempty"`
+		Tags    []string       `bson:"tags,omitempty"`
+		// Priority is an index into priorityNames, so it sorts.
+		Priority int `bson:"priority,omitempty"`
+		// ParentID makes the todo a subtask. It is fixed at creation,
+		// and cleared if the parent is deleted.
+		ParentID *primitive.ObjectID `bson:"parent_id,omitempty"`
+		// Custom holds values for the defined custom fields, by key.
+		Custom map[string]interface{} `bson:"custom,omitempty"`
+		// Location is where the todo is done, under a 2dsphere index.
+		Location      *geoPoint `bson:"location,omitempty"`
+		LocationLabel string    `bson:"location_label,omitempty"`
+		// Notes are dated remarks on the todo, kept in the order given.
+		Notes []todoNote `bson:"notes,omitempty"`
+	}
+	todoNote struct {
+		At   time.Time `bson:"at" json:"at" xml:"at,attr"`
+		Text string    `bson:"text" json:"text" xml:",chardata"`
+	}
+	todo struct {
+		ID        string     `json:"id" xml:"id,attr"`
+		Title     string     `json:"title" xml:"title"`
+		Completed bool       `json:"completed" xml:"completed"`
+		CreatedAt time.Time  `json:"created_at" xml:"created_at"`
+		UpdatedAt *time.Time `json:"updated_at,omitempty" xml:"updated_at,omitempty"`
+		// CompletedAt is output only; completing a todo sets it.
+		CompletedAt *time.Time `json:"completed_at,omitempty" xml:"completed_at,omitempty"`
+		StartDate   *time.Time `json:"start_date,omitempty" xml:"start_date,omitempty"`
+		DueDate     *time.Time `json:"due_date,omitempty" xml:"due_date,omitempty"`
+		ColumnID    string     `json:"column_id,omitempty" xml:"column_id,omitempty"`
+		Position    *int       `json:"position,omitempty" xml:"position,omitempty"`
+		BlockedBy   []string   `json:"blocked_by,omitempty" xml:"blocked_by>id,omitempty"`
+		Tags        []string   `json:"tags,omitempty" xml:"tags>tag,omitempty"`
+		Priority    string     `json:"priority,omitempty" xml:"priority,omitempty"`
+		ParentID    string     `json:"parent_id,omitempty" xml:"parent_id,omitempty"`
+		// Custom has no XML form; XML clients don't see custom fields.
+		Custom   map[string]interface{} `json:"custom,omitempty" xml:"-"`
+		Location *todoLocation          `json:"location,omitempty" xml:"-"`
+		// Notes are output only; imports bring them in.
+		Notes []todoNote `json:"notes,omitempty" xml:"notes>note,omitempty"`
+		Links links      `json:"_links,omitempty" xml:"-"`
+	}
+	// todoInput is a todo as clients write it. Text, when set on
+	// create, is quick-add syntax to parse instead of a title.
+	todoInput struct {
+		todo
+		Text string `json:"text"`
+	}
+	// todoList is the XML document for a list; JSON and MessagePack
+	// wrap the items in {"data": [...]} instead.
+	todoList struct {
+		XMLName xml.Name `xml:"todos"`
+		Todos   []todo   `xml:"todo"`
+	}
+)
+
+func (t todoModel) toTodo() todo {
+	out := todo{
+		ID:          t.ID.Hex(),
+		Title:       t.Title,
+		Completed:   t.Completed,
+		CreatedAt:   t.CreatedAt,
+		StartDate:   t.StartDate,
+		DueDate:     t.DueDate,
+		Tags:        t.Tags,
+		Priority:    priorityName(t.Priority),
+		CompletedAt: t.CompletedAt,
+		Notes:       t.Notes,
+	}
+	if !t.UpdatedAt.IsZero() {
+		out.UpdatedAt = &t.UpdatedAt
+	}
+	if t.ColumnID != nil {
+		out.ColumnID = t.ColumnID.Hex()
+		out.Position = &t.Position
+	}
+	for _, id := range t.BlockedBy {
+		out.BlockedBy = append(out.BlockedBy, id.Hex())
+	}
+	if t.ParentID != nil {
+		out.ParentID = t.ParentID.Hex()
+	}
+	if t.Location != nil {
+		out.Location = &todoLocation{geoPoint: *t.Location, Label: t.LocationLabel}
+	}
+	if len(t.Custom) > 0 {
+		out.Custom = make(map[string]interface{}, len(t.Custom))
+		for k, v := range t.Custom {
+			out.Custom[k] = customValue(v)
+		}
+	}
+	return out
+}
+
+func (a *app) fetchTodos(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	p, ok, err := a.parsePage(ctx, r)
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "settings.fetch_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	if !ok {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "request.page_invalid", a.cfg.MaxPageSize),
+		})
+		return
+	}
+
+	fields, ok := parseFields(r)
+	if !ok {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "request.fields_invalid", strings.Join(fieldNames(), ", ")),
+		})
+		return
+	}
+
+	sort, ok := a.parseSort(w, r)
+	if !ok {
+		return
+	}
+
+	q := p.query()
+	q.Fields = storedFields(fields)
+	q.Sort = sort
+	q.Actionable = r.URL.Query().Get("actionable") == "true"
+	if tags := normalizeTags([]string{r.URL.Query().Get("tag")}); tags != nil {
+		q.Tag = tags[0]
+	}
+	if q.Custom, ok = a.parseCustomFilter(ctx, w, r); !ok {
+		return
+	}
+	if contentType := streamedList(r, p, fields); contentType != "" {
+		a.streamList(ctx, w, r, q, p, fields, contentType)
+		return
+	}
+	if p.Size == 0 {
+		// Only the streamed formats may hold everything; the others
+		// would buffer it, so stop just past the cap.
+		q.Limit = int64(a.cfg.MaxPageSize) + 1
+	}
+	var total int64
+	todos, err := a.todos.List(ctx, q)
+	if err == nil && p.Size == 0 {
+		total = int64(len(todos))
+	} else if err == nil {
+		total, err = a.todos.Count(ctx, q)
+	}
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{ // Changed from StatusProcessing
+			"message": tr(r, "todo.fetch_failed"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	if p.Size == 0 && total > int64(a.cfg.MaxPageSize) {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "request.too_many", a.cfg.MaxPageSize),
+		})
+		return
+	}
+
+	base := todoBase(r)
+	out := make([]todo, len(todos))
+	data := make([]interface{}, len(todos))
+	for i, t := range todos {
+		out[i] = t.toTodo()
+		out[i].Links = todoLinks(base, out[i].ID)
+		data[i] = out[i].sparse(fields)
+	}
+	body := render.M{"data": data, "_links": listLinks(r, p, total)}
+	if p.Size > 0 {
+		body["meta"] = render.M{"page": p.Number, "per_page": p.Size, "total": total}
+	}
+	rep := representation{
+		JSON:    body,
+		JSONAPI: todoJSONAPI(r, out, p, total, fields),
+	}
+	if fields == nil {
+		// XML has no partial form of a todo.
+		rep.XML = todoList{Todos: out}
+	}
+	a.respond(w, r, http.StatusOK, rep)
+}
+
+func (a *app) createTodo(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	var in todoInput
+	if err := decodeTodo(r, &in); err != nil {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{ // Changed from StatusProcessing
+			"message": tr(r, "request.invalid_body"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	tm, duplicate, ok := a.addTodo(ctx, w, r, in)
+	if !ok {
+		return
+	}
+
+	if isHTMX(r) {
+		a.rnd.Fragment(w, http.StatusCreated, pageTemplates, "todo-item", newTodoItem(i18n.FromContext(r.Context()), tm))
+		return
+	}
+
+	base := todoBase(r)
+	w.Header().Set("Location", base+"/"+tm.ID.Hex())
+	body := render.M{
+		"message": tr(r, "todo.created"),
+		"todo_id": tm.ID.Hex(),
+		"data":    tm.toTodo(),
+		"_links":  todoLinks(base, tm.ID.Hex()),
+	}
+	if duplicate != nil {
+		body["warning"] = render.M{"message": tr(r, "todo.duplicate_exists"), "duplicate_of": duplicate}
+	}
+	a.rnd.JSON(w, http.StatusCreated, body)
+}
+
+// addTodo validates in and creates the todo it describes, answering
+// itself when that fails. It also returns an open todo with the same
+// title, if duplicate detection is on and found one.
+func (a *app) addTodo(ctx context.Context, w http.ResponseWriter, r *http.Request, in todoInput) (todoModel, *todo, bool) {
+	t := in.todo
+	if in.Text != "" {
+		s, err := a.settings.Load(ctx)
+		if err != nil {
+			a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+				"message": tr(r, "settings.fetch_failed"),
+				"error":   err.Error(),
+			})
+			return todoModel{}, nil, false
+		}
+		// Fields sent alongside the text win over what it says.
+		q := parseQuickAdd(in.Text, time.Now(), s.location())
+		t.Title = q.Title
+		t.Tags = append(t.Tags, q.Tags...)
+		if t.DueDate == nil {
+			t.DueDate = q.DueDate
+		}
+		if t.Priority == "" {
+			t.Priority = q.Priority
+		}
+	}
+	if t.Title == "" {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "todo.title_required"),
+		})
+		return todoModel{}, nil, false
+	}
+
+	if !a.checkTodo(w, r, t) {
+		return todoModel{}, nil, false
+	}
+	custom, ok := a.customValues(ctx, w, r, t.Custom)
+	if !ok {
+		return todoModel{}, nil, false
+	}
+	location, label := t.Location.stored()
+
+	parent, ok := a.parentID(ctx, w, r, t.ParentID)
+	if !ok {
+		return todoModel{}, nil, false
+	}
+
+	var duplicate *todo
+	if a.cfg.DetectDuplicates {
+		if duplicate, ok = a.checkDuplicate(ctx, w, r, t.Title); !ok {
+			return todoModel{}, nil, false
+		}
+	}
+
+	if !a.checkTodoQuota(ctx, w, r, 1) {
+		return todoModel{}, nil, false
+	}
+
+	tm := todoModel{
+		ID:        primitive.NewObjectID(),
+		Title:     t.Title,
+		Completed: false,
+		CreatedAt: time.Now(),
+		StartDate: t.StartDate,
+		DueDate:   t.DueDate,
+		Tags:      normalizeTags(t.Tags),
+		Priority:  priorityLevel(t.Priority),
+		ParentID:  parent,
+		Custom:    custom,
+
+		Location:      location,
+		LocationLabel: label,
+	}
+
+	if err := a.todos.Create(ctx, tm); err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{ // Changed from StatusProcessing
+			"message": tr(r, "todo.create_failed"),
+			"error":   err.Error(),
+		})
+		return todoModel{}, nil, false
+	}
+	return tm, duplicate, true
+}
+
+func (a *app) updateTodo(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+	if !primitive.IsValidObjectID(id) {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "todo.id_invalid"),
+		})
+		return
+	}
+
+	var in todoInput
+	if err := decodeTodo(r, &in); err != nil {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{ // Changed from StatusProcessing
+			"message": tr(r, "request.invalid_body"),
+			"error":   err.Error(),
+		})
+		return
+	}
+	t := in.todo
+
+	if t.Title == "" {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "todo.title_field_required"),
+		})
+		return
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "todo.id_format_invalid"),
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	tm, ok := a.updatedTodo(ctx, w, r, objectID, t)
+	if !ok {
+		return
+	}
+	if err := a.service.Update(ctx, tm, forced(r), ifMatch(r)); err != nil {
+		a.fail(w, r, err, "todo.update_failed")
+		return
+	}
+
+	if isHTMX(r) {
+		a.rnd.Fragment(w, http.StatusOK, pageTemplates, "todo-item", newTodoItem(i18n.FromContext(r.Context()), tm))
+		return
+	}
+
+	a.rnd.JSON(w, http.StatusOK, render.M{
+		"message": tr(r, "todo.updated"),
+		"_links":  todoLinks(todoBase(r), id),
+	})
+}
+
+// updatedTodo is what updateTodo stores for id. A JSON body replaces the
+// todo; the web UI's form carries only the title and checkbox, so those
+// go over the stored todo and everything else is kept.
+func (a *app) updatedTodo(ctx context.Context, w http.ResponseWriter, r *http.Request, id primitive.ObjectID, t todo) (todoModel, bool) {
+	if isForm(r) {
+		current, err := a.todos.Get(ctx, id)
+		if err != nil {
+			a.fail(w, r, err, "todo.update_failed")
+			return todoModel{}, false
+		}
+		current.Title, current.Completed = t.Title, t.Completed
+		return current, true
+	}
+	if !a.checkTodo(w, r, t) {
+		return todoModel{}, false
+	}
+	custom, ok := a.customValues(ctx, w, r, t.Custom)
+	if !ok {
+		return todoModel{}, false
+	}
+	location, label := t.Location.stored()
+	return todoModel{
+		ID:        id,
+		Title:     t.Title,
+		Completed: t.Completed,
+		StartDate: t.StartDate,
+		DueDate:   t.DueDate,
+		Tags:      normalizeTags(t.Tags),
+		Priority:  priorityLevel(t.Priority),
+		Custom:    custom,
+
+		Location:      location,
+		LocationLabel: label,
+	}, true
+}
+
+func (a *app) deleteTodo(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	id := strings.TrimSpace(chi.URLParam(r, "id"))
+	if !primitive.IsValidObjectID(id) {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "todo.id_invalid"),
+		})
+		return
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "todo.id_format_invalid"),
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if err := a.todos.Delete(ctx, objectID, ifMatch(r)); err != nil {
+		a.fail(w, r, err, "todo.delete_failed")
+		return
+	}
+
+	if isHTMX(r) {
+		// An empty 200 lets HTMX swap the item out of the list.
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	a.rnd.JSON(w, http.StatusOK, render.M{
+		"message": tr(r, "todo.deleted"),
+		"_links":  links{"list": {Href: todoBase(r) + "/"}},
+	})
+}
+
+// normalizeTags lowercases and trims tags, dropping empty and repeated
+// ones, so #Work and "work " are the same tag.
+func normalizeTags(tags []string) []string {
+	var out []string
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(tag), "#")))
+		if tag != "" && !slices.Contains(out, tag) {
+			out = append(out, tag)
+		}
+	}
+	return out
+}
+
+// parentID resolves a subtask's parent, answering 422 itself when it
+// names no todo. An empty id is a top-level todo.
+func (a *app) parentID(ctx context.Context, w http.ResponseWriter, r *http.Request, id string) (*primitive.ObjectID, bool) {
+	if id == "" {
+		return nil, true
+	}
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err == nil {
+		_, err = a.todos.Get(ctx, oid)
+	}
+	switch {
+	case errors.Is(err, primitive.ErrInvalidHex), errors.Is(err, errTodoNotFound):
+		a.rnd.JSON(w, http.StatusUnprocessableEntity, render.M{
+			"message": tr(r, "todo.parent_not_found"),
+		})
+		return nil, false
+	case err != nil:
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "todo.create_failed"),
+			"error":   err.Error(),
+		})
+		return nil, false
+	}
+	return &oid, true
+}
+
+// priorityNames are the priorities from none up; a todo stores the
+// index so sorting on it orders by urgency.
+var priorityNames = []string{"", "low", "medium", "high"}
+
+// priorityLevel is name's index in priorityNames, or -1 for none.
+func priorityLevel(name string) int {
+	return slices.Index(priorityNames, name)
+}
+
+func priorityName(level int) string {
+	if level < 0 || level >= len(priorityNames) {
+		return ""
+	}
+	return priorityNames[level]
+}
+
+// checkTodo answers 400 and returns false when t starts after it is due
+// or names an unknown priority.
+func (a *app) checkTodo(w http.ResponseWriter, r *http.Request, t todo) bool {
+	if t.StartDate != nil && t.DueDate != nil && t.StartDate.After(*t.DueDate) {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "todo.start_after_due"),
+		})
+		return false
+	}
+	if priorityLevel(t.Priority) < 0 {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "todo.priority_invalid", strings.Join(priorityNames[1:], ", ")),
+		})
+		return false
+	}
+	return a.checkLocation(w, r, t.Location)
+}
+
+// todoID parses the {id} URL parameter, answering 400 itself when it
+// isn't an ObjectID.
+func (a *app) todoID(w http.ResponseWriter, r *http.Request) (primitive.ObjectID, bool) {
+	id, err := primitive.ObjectIDFromHex(strings.TrimSpace(chi.URLParam(r, "id")))
+	if err != nil {
+		a.rnd.JSON(w, http.StatusBadRequest, render.M{
+			"message": tr(r, "todo.id_invalid"),
+		})
+		return id, false
+	}
+	return id, true
+}
+
+func (a *app) getTodo(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	id, ok := a.todoID(w, r)
+	if !ok {
+		return
+	}
+	tm, err := a.todos.Get(ctx, id)
+	if err != nil {
+		a.fail(w, r, err, "todo.fetch_failed")
+		return
+	}
+
+	// Clients may keep the todo but must check it is current, which
+	// costs them a 304 when it is.
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if notModified(w, r, todoETag(tm), tm.UpdatedAt) {
+		return
+	}
+	t := tm.toTodo()
+	t.Links = todoLinks(todoBase(r), t.ID)
+	a.respond(w, r, http.StatusOK, representation{JSON: render.M{"data": t}, XML: t})
+}
+
+func (a *app) completeTodo(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	id, ok := a.todoID(w, r)
+	if !ok {
+		return
+	}
+	if err := a.service.Complete(ctx, id, forced(r)); err != nil {
+		a.fail(w, r, err, "todo.update_failed")
+		return
+	}
+
+	a.rnd.JSON(w, http.StatusOK, render.M{
+		"message": tr(r, "todo.completed"),
+		"_links":  todoLinks(todoBase(r), id.Hex()),
+	})
+}
+
+func (a *app) todoHandlers() http.Handler {
+	rg := chi.NewRouter()
+	rg.Group(func(r chi.Router) {
+		r.Get("/", a.fetchTodos)
+		r.Post("/", a.createTodo)
+		r.Get("/counts", a.countTodos)
+		r.Get("/export", a.exportTodos)
+		r.Post("/export/jobs", a.queueExport)
+		r.Post("/import", a.importTodos)
+		r.Post("/import/jobs", a.queueImport)
+		r.Get("/search", a.searchTodos)
+		r.Get("/poll", a.pollTodos)
+		r.Get("/nearby", a.nearbyTodos)
+		r.Post("/from-template/{id}", a.createFromTemplate)
+		r.Get("/{id}", a.getTodo)
+		r.Put("/{id}", a.updateTodo)
+		r.Post("/{id}/complete", a.completeTodo)
+		r.Post("/{id}/move", a.moveTodo)
+		r.Post("/{id}/blocked_by", a.addBlocker)
+		r.Delete("/{id}/blocked_by/{blocker}", a.removeBlocker)
+		r.Get("/{id}/links", a.fetchRelated)
+		r.Post("/{id}/links", a.relateTodo)
+		r.Delete("/{id}/links/{type}/{target}", a.unrelateTodo)
+		r.Delete("/{id}", a.deleteTodo)
+	})
+	return rg
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fakeTodos keeps todos in memory for handler tests. Methods it doesn't
+// override panic on the nil todoRepository it embeds.
+type fakeTodos struct {
+	todoRepository
+	m map[primitive.ObjectID]todoModel
+}
+
+func (f *fakeTodos) Get(ctx context.Context, id primitive.ObjectID) (todoModel, error) {
+	t, ok := f.m[id]
+	if !ok {
+		return todoModel{}, errTodoNotFound
+	}
+	return t, nil
+}
+
+// Update sets what mongoTodoRepository.Update does.
+func (f *fakeTodos) Update(ctx context.Context, t todoModel, match revisions) error {
+	cur, ok := f.m[t.ID]
+	if !ok {
+		return errTodoNotFound
+	}
+	cur.Title, cur.Completed = t.Title, t.Completed
+	cur.StartDate, cur.DueDate = t.StartDate, t.DueDate
+	cur.Tags, cur.Priority, cur.Custom = t.Tags, t.Priority, t.Custom
+	cur.Location, cur.LocationLabel = t.Location, t.LocationLabel
+	f.m[t.ID] = cur
+	return nil
+}
+
+func (f *fakeTodos) OpenBlockers(ctx context.Context, id primitive.ObjectID) ([]primitive.ObjectID, error) {
+	return []primitive.ObjectID{}, nil
+}
+
+func (f *fakeTodos) List(ctx context.Context, q listQuery) ([]todoModel, error) {
+	return []todoModel{}, nil
+}
+
+type okHealth struct{}
+
+func (okHealth) Ready() bool                { return true }
+func (okHealth) Ping(context.Context) error { return nil }
+
+func TestUpdateTodoFormKeepsOtherFields(t *testing.T) {
+	due := time.Date(2026, 3, 1, 17, 0, 0, 0, time.UTC)
+	id := primitive.NewObjectID()
+	todos := &fakeTodos{m: map[primitive.ObjectID]todoModel{
+		id: {ID: id, Title: "Pay rent", DueDate: &due, Tags: []string{"finance"}, Priority: priorityLevel("high")},
+	}}
+	a, err := newApp(config{}, todos, nil, nil, nil, nil, nil, okHealth{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// What the web UI's checkbox sends.
+	form := url.Values{"title": {"Pay rent"}, "completed": {"true"}}
+	req := httptest.NewRequest(http.MethodPut, "/todo/"+id.Hex(), strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("HX-Request", "true")
+	tok := a.newCSRFToken()
+	req.AddCookie(&http.Cookie{Name: csrfCookie, Value: tok})
+	req.Header.Set(csrfHeader, tok)
+	w := httptest.NewRecorder()
+	a.routes().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+
+	got := todos.m[id]
+	if !got.Completed {
+		t.Error("todo not completed")
+	}
+	if got.DueDate == nil || !got.DueDate.Equal(due) {
+		t.Errorf("due date = %v, want %v", got.DueDate, due)
+	}
+	if !slices.Equal(got.Tags, []string{"finance"}) {
+		t.Errorf("tags = %q, want [finance]", got.Tags)
+	}
+	if got.Priority != priorityLevel("high") {
+		t.Errorf("priority = %d, want high", got.Priority)
+	}
+}
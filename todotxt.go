@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// todo.txt (http://todotxt.org) has letters for priorities. Ours map to
+// the first three; anything below C reads as low.
+var todoTxtPriorities = map[int]string{3: "A", 2: "B", 1: "C"}
+
+// writeTodoTxt writes one todo.txt line per todo, dates in loc. Tags go out as
+// +projects, except those kept from an @context; start and due dates
+// become the t: and due: extensions, and a completed todo's priority pri:.
+func writeTodoTxt(todos []todoModel, loc *time.Location) []byte {
+	var buf bytes.Buffer
+	for _, t := range todos {
+		buf.WriteString(todoTxtLine(t, loc))
+	}
+	return buf.Bytes()
+}
+
+// todoTxtLine is t's line of writeTodoTxt, newline included.
+func todoTxtLine(t todoModel, loc *time.Location) string {
+	date := func(t time.Time) string { return t.In(loc).Format(time.DateOnly) }
+	var words []string
+	pri := todoTxtPriorities[t.Priority]
+	if t.Completed {
+		words = append(words, "x")
+		if t.CompletedAt != nil {
+			words = append(words, date(*t.CompletedAt))
+		}
+	} else if pri != "" {
+		words = append(words, "("+pri+")")
+	}
+	// todo.txt reads a completed todo's only date as when it was done, so
+	// one done at an unknown time goes without its creation date.
+	if !t.Completed || t.CompletedAt != nil {
+		words = append(words, date(t.CreatedAt))
+	}
+	words = append(words, strings.Fields(t.Title)...)
+	for _, tag := range t.Tags {
+		tag = strings.Join(strings.Fields(tag), "_")
+		if !strings.HasPrefix(tag, "@") {
+			tag = "+" + tag
+		}
+		words = append(words, tag)
+	}
+	if t.StartDate != nil {
+		words = append(words, "t:"+date(*t.StartDate))
+	}
+	if t.DueDate != nil {
+		words = append(words, "due:"+date(*t.DueDate))
+	}
+	if t.Completed && pri != "" {
+		words = append(words, "pri:"+pri)
+	}
+	return strings.Join(words, " ") + "\n"
+}
+
+// parseTodoTxt reads todo.txt lines back into todos, the reverse of
+// writeTodoTxt: +projects become tags, @contexts tags that keep their @,
+// and dates are midnight in loc. Todos without a creation date were
+// created now. Extensions other than t:, due: and pri: stay in the title.
+func parseTodoTxt(data []byte, loc *time.Location, now time.Time) ([]todoModel, error) {
+	var out []todoModel
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(nil, maxImportBytes)
+	for n := 1; sc.Scan(); n++ {
+		words := strings.Fields(sc.Text())
+		if len(words) == 0 {
+			continue
+		}
+		t := todoModel{ID: primitive.NewObjectID(), CreatedAt: now}
+		date := func() (time.Time, bool) {
+			if len(words) == 0 {
+				return time.Time{}, false
+			}
+			d, err := time.ParseInLocation(time.DateOnly, words[0], loc)
+			if err == nil {
+				words = words[1:]
+			}
+			return d, err == nil
+		}
+		if words[0] == "x" {
+			t.Completed = true
+			words = words[1:]
+			if done, ok := date(); ok {
+				t.CompletedAt = &done
+			}
+		} else if w := words[0]; len(w) == 3 && w[0] == '(' && w[1] >= 'A' && w[1] <= 'Z' && w[2] == ')' {
+			t.Priority = todoTxtPriority(w[1:2])
+			words = words[1:]
+		}
+		if created, ok := date(); ok {
+			t.CreatedAt = created
+		}
+
+		var title, tags []string
+		for _, w := range words {
+			key, value, _ := strings.Cut(w, ":")
+			d, err := time.ParseInLocation(time.DateOnly, value, loc)
+			switch {
+			case len(w) > 1 && w[0] == '+':
+				tags = append(tags, w[1:])
+			case len(w) > 1 && w[0] == '@':
+				tags = append(tags, w)
+			case key == "due" && err == nil:
+				t.DueDate = &d
+			case key == "t" && err == nil:
+				t.StartDate = &d
+			case key == "pri" && len(value) == 1 && value[0] >= 'A' && value[0] <= 'Z':
+				t.Priority = todoTxtPriority(value)
+			default:
+				title = append(title, w)
+			}
+		}
+		if len(title) == 0 {
+			return nil, fmt.Errorf("line %d: no description", n)
+		}
+		t.Title = strings.Join(title, " ")
+		t.Tags = normalizeTags(tags)
+		out = append(out, t)
+	}
+	return out, sc.Err()
+}
+
+func todoTxtPriority(letter string) int {
+	for level, l := range todoTxtPriorities {
+		if l == letter {
+			return level
+		}
+	}
+	return priorityLevel("low")
+}
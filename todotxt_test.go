@@ -0,0 +1,120 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTodoTxtRoundTrip(t *testing.T) {
+	loc := time.FixedZone("", -5*3600)
+	day := func(d int) *time.Time {
+		v := time.Date(2026, 3, d, 0, 0, 0, 0, loc)
+		return &v
+	}
+	todos := []todoModel{
+		{Title: "Call mom", CreatedAt: *day(1)},
+		{Title: "File taxes", CreatedAt: *day(2), Priority: priorityLevel("high"), Tags: []string{"finance", "@home"}, StartDate: day(3), DueDate: day(15)},
+		{Title: "Water plants", CreatedAt: *day(2), Priority: priorityLevel("medium"), Completed: true, CompletedAt: day(4)},
+		{Title: "Read", CreatedAt: *day(5), Priority: priorityLevel("low"), Completed: true, CompletedAt: day(6)},
+	}
+	data := writeTodoTxt(todos, loc)
+	got, err := parseTodoTxt(data, loc, time.Now())
+	if err != nil {
+		t.Fatalf("parseTodoTxt(%q): %v", data, err)
+	}
+	if len(got) != len(todos) {
+		t.Fatalf("parsed %d todos from %q, want %d", len(got), data, len(todos))
+	}
+	for i, want := range todos {
+		g := got[i]
+		if g.Title != want.Title || g.Completed != want.Completed || g.Priority != want.Priority ||
+			!g.CreatedAt.Equal(want.CreatedAt) || !slices.Equal(g.Tags, want.Tags) ||
+			!sameTime(g.CompletedAt, want.CompletedAt) || !sameTime(g.StartDate, want.StartDate) || !sameTime(g.DueDate, want.DueDate) {
+			t.Errorf("todo %d came back as %+v, want %+v", i, g, want)
+		}
+	}
+}
+
+func TestWriteTodoTxt(t *testing.T) {
+	created := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	done := created.AddDate(0, 0, 4)
+	tests := []struct {
+		todo todoModel
+		want string
+	}{
+		{todoModel{Title: "Call  mom", CreatedAt: created}, "2026-03-01 Call mom\n"},
+		{todoModel{Title: "Pay", CreatedAt: created, Priority: priorityLevel("high"), Tags: []string{"side project", "@home"}}, "(A) 2026-03-01 Pay +side_project @home\n"},
+		{todoModel{Title: "Ship", CreatedAt: created, Completed: true, CompletedAt: &done, Priority: priorityLevel("medium")}, "x 2026-03-05 2026-03-01 Ship pri:B\n"},
+		// With no completion date the creation date would be read as one.
+		{todoModel{Title: "Read", CreatedAt: created, Completed: true}, "x Read\n"},
+	}
+	for _, tt := range tests {
+		if got := string(writeTodoTxt([]todoModel{tt.todo}, time.UTC)); got != tt.want {
+			t.Errorf("writeTodoTxt(%q) = %q, want %q", tt.todo.Title, got, tt.want)
+		}
+	}
+}
+
+func TestParseTodoTxt(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	date := func(s string) time.Time {
+		v, err := time.Parse(time.DateOnly, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	tests := []struct {
+		line     string
+		title    string
+		priority string
+		tags     []string
+		created  time.Time
+		done     bool
+		due      string
+	}{
+		{"Call mom", "Call mom", "", nil, now, false, ""},
+		{"(A) 2026-03-01 Pay rent +Finance", "Pay rent", "high", []string{"finance"}, date("2026-03-01"), false, ""},
+		{"(B) Fix bike @garage due:2026-03-20", "Fix bike", "medium", []string{"@garage"}, now, false, "2026-03-20"},
+		{"(D) Someday", "Someday", "low", nil, now, false, ""},
+		{"x 2026-03-05 2026-03-01 Ship it pri:A", "Ship it", "high", nil, date("2026-03-01"), true, ""},
+		{"Meet rec:1w due:soon", "Meet rec:1w due:soon", "", nil, now, false, ""},
+		{"(a) lowercase is a title", "(a) lowercase is a title", "", nil, now, false, ""},
+	}
+	for _, tt := range tests {
+		got, err := parseTodoTxt([]byte(tt.line+"\n"), time.UTC, now)
+		if err != nil || len(got) != 1 {
+			t.Errorf("parseTodoTxt(%q) = %v, %v", tt.line, got, err)
+			continue
+		}
+		g := got[0]
+		if g.Title != tt.title || priorityName(g.Priority) != tt.priority || !slices.Equal(g.Tags, tt.tags) ||
+			!g.CreatedAt.Equal(tt.created) || g.Completed != tt.done {
+			t.Errorf("parseTodoTxt(%q) = %q %q %q %v %v", tt.line, g.Title, priorityName(g.Priority), g.Tags, g.CreatedAt, g.Completed)
+		}
+		var due *time.Time
+		if tt.due != "" {
+			d := date(tt.due)
+			due = &d
+		}
+		if !sameTime(g.DueDate, due) {
+			t.Errorf("parseTodoTxt(%q) due = %v, want %v", tt.line, g.DueDate, due)
+		}
+	}
+}
+
+func TestParseTodoTxtErrors(t *testing.T) {
+	for _, data := range []string{"(A)\n", "x 2026-03-01\n", "ok\n+tag @ctx\n"} {
+		if _, err := parseTodoTxt([]byte(data), time.UTC, time.Now()); err == nil {
+			t.Errorf("parseTodoTxt(%q) succeeded, want an error", data)
+		}
+	}
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
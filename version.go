@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sort"
+
+	"todo/internal/render"
+)
+
+// Set at build time, e.g.
+//
+//	go build -ldflags "-X main.version=1.4.0 -X main.commit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%FT%TZ)"
+//
+// commit and buildDate fall back to the VCS stamp the go tool embeds.
+var (
+	version   = "dev"
+	commit    string
+	buildDate string
+)
+
+func init() {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	for _, s := range info.Settings {
+		switch {
+		case s.Key == "vcs.revision" && commit == "":
+			commit = s.Value
+		case s.Key == "vcs.time" && buildDate == "":
+			buildDate = s.Value
+		}
+	}
+}
+
+// features lists the optional subsystems this instance has turned on.
+func (a *app) features() []string {
+	cfg := a.cfg
+	out := []string{}
+	for name, on := range map[string]bool{
+		"encryption":   cfg.EncryptionKey != "",
+		"spa":          cfg.SPADir != "",
+		"h2c":          cfg.H2C,
+		"reuse_port":   cfg.ReusePort,
+		"admin":        cfg.AdminAddr != "",
+		"sentry":       cfg.SentryDSN != "",
+		"events.http":  cfg.EventWebhookURL != "",
+		"events.nats":  cfg.NATSURL != "",
+		"events.kafka": len(cfg.KafkaBrokers) > 0,
+		"events.mqtt":  cfg.MQTTURL != "",
+		"notify.email": cfg.SMTP.Addr != "",
+	} {
+		if on {
+			out = append(out, name)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (a *app) versionHandler(w http.ResponseWriter, r *http.Request) {
+	a.rnd.JSON(w, http.StatusOK, render.M{
+		"version":    version,
+		"commit":     commit,
+		"build_date": buildDate,
+		"go_version": runtime.Version(),
+		"features":   a.features(),
+	})
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"todo/internal/render"
+)
+
+const (
+	reasonOverdue   = "overdue"
+	reasonDue       = "due"
+	reasonScheduled = "scheduled"
+
+	defaultUpcomingDays = 7
+	maxUpcomingDays     = 90
+	agendaDays          = 7
+)
+
+var reasonRank = map[string]int{reasonOverdue: 0, reasonDue: 1, reasonScheduled: 2}
+
+// viewItem is an open todo in a smart view. Reason says why it is there:
+// overdue, due or scheduled to start; Date is that day in the configured
+// timezone.
+type viewItem struct {
+	todo
+	Reason string    `json:"reason"`
+	Date   string    `json:"date"`
+	at     time.Time // the due or start time Reason refers to
+}
+
+func (a *app) viewHandlers() http.Handler {
+	r := chi.NewRouter()
+	r.Get("/today", a.todayView)
+	r.Get("/upcoming", a.upcomingView)
+	r.Get("/week", a.weekView)
+	return r
+}
+
+// todayView serves everything that needs attention today: open todos that
+// are overdue, due today or scheduled to start today, highest priority
+// first.
+func (a *app) todayView(w http.ResponseWriter, r *http.Request) {
+	loc, ok := a.viewLocation(w, r)
+	if !ok {
+		return
+	}
+	today := startOfDay(time.Now().In(loc))
+	tomorrow := today.AddDate(0, 0, 1)
+
+	items, ok := a.viewItems(w, r, loc, today, listQuery{DueTo: tomorrow}, listQuery{StartFrom: today, StartTo: tomorrow})
+	if !ok {
+		return
+	}
+	slices.SortFunc(items, byPriority)
+	a.rnd.JSON(w, http.StatusOK, render.M{
+		"data":     items,
+		"counts":   countReasons(items),
+		"date":     today.Format(time.DateOnly),
+		"timezone": loc.String(),
+	})
+}
+
+// upcomingView serves open todos due or starting in the ?days= (default 7)
+// days after today, by day and then priority.
+func (a *app) upcomingView(w http.ResponseWriter, r *http.Request) {
+	days := defaultUpcomingDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxUpcomingDays {
+			a.rnd.JSON(w, http.StatusBadRequest, render.M{
+				"message": tr(r, "view.days_invalid", maxUpcomingDays),
+			})
+			return
+		}
+		days = n
+	}
+	loc, ok := a.viewLocation(w, r)
+	if !ok {
+		return
+	}
+	from := startOfDay(time.Now().In(loc)).AddDate(0, 0, 1)
+	to := from.AddDate(0, 0, days)
+
+	items, ok := a.viewItems(w, r, loc, from, listQuery{DueFrom: from, DueTo: to}, listQuery{StartFrom: from, StartTo: to})
+	if !ok {
+		return
+	}
+	slices.SortFunc(items, func(x, y viewItem) int {
+		return cmp.Or(cmp.Compare(x.Date, y.Date), byPriority(x, y))
+	})
+	a.rnd.JSON(w, http.StatusOK, render.M{
+		"data":     items,
+		"counts":   countReasons(items),
+		"from":     from.Format(time.DateOnly),
+		"to":       to.AddDate(0, 0, -1).Format(time.DateOnly),
+		"timezone": loc.String(),
+	})
+}
+
+// weekView serves the agenda for today and the six days after it: open
+// todos due or starting each day, every day present, plus a rollover of
+// everything still open from before today.
+func (a *app) weekView(w http.ResponseWriter, r *http.Request) {
+	loc, ok := a.viewLocation(w, r)
+	if !ok {
+		return
+	}
+	today := startOfDay(time.Now().In(loc))
+	end := today.AddDate(0, 0, agendaDays)
+
+	items, ok := a.viewItems(w, r, loc, today, listQuery{DueTo: end}, listQuery{StartFrom: today, StartTo: end})
+	if !ok {
+		return
+	}
+	slices.SortFunc(items, byPriority)
+
+	rollover := []viewItem{}
+	days := make([]render.M, 0, agendaDays)
+	byDay := map[string]int{}
+	for d := today; d.Before(end); d = d.AddDate(0, 0, 1) {
+		byDay[d.Format(time.DateOnly)] = len(days)
+		days = append(days, render.M{"date": d.Format(time.DateOnly), "todos": []viewItem{}})
+	}
+	for _, it := range items {
+		if it.Reason == reasonOverdue {
+			rollover = append(rollover, it)
+			continue
+		}
+		day := days[byDay[it.Date]]
+		day["todos"] = append(day["todos"].([]viewItem), it)
+	}
+
+	a.rnd.JSON(w, http.StatusOK, render.M{
+		"data":     days,
+		"rollover": rollover,
+		"from":     today.Format(time.DateOnly),
+		"to":       end.AddDate(0, 0, -1).Format(time.DateOnly),
+		"timezone": loc.String(),
+	})
+}
+
+// byPriority orders view items highest priority first, then overdue before
+// due before scheduled, then by time.
+func byPriority(x, y viewItem) int {
+	return cmp.Or(
+		cmp.Compare(priorityLevel(y.Priority), priorityLevel(x.Priority)),
+		cmp.Compare(reasonRank[x.Reason], reasonRank[y.Reason]),
+		x.at.Compare(y.at),
+		cmp.Compare(x.ID, y.ID),
+	)
+}
+
+// viewLocation loads the configured timezone, answering 500 when the
+// settings can't be read.
+func (a *app) viewLocation(w http.ResponseWriter, r *http.Request) (*time.Location, bool) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	s, err := a.settings.Load(ctx)
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "settings.fetch_failed"),
+			"error":   err.Error(),
+		})
+		return nil, false
+	}
+	return s.location(), true
+}
+
+// viewItems lists open todos matching due, then those matching start that
+// are not already in, and labels each. Todos due before overdueBefore are
+// overdue.
+func (a *app) viewItems(w http.ResponseWriter, r *http.Request, loc *time.Location, overdueBefore time.Time, due, start listQuery) ([]viewItem, bool) {
+	ctx, cancel := a.dbContext(r)
+	defer cancel()
+
+	due.Open, start.Open = true, true
+	byDue, err := a.todos.List(ctx, due)
+	var byStart []todoModel
+	if err == nil {
+		byStart, err = a.todos.List(ctx, start)
+	}
+	if err != nil {
+		a.rnd.JSON(w, http.StatusInternalServerError, render.M{
+			"message": tr(r, "todo.fetch_failed"),
+			"error":   err.Error(),
+		})
+		return nil, false
+	}
+
+	base := siblingTodoBase(r, "views")
+	items := make([]viewItem, 0, len(byDue)+len(byStart))
+	seen := map[string]bool{}
+	add := func(tm todoModel, reason string, at time.Time) {
+		t := tm.toTodo()
+		if seen[t.ID] {
+			return
+		}
+		seen[t.ID] = true
+		t.Links = todoLinks(base, t.ID)
+		items = append(items, viewItem{todo: t, Reason: reason, Date: at.In(loc).Format(time.DateOnly), at: at})
+	}
+	for _, tm := range byDue {
+		reason := reasonDue
+		if tm.DueDate.Before(overdueBefore) {
+			reason = reasonOverdue
+		}
+		add(tm, reason, *tm.DueDate)
+	}
+	for _, tm := range byStart {
+		add(tm, reasonScheduled, *tm.StartDate)
+	}
+	return items, true
+}
+
+func countReasons(items []viewItem) map[string]int {
+	counts := map[string]int{reasonOverdue: 0, reasonDue: 0, reasonScheduled: 0}
+	for _, it := range items {
+		counts[it.Reason]++
+	}
+	return counts
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"todo/internal/events"
+)
+
+// errCodeNoChangeStreams is returned by standalone servers, which don't
+// support $changeStream.
+const errCodeNoChangeStreams = 40573
+
+// Watch publishes every change to the todos collection on bus until ctx
+// is cancelled, resuming from the last seen event after interruptions.
+// Change streams need a replica set; on a standalone server Watch logs
+// that and returns.
+func (s *mongoTodoRepository) Watch(ctx context.Context, bus *events.Bus) {
+	var resume bson.Raw
+	for attempt := 0; ; attempt++ {
+		opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+		if resume != nil {
+			opts.SetStartAfter(resume)
+		}
+
+		stream, err := s.coll.Watch(ctx, mongo.Pipeline{}, opts)
+		if err == nil {
+			attempt = 0
+			for stream.Next(ctx) {
+				resume = stream.ResumeToken()
+				if e, ok := s.changeEvent(stream.Current); ok {
+					bus.Publish(e)
+				}
+			}
+			err = stream.Err()
+			stream.Close(context.Background())
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+		var cmdErr mongo.CommandError
+		if errors.As(err, &cmdErr) && cmdErr.Code == errCodeNoChangeStreams {
+			log.Println("events: change streams need a replica set; in-process events are disabled")
+			return
+		}
+		wait := backoff(attempt)
+		log.Printf("events: change stream ended, resuming in %s: %v", wait.Round(time.Millisecond), err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// changeEvent converts a change stream document into an event. Operations
+// other than insert, update, replace and delete are skipped.
+func (s *mongoTodoRepository) changeEvent(raw bson.Raw) (events.Event, bool) {
+	var change struct {
+		ID struct {
+			Data string `bson:"_data"`
+		} `bson:"_id"`
+		OperationType string              `bson:"operationType"`
+		ClusterTime   primitive.Timestamp `bson:"clusterTime"`
+		DocumentKey   struct {
+			ID primitive.ObjectID `bson:"_id"`
+		} `bson:"documentKey"`
+		FullDocument *todoModel `bson:"fullDocument"`
+	}
+	if err := bson.Unmarshal(raw, &change); err != nil {
+		log.Println("events: undecodable change:", err)
+		return events.Event{}, false
+	}
+
+	e := events.Event{
+		ID:      change.ID.Data,
+		Subject: change.DocumentKey.ID.Hex(),
+		Time:    time.Unix(int64(change.ClusterTime.T), 0).UTC(),
+	}
+	switch change.OperationType {
+	case "insert":
+		e.Type = events.TodoCreated
+	case "update", "replace":
+		e.Type = events.TodoUpdated
+	case "delete":
+		e.Type = events.TodoDeleted
+		return e, true
+	default:
+		return e, false
+	}
+
+	// The document can already be gone by the time an update is looked up.
+	if change.FullDocument != nil {
+		t := *change.FullDocument
+		if err := s.open(&t); err != nil {
+			log.Println("events: failed to decrypt changed todo:", err)
+			return e, false
+		}
+		e.Data = t.toTodo()
+	}
+	return e, true
+}